@@ -19,8 +19,10 @@ package frags
 
 import (
 	"encoding/json"
+	"slices"
 	"time"
 
+	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
 	"github.com/theirish81/frags/schema"
 	"github.com/theirish81/frags/util"
@@ -35,6 +37,28 @@ type Ai interface {
 	SetSystemPrompt(systemPrompt string)
 }
 
+// UsageTracker is implemented by the AIs that keep track of the tokens they use. Usage returns the usage accumulated
+// by the instance, broken down by model. New instances start from zero.
+type UsageTracker interface {
+	Usage() util.ModelUsage
+}
+
+// DownlevelSchema adapts a structured output schema to the dialect of an engine, logging the keywords the engine
+// doesn't support. Engines send the downleveled schema, while the runner keeps validating the answer against the
+// original one.
+func DownlevelSchema(runner ExportableRunner, engine string, sx *schema.Schema, dialect schema.Dialect) (*schema.Schema,
+	error) {
+	downleveled, dropped, err := sx.Downlevel(dialect)
+	if err != nil {
+		return nil, err
+	}
+	if len(dropped) > 0 {
+		runner.Logger().Info(log.NewEvent(log.GenericEventType, log.AiComponent).WithEngine(engine).
+			WithMessage("dropped schema keywords the engine doesn't support").WithContent(dropped))
+	}
+	return downleveled, nil
+}
+
 // dummyHistoryItem is a history item for testing purposes, to use with DummyAi.
 type dummyHistoryItem struct {
 	Text      string
@@ -45,19 +69,94 @@ type dummyHistoryItem struct {
 // DummyAi is a dummy AI model for testing purposes.
 type DummyAi struct {
 	History []dummyHistoryItem
+	usage   util.Usage
 }
 
 // Ask returns a dummy response for testing purposes.
 func (d *DummyAi) Ask(_ *util.FragsContext, text string, schema *schema.Schema, _ ToolDefinitions, _ ExportableRunner, resources ...resources.ResourceData) ([]byte, error) {
 	d.History = append(d.History, dummyHistoryItem{Text: text, Schema: schema, Resources: resources})
-	out := map[string]string{}
-	if schema != nil {
-		for k, _ := range schema.Properties {
-			out[k] = text
+	time.Sleep(1 * time.Second)
+	data, err := json.Marshal(dummyOutput(schema, text))
+	// one token per byte, to make usage predictable in tests
+	d.usage = d.usage.Add(util.Usage{Input: int64(len(text)), Output: int64(len(data))})
+	return data, err
+}
+
+// Usage returns the usage of the dummy model, where each byte counts as a token.
+func (d *DummyAi) Usage() util.ModelUsage {
+	return util.ModelUsage{"dummy": d.usage}
+}
+
+// dummyOutput generates an object with a value for each property of the schema. Strings are set to the given text.
+func dummyOutput(sx *schema.Schema, text string) map[string]any {
+	out := map[string]any{}
+	if sx != nil {
+		for k, v := range sx.Properties {
+			out[k] = dummyValue(v, text)
 		}
 	}
-	time.Sleep(1 * time.Second)
-	return json.Marshal(out)
+	return out
+}
+
+// dummyFormatSamples are the values dummyValue uses for the strings with a format
+var dummyFormatSamples = map[string]string{
+	"date":      "2000-01-01",
+	"date-time": "2000-01-01T00:00:00Z",
+	"time":      "00:00:00",
+	"email":     "dry.run@example.com",
+	"uri":       "https://example.com",
+	"uuid":      "00000000-0000-0000-0000-000000000000",
+	"ipv4":      "127.0.0.1",
+	"ipv6":      "::1",
+	"hostname":  "example.com",
+}
+
+// dummyValue generates a value that matches the schema. Strings are set to the given text, unless the schema asks for
+// a const, an enum value or a format. Numbers and arrays honour their lower bounds.
+func dummyValue(sx *schema.Schema, text string) any {
+	if sx.Const != nil {
+		return sx.Const
+	}
+	if len(sx.Enum) > 0 {
+		return sx.Enum[0]
+	}
+	if alternatives := slices.Concat(sx.AnyOf, sx.OneOf); len(alternatives) > 0 {
+		return dummyValue(alternatives[0], text)
+	}
+	switch sx.Type {
+	case schema.Object:
+		out := map[string]any{}
+		for k, v := range sx.Properties {
+			out[k] = dummyValue(v, text)
+		}
+		return out
+	case schema.Array:
+		count := 1
+		if sx.MinItems != nil && *sx.MinItems > 1 {
+			count = int(*sx.MinItems)
+		}
+		out := make([]any, 0, count)
+		for range count {
+			if sx.Items == nil {
+				out = append(out, text)
+			} else {
+				out = append(out, dummyValue(sx.Items, text))
+			}
+		}
+		return out
+	case schema.Integer, schema.Number:
+		if sx.Minimum != nil {
+			return *sx.Minimum
+		}
+		return 0
+	case schema.Boolean:
+		return false
+	default:
+		if sample, ok := dummyFormatSamples[sx.Format]; ok {
+			return sample
+		}
+		return text
+	}
 }
 
 func (d *DummyAi) SetFunctions(_ ExternalFunctions) {}
@@ -0,0 +1,152 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"fmt"
+)
+
+// AiConfig selects the AI a plan or a session runs on, overriding the AI the runner was created with. Engine is the
+// name of one of the AiFactories registered on the runner, while the other fields are handed over to the factory.
+// Pointer fields are nil when the engine defaults are not overridden. Fallbacks are the AIs to move to, in order, when
+// the engine fails with a transient error.
+type AiConfig struct {
+	Engine        string     `json:"engine" yaml:"engine"`
+	Model         string     `json:"model,omitempty" yaml:"model,omitempty"`
+	Temperature   *float32   `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	ThinkingLevel *string    `json:"thinkingLevel,omitempty" yaml:"thinkingLevel,omitempty"`
+	MaxTokens     *int       `json:"maxTokens,omitempty" yaml:"maxTokens,omitempty"`
+	Fallbacks     []AiConfig `json:"fallbacks,omitempty" yaml:"fallbacks,omitempty"`
+}
+
+// Name returns the name the AI is reported by, that is the engine and the model, if any
+func (c AiConfig) Name() string {
+	if c.Model == "" {
+		return c.Engine
+	}
+	return c.Engine + "/" + c.Model
+}
+
+// AiFactory creates an AI, with no conversation state, for the given configuration. The factory is invoked for every
+// session iteration that overrides its AI, possibly concurrently, so it should reuse its clients rather than creating
+// new ones.
+type AiFactory func(config AiConfig) (Ai, error)
+
+// AiFactories is a registry of AiFactory, by engine name
+type AiFactories map[string]AiFactory
+
+// UnknownAiEngineError is returned when a session requires an engine that has no factory registered on the runner
+type UnknownAiEngineError struct {
+	Session string
+	Engine  string
+}
+
+func (e UnknownAiEngineError) Error() string {
+	return fmt.Sprintf("session %s requires AI engine %s, which is not available", e.Session, e.Engine)
+}
+
+// checkAiRequirements checks that every session overriding its AI, either directly or via the plan, references
+// registered engines
+func (r *Runner) checkAiRequirements() error {
+	for id, session := range r.sessionManager.Sessions.Iter() {
+		config := r.sessionAiConfig(session)
+		if config == nil {
+			continue
+		}
+		for _, c := range append([]AiConfig{*config}, config.Fallbacks...) {
+			if _, ok := r.aiFactories[c.Engine]; !ok {
+				return UnknownAiEngineError{Session: id, Engine: c.Engine}
+			}
+		}
+	}
+	return nil
+}
+
+// sessionAiConfig returns the AI configuration of the session, defaulting to the one of the plan. It returns nil if
+// the session runs on the runner AI.
+func (r *Runner) sessionAiConfig(session Session) *AiConfig {
+	if session.Ai != nil {
+		return session.Ai
+	}
+	return r.sessionManager.Ai
+}
+
+// newSessionAi creates a new instance of the AI the session runs on. Sessions with no AI configuration use the
+// runner AI, while the others get one from the factory of their engine. If the configuration has fallbacks, the AIs
+// are chained in a FallbackAi.
+func (r *Runner) newSessionAi(sessionID string, session Session) (Ai, error) {
+	config := r.sessionAiConfig(session)
+	if config == nil {
+		return r.ai.New(), nil
+	}
+	ai, err := r.newAi(sessionID, *config)
+	if err != nil {
+		return nil, err
+	}
+	if len(config.Fallbacks) == 0 {
+		return ai, nil
+	}
+	members := []FallbackMember{{Name: config.Name(), Ai: ai}}
+	for _, c := range config.Fallbacks {
+		ai, err := r.newAi(sessionID, c)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, FallbackMember{Name: c.Name(), Ai: ai})
+	}
+	return NewFallbackAi(members...), nil
+}
+
+// newAi creates an AI from the factory of its engine, set up with the functions and the system prompt of the runner
+func (r *Runner) newAi(sessionID string, config AiConfig) (Ai, error) {
+	factory, ok := r.aiFactories[config.Engine]
+	if !ok {
+		return nil, UnknownAiEngineError{Session: sessionID, Engine: config.Engine}
+	}
+	ai, err := factory(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create AI for engine %s: %w", config.Engine, err)
+	}
+	if limiter := r.rateLimiter(config.Engine); limiter != nil {
+		ai = NewRateLimitedAi(ai, config.Engine, limiter)
+	}
+	if r.ExternalFunctions != nil {
+		ai.SetFunctions(r.ExternalFunctions)
+	}
+	if r.systemPrompt != "" {
+		ai.SetSystemPrompt(r.systemPrompt)
+	}
+	return ai, nil
+}
+
+// rateLimiter returns the rate limiter shared by the AIs of the engine, or nil if the runner has no rate limits
+func (r *Runner) rateLimiter(engine string) *RateLimiter {
+	// sub-plans share the rate limiters of the run that started them
+	if r.parent != nil {
+		return r.parent.runner.rateLimiter(engine)
+	}
+	if r.rateLimits.IsZero() {
+		return nil
+	}
+	r.rateLimitersMutex.Lock()
+	defer r.rateLimitersMutex.Unlock()
+	if _, ok := r.rateLimiters[engine]; !ok {
+		r.rateLimiters[engine] = NewRateLimiter(r.rateLimits)
+	}
+	return r.rateLimiters[engine]
+}
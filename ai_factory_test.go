@@ -0,0 +1,90 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestRunner_AiFactories(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+systemPrompt: you are a zoologist
+sessions:
+  extract:
+    prompt: list some animals
+  reason:
+    prompt: explain why cats are better than dogs
+    ai:
+      engine: large
+      model: big-model
+      temperature: 0.2
+      maxTokens: 1000
+schema:
+  properties:
+    animals:
+      type: string
+      x-session: extract
+    explanation:
+      type: string
+      x-session: reason
+`)))
+
+	t.Run("sessions run on the AI of their engine", func(t *testing.T) {
+		configs := make([]AiConfig, 0)
+		created := make([]*DummyAi, 0)
+		factories := AiFactories{"large": func(config AiConfig) (Ai, error) {
+			configs = append(configs, config)
+			ai := NewDummyAi()
+			created = append(created, ai)
+			return ai, nil
+		}}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithAiFactories(factories))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Len(t, configs, 1)
+		assert.Equal(t, "big-model", configs[0].Model)
+		assert.Equal(t, float32(0.2), *configs[0].Temperature)
+		assert.Equal(t, 1000, *configs[0].MaxTokens)
+		assert.Nil(t, configs[0].ThinkingLevel)
+		assert.Len(t, created[0].History, 1)
+		assert.Contains(t, created[0].History[0].Text, "explain why cats are better than dogs")
+	})
+	t.Run("unknown engines prevent the run", func(t *testing.T) {
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi())
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		engineErr := UnknownAiEngineError{}
+		assert.True(t, errors.As(err, &engineErr))
+		assert.Equal(t, "reason", engineErr.Session)
+		assert.Equal(t, "large", engineErr.Engine)
+	})
+	t.Run("factory errors fail the session", func(t *testing.T) {
+		factories := AiFactories{"large": func(config AiConfig) (Ai, error) {
+			return nil, errors.New("no credentials")
+		}}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithAiFactories(factories))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.ErrorContains(t, err, "no credentials")
+	})
+}
@@ -36,6 +36,7 @@ type Ai struct {
 	content      []anthropic.MessageParam
 	Functions    frags.ExternalFunctions
 	config       Config
+	usage        util.Usage
 }
 
 type Config struct {
@@ -125,6 +126,15 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		return nil, err
 	}
 
+	var claudeSchema map[string]any
+	if sx != nil {
+		downleveled, err := frags.DownlevelSchema(runner, engine, sx, schema.AnthropicDialect)
+		if err != nil {
+			return nil, err
+		}
+		claudeSchema = SchemaToClaudeMap(downleveled)
+	}
+
 	d.content = append(d.content, newMsg)
 
 	keepGoing := true
@@ -177,7 +187,7 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 			}
 			if sx != nil {
 				params.OutputConfig.Format = anthropic.JSONOutputFormatParam{
-					Schema: SchemaToClaudeMap(sx),
+					Schema: claudeSchema,
 				}
 			}
 
@@ -197,6 +207,9 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 			return nil, err
 		}
 
+		if res != nil {
+			d.trackUsage(res.Usage)
+		}
 		if res == nil || len(res.Content) == 0 {
 			keepGoing = false
 			continue
@@ -307,3 +320,18 @@ func (d *Ai) SetFunctions(functions frags.ExternalFunctions) {
 func (d *Ai) RunFunction(ctx *util.FragsContext, functionCall frags.FunctionCaller, runner frags.ExportableRunner) (any, error) {
 	return runner.RunFunction(ctx, functionCall.Name, functionCall.Args)
 }
+
+// trackUsage adds the usage of a response to the usage of the instance. Anthropic reports cache reads and writes
+// apart from the input tokens, so they're summed up.
+func (d *Ai) trackUsage(usage anthropic.Usage) {
+	d.usage = d.usage.Add(util.Usage{
+		Input:  usage.InputTokens + usage.CacheReadInputTokens + usage.CacheCreationInputTokens,
+		Output: usage.OutputTokens,
+		Cached: usage.CacheReadInputTokens,
+	})
+}
+
+// Usage returns the tokens used by this instance, according to the frags.UsageTracker interface
+func (d *Ai) Usage() util.ModelUsage {
+	return util.ModelUsage{d.config.Model: d.usage}
+}
@@ -0,0 +1,194 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/util"
+)
+
+// Budget caps the resources a run can consume. Once a limit is hit, the runner refuses to start new AI interactions
+// and function calls, and the run fails with a BudgetExceededError. Zero values mean no limit.
+// MaxTokens is the maximum number of tokens (input plus output), as reported by the AI engines.
+// MaxCost is the maximum estimated cost. It requires a price table covering all the models in use.
+// MaxToolCalls is the maximum number of function invocations, either by the AI, preCalls or postCalls.
+// MaxWallTime is the maximum duration of the run (e.g. 10m).
+type Budget struct {
+	MaxTokens    int64   `json:"maxTokens,omitempty" yaml:"maxTokens,omitempty" validate:"omitempty,min=0"`
+	MaxCost      float64 `json:"maxCost,omitempty" yaml:"maxCost,omitempty" validate:"omitempty,min=0"`
+	MaxToolCalls int     `json:"maxToolCalls,omitempty" yaml:"maxToolCalls,omitempty" validate:"omitempty,min=0"`
+	MaxWallTime  *string `json:"maxWallTime,omitempty" yaml:"maxWallTime,omitempty"`
+}
+
+// Merge returns a budget with the strictest limits of the two budgets
+func (b Budget) Merge(other Budget) Budget {
+	return Budget{
+		MaxTokens:    minLimit(b.MaxTokens, other.MaxTokens),
+		MaxCost:      minLimit(b.MaxCost, other.MaxCost),
+		MaxToolCalls: minLimit(b.MaxToolCalls, other.MaxToolCalls),
+		MaxWallTime: func() *string {
+			if b.wallTime() == 0 || (other.wallTime() > 0 && other.wallTime() < b.wallTime()) {
+				return other.MaxWallTime
+			}
+			return b.MaxWallTime
+		}(),
+	}
+}
+
+// wallTime returns the maximum wall time as a duration, or zero if there's none
+func (b Budget) wallTime() time.Duration {
+	return util.ParseDurationOrDefault(b.MaxWallTime, 0)
+}
+
+// minLimit returns the smallest of two limits, where zero means no limit
+func minLimit[T int | int64 | float64](a T, b T) T {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 {
+		return a
+	}
+	return min(a, b)
+}
+
+// BudgetLimit is the limit of a budget that has been exceeded
+type BudgetLimit string
+
+const (
+	TokensBudgetLimit    = BudgetLimit("maxTokens")
+	CostBudgetLimit      = BudgetLimit("maxCost")
+	ToolCallsBudgetLimit = BudgetLimit("maxToolCalls")
+	WallTimeBudgetLimit  = BudgetLimit("maxWallTime")
+)
+
+// BudgetExceededError is returned when a run exceeds one of the limits of its budget
+type BudgetExceededError struct {
+	Limit BudgetLimit
+	Used  string
+	Max   string
+}
+
+func (e BudgetExceededError) Error() string {
+	return fmt.Sprintf("budget exceeded: %s is %s, used %s", e.Limit, e.Max, e.Used)
+}
+
+// startBudget resets the budget counters and arms the wall time limit, if any. The returned function disarms it.
+// When a limit is exceeded, cancel is invoked, so the run stops regardless of the error policies of the sessions.
+func (r *Runner) startBudget(cancel func(error)) (func(), error) {
+	r.budget = r.budget.Merge(r.sessionManager.Budget.orEmpty())
+	if r.budget.MaxCost > 0 && r.priceTable == nil {
+		return nil, errors.New("the maxCost budget requires a price table")
+	}
+	r.budgetMutex.Lock()
+	r.toolCalls = 0
+	r.budgetCancel = cancel
+	r.budgetMutex.Unlock()
+	wallTime := r.budget.wallTime()
+	if wallTime <= 0 {
+		return func() {}, nil
+	}
+	timer := time.AfterFunc(wallTime, func() {
+		r.exceedBudget(BudgetExceededError{Limit: WallTimeBudgetLimit, Max: wallTime.String(), Used: wallTime.String()})
+	})
+	return func() {
+		timer.Stop()
+	}, nil
+}
+
+// orEmpty returns the budget, or an empty budget if nil
+func (b *Budget) orEmpty() Budget {
+	if b == nil {
+		return Budget{}
+	}
+	return *b
+}
+
+// checkBudget returns a BudgetExceededError if the tokens or the cost of the run have exceeded the budget. Sub-plans
+// are bound by the budget of the run that started them too.
+func (r *Runner) checkBudget() error {
+	if r.parent != nil {
+		if err := r.parent.runner.checkBudget(); err != nil {
+			return err
+		}
+	}
+	if r.budget.MaxTokens <= 0 && r.budget.MaxCost <= 0 {
+		return nil
+	}
+	r.usageMutex.Lock()
+	usage := util.ModelUsage{}
+	for _, iterations := range r.usage {
+		for _, u := range iterations {
+			usage = usage.Add(u)
+		}
+	}
+	r.usageMutex.Unlock()
+	if r.budget.MaxTokens > 0 {
+		if total := usage.Total().Total(); total >= r.budget.MaxTokens {
+			return r.exceedBudget(BudgetExceededError{Limit: TokensBudgetLimit,
+				Max: strconv.FormatInt(r.budget.MaxTokens, 10), Used: strconv.FormatInt(total, 10)})
+		}
+	}
+	if r.budget.MaxCost > 0 {
+		cost, ok := r.priceTable.Cost(usage)
+		if !ok {
+			// if we cannot estimate the cost, we cannot guarantee the budget is respected
+			return r.exceedBudget(BudgetExceededError{Limit: CostBudgetLimit,
+				Max: strconv.FormatFloat(r.budget.MaxCost, 'f', -1, 64), Used: "unknown (missing model prices)"})
+		}
+		if cost >= r.budget.MaxCost {
+			return r.exceedBudget(BudgetExceededError{Limit: CostBudgetLimit,
+				Max: strconv.FormatFloat(r.budget.MaxCost, 'f', -1, 64), Used: strconv.FormatFloat(cost, 'f', 4, 64)})
+		}
+	}
+	return nil
+}
+
+// spendToolCall accounts for a function invocation, returning a BudgetExceededError if the budget doesn't allow it
+func (r *Runner) spendToolCall() error {
+	if r.parent != nil {
+		if err := r.parent.runner.spendToolCall(); err != nil {
+			return err
+		}
+	}
+	r.budgetMutex.Lock()
+	if r.budget.MaxToolCalls > 0 && r.toolCalls >= r.budget.MaxToolCalls {
+		r.budgetMutex.Unlock()
+		return r.exceedBudget(BudgetExceededError{Limit: ToolCallsBudgetLimit,
+			Max: strconv.Itoa(r.budget.MaxToolCalls), Used: strconv.Itoa(r.toolCalls)})
+	}
+	r.toolCalls++
+	r.budgetMutex.Unlock()
+	return r.checkBudget()
+}
+
+// exceedBudget logs the error and cancels the run
+func (r *Runner) exceedBudget(err BudgetExceededError) error {
+	r.logger.Err(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("budget exceeded").WithErr(err))
+	r.budgetMutex.Lock()
+	cancel := r.budgetCancel
+	r.budgetMutex.Unlock()
+	if cancel != nil {
+		cancel(err)
+	}
+	return err
+}
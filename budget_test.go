@@ -0,0 +1,129 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// slowAi never answers, until the context is cancelled
+type slowAi struct {
+	DummyAi
+}
+
+func (s *slowAi) Ask(ctx *util.FragsContext, _ string, _ *schema.Schema, _ ToolDefinitions, _ ExportableRunner,
+	_ ...resources.ResourceData) ([]byte, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (s *slowAi) New() Ai {
+	return s
+}
+
+func TestBudget_Merge(t *testing.T) {
+	merged := Budget{MaxTokens: 100, MaxCost: 2, MaxWallTime: util.Ptr("10m")}.
+		Merge(Budget{MaxTokens: 50, MaxToolCalls: 3, MaxWallTime: util.Ptr("1h")})
+	assert.Equal(t, Budget{MaxTokens: 50, MaxCost: 2, MaxToolCalls: 3, MaxWallTime: util.Ptr("10m")}, merged)
+	assert.Equal(t, Budget{}, Budget{}.Merge(Budget{}))
+}
+
+func TestRunner_RunBudget(t *testing.T) {
+	plan := []byte(`
+sessions:
+  first:
+    prompt: describe a cat
+  second:
+    prompt: describe a dog
+    dependsOn:
+      - session: first
+schema:
+  properties:
+    p1:
+      type: string
+      x-session: first
+    p2:
+      type: string
+      x-session: second
+`)
+	t.Run("tokens", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(plan))
+		mgr.Budget = &Budget{MaxTokens: 10}
+		ai := NewDummyAi()
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		budgetErr := BudgetExceededError{}
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, TokensBudgetLimit, budgetErr.Limit)
+		assert.Contains(t, out, "p1")
+		assert.NotContains(t, out, "p2")
+	})
+	t.Run("cost requires a price table", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(plan))
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithBudget(Budget{MaxCost: 1}))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.ErrorContains(t, err, "price table")
+	})
+	t.Run("cost", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(plan))
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithBudget(Budget{MaxCost: 0.0001}),
+			WithPriceTable(util.PriceTable{"dummy": {Input: 100, Output: 100}}))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		budgetErr := BudgetExceededError{}
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, CostBudgetLimit, budgetErr.Limit)
+	})
+	t.Run("tool calls", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(plan))
+		mgr.PreCalls = FunctionCallers{{Name: "f1"}, {Name: "f1"}}
+		calls := 0
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithBudget(Budget{MaxToolCalls: 1}),
+			WithExternalFunctions(ExternalFunctions{"f1": {Name: "f1", Func: func(ctx *util.FragsContext, data map[string]any) (any, error) {
+				calls++
+				return "ok", nil
+			}}}))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		budgetErr := BudgetExceededError{}
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, ToolCallsBudgetLimit, budgetErr.Limit)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("wall time", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(plan))
+		mgr.Budget = &Budget{MaxWallTime: util.Ptr("100ms")}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), &slowAi{})
+		start := time.Now()
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		budgetErr := BudgetExceededError{}
+		assert.True(t, errors.As(err, &budgetErr))
+		assert.Equal(t, WallTimeBudgetLimit, budgetErr.Limit)
+		assert.Less(t, time.Since(start), 10*time.Second)
+	})
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/theirish81/frags/caches"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// CachedAi is an Ai decorator that caches the responses of the AI. Responses are keyed by model, system prompt,
+// prompt, schema, tools, resource content hashes and by the interactions that preceded them in the conversation, so
+// multi-turn conversations are cached as a whole.
+// When an interaction misses the cache after some hits in the same conversation, the AI never saw the cached
+// interactions, so they are asked again to bring the AI up to speed before the new one.
+type CachedAi struct {
+	ai           Ai
+	store        caches.Store
+	model        string
+	ttl          time.Duration
+	systemPrompt string
+	previous     string
+	pending      []interaction
+	hit          bool
+}
+
+// interaction is a request to the AI, kept so it can be asked again to an AI that has not seen it
+type interaction struct {
+	text      string
+	schema    *schema.Schema
+	tools     ToolDefinitions
+	resources []resources.ResourceData
+}
+
+// NewCachedAi returns a CachedAi wrapping the AI. Model identifies the engine and the model of the AI, so different
+// models never share responses. A zero TTL means the responses never expire.
+func NewCachedAi(ai Ai, store caches.Store, model string, ttl time.Duration) *CachedAi {
+	return &CachedAi{ai: ai, store: store, model: model, ttl: ttl}
+}
+
+// Ask returns the cached response if there's one, or asks the AI and caches its response, according to the Frags
+// interface
+func (c *CachedAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	fingerprint, err := newCassetteRequest(c.previous, c.systemPrompt, text, sx, tools, rx...).Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(c.model + "\n" + fingerprint))
+	key := hex.EncodeToString(hash[:])
+	entry, err := c.store.Get(ctx, key)
+	if err == nil {
+		runner.Logger().Info(log.NewEvent(log.CacheEventType, log.AiComponent).WithMessage("cache hit").
+			WithArg("key", key))
+		c.pending = append(c.pending, interaction{text: text, schema: sx, tools: tools, resources: rx})
+		c.previous = fingerprint
+		c.hit = true
+		return entry.Response, nil
+	}
+	if !errors.Is(err, caches.ErrCacheMiss) {
+		// a broken cache should not break the run
+		runner.Logger().Warn(log.NewEvent(log.ErrorEventType, log.AiComponent).WithMessage("failed to read cache").
+			WithErr(err))
+	}
+	runner.Logger().Debug(log.NewEvent(log.CacheEventType, log.AiComponent).WithMessage("cache miss").
+		WithArg("key", key))
+	c.hit = false
+	for len(c.pending) > 0 {
+		p := c.pending[0]
+		if _, err := c.ai.Ask(ctx, p.text, p.schema, p.tools, runner, p.resources...); err != nil {
+			return nil, err
+		}
+		c.pending = c.pending[1:]
+	}
+	data, err := c.ai.Ask(ctx, text, sx, tools, runner, rx...)
+	if err != nil {
+		return nil, err
+	}
+	c.previous = fingerprint
+	if err := c.store.Set(ctx, key, caches.NewEntry(data, c.ttl)); err != nil {
+		runner.Logger().Warn(log.NewEvent(log.ErrorEventType, log.AiComponent).WithMessage("failed to write cache").
+			WithErr(err))
+	}
+	return data, nil
+}
+
+// New creates a new CachedAi, starting a new conversation
+func (c *CachedAi) New() Ai {
+	return &CachedAi{
+		ai:           c.ai.New(),
+		store:        c.store,
+		model:        c.model,
+		ttl:          c.ttl,
+		systemPrompt: c.systemPrompt,
+	}
+}
+
+func (c *CachedAi) SetFunctions(functions ExternalFunctions) {
+	c.ai.SetFunctions(functions)
+}
+
+func (c *CachedAi) SetSystemPrompt(systemPrompt string) {
+	c.systemPrompt = systemPrompt
+	c.ai.SetSystemPrompt(systemPrompt)
+}
+
+func (c *CachedAi) RunFunction(ctx *util.FragsContext, functionCall FunctionCaller, runner ExportableRunner) (any, error) {
+	return c.ai.RunFunction(ctx, functionCall, runner)
+}
+
+// Usage returns the tokens used by the wrapped AI. Cache hits spend no tokens.
+func (c *CachedAi) Usage() util.ModelUsage {
+	if tracker, ok := c.ai.(UsageTracker); ok {
+		return tracker.Usage()
+	}
+	return util.ModelUsage{}
+}
+
+// Engine returns the engine of the wrapped AI that answered the last interaction, if it's an EngineReporter. Cache
+// hits are answered by no engine.
+func (c *CachedAi) Engine() string {
+	if reporter, ok := c.ai.(EngineReporter); ok && !c.hit {
+		return reporter.Engine()
+	}
+	return ""
+}
@@ -0,0 +1,100 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/caches"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// recordingDummyAi keeps track of the prompts it was asked, across instances
+type recordingDummyAi struct {
+	DummyAi
+	asked *[]string
+}
+
+func (a *recordingDummyAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	*a.asked = append(*a.asked, text)
+	return a.DummyAi.Ask(ctx, text, sx, tools, runner, rx...)
+}
+
+func (a *recordingDummyAi) New() Ai {
+	return &recordingDummyAi{asked: a.asked}
+}
+
+func TestCachedAi(t *testing.T) {
+	plan := `
+sessions:
+  one:
+    prePrompt: think about cats
+    prompt: describe a cat
+schema:
+  properties:
+    p1:
+      type: string
+      x-session: one
+`
+	asked := make([]string, 0)
+	store := caches.NewMemoryStore()
+	run := func(plan string) util.ProgMap {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(plan)))
+		ai := NewCachedAi(&recordingDummyAi{asked: &asked}, store, "dummy", time.Hour)
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		return out
+	}
+	first := run(plan)
+	assert.Len(t, asked, 2)
+
+	t.Run("identical conversations are served from the cache", func(t *testing.T) {
+		asked = asked[:0]
+		assert.Equal(t, first, run(plan))
+		assert.Empty(t, asked)
+	})
+	t.Run("a miss replays the cached part of the conversation", func(t *testing.T) {
+		asked = asked[:0]
+		run(strings.Replace(plan, "describe a cat", "describe a tiger", 1))
+		assert.Len(t, asked, 2)
+		assert.Contains(t, asked[0], "think about cats")
+		assert.Equal(t, "describe a tiger", asked[1])
+	})
+	t.Run("cache hits are answered by no engine", func(t *testing.T) {
+		fallback := NewFallbackAi(FallbackMember{Name: "only", Ai: NewDummyAi()})
+		ai := NewCachedAi(fallback, caches.NewMemoryStore(), "fallback", time.Hour)
+		engines := func() map[string]map[int]string {
+			mgr := NewSessionManager()
+			assert.NoError(t, mgr.FromYAML([]byte(plan)))
+			runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+			_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+			assert.NoError(t, err)
+			return runner.Usage().Engines
+		}
+		assert.Equal(t, map[string]map[int]string{"one": {0: "only"}}, engines())
+		assert.Empty(t, engines())
+	})
+}
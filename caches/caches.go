@@ -0,0 +1,63 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package caches
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss is returned by a Store when the requested entry does not exist, or has expired.
+var ErrCacheMiss = errors.New("cache miss")
+
+// Entry is a cached AI response.
+type Entry struct {
+	// Response is the response of the AI.
+	Response []byte `json:"response"`
+	// CreatedAt is the point in time when the entry was stored.
+	CreatedAt time.Time `json:"createdAt"`
+	// ExpiresAt is the point in time after which the entry is no longer valid. The zero value means it never expires.
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+}
+
+// NewEntry creates a new entry for the response, that expires after the TTL. A zero TTL means it never expires.
+func NewEntry(response []byte, ttl time.Duration) Entry {
+	now := time.Now()
+	entry := Entry{Response: response, CreatedAt: now}
+	if ttl > 0 {
+		entry.ExpiresAt = now.Add(ttl)
+	}
+	return entry
+}
+
+// Expired returns true if the entry has expired.
+func (e Entry) Expired() bool {
+	return !e.ExpiresAt.IsZero() && time.Now().After(e.ExpiresAt)
+}
+
+// Store defines the interface for caching AI responses.
+// Implementations handle the storage details (e.g., memory, filesystem, database).
+type Store interface {
+	// Get retrieves the entry with the given key. It returns ErrCacheMiss if no such entry exists, or if it expired.
+	Get(ctx context.Context, key string) (*Entry, error)
+	// Set stores the entry, replacing any previous entry with the same key.
+	Set(ctx context.Context, key string, entry Entry) error
+	// Delete removes the entry with the given key. Deleting an entry that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package caches
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	_, err := store.Get(t.Context(), "abc")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	assert.NoError(t, store.Set(t.Context(), "abc", NewEntry([]byte(`{"p1":"foo"}`), 0)))
+	entry, err := store.Get(t.Context(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, `{"p1":"foo"}`, string(entry.Response))
+
+	assert.NoError(t, store.Set(t.Context(), "expired", NewEntry([]byte("bar"), time.Millisecond)))
+	time.Sleep(5 * time.Millisecond)
+	_, err = store.Get(t.Context(), "expired")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+
+	assert.NoError(t, store.Delete(t.Context(), "abc"))
+	_, err = store.Get(t.Context(), "abc")
+	assert.ErrorIs(t, err, ErrCacheMiss)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore())
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+	testStore(t, store)
+	assert.Error(t, store.Set(t.Context(), "../escape", NewEntry(nil, 0)))
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(t.Context(), filepath.Join(t.TempDir(), "cache.db"))
+	assert.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+	testStore(t, store)
+}
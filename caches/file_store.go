@@ -0,0 +1,113 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package caches
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore implements Store using one JSON file per entry in a directory of the local filesystem.
+type FileStore struct {
+	dir string
+	mx  sync.Mutex
+}
+
+// NewFileStore creates a new FileStore. The directory is created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Path returns the path of the file holding the entry with the given key.
+func (s *FileStore) Path(key string) string {
+	return filepath.Join(s.dir, key+".json")
+}
+
+// Get reads the entry with the given key from its file. Expired entries are evicted.
+func (s *FileStore) Get(_ context.Context, key string) (*Entry, error) {
+	if err := validateKey(key); err != nil {
+		return nil, err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	data, err := os.ReadFile(s.Path(key))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+	entry := Entry{}
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return nil, err
+	}
+	if entry.Expired() {
+		_ = os.Remove(s.Path(key))
+		return nil, ErrCacheMiss
+	}
+	return &entry, nil
+}
+
+// Set writes the entry to its file. The file is first written to a temporary location and then renamed, so
+// a crash while saving never leaves a truncated entry behind.
+func (s *FileStore) Set(_ context.Context, key string, entry Entry) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	tmp := s.Path(key) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path(key))
+}
+
+// Delete removes the file of the entry with the given key.
+func (s *FileStore) Delete(_ context.Context, key string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := os.Remove(s.Path(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// validateKey makes sure the key can safely be used as a file name.
+func validateKey(key string) error {
+	if key == "" || strings.ContainsAny(key, `/\`) || key == "." || key == ".." {
+		return fmt.Errorf("invalid cache key: %q", key)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package caches
+
+import (
+	"context"
+	"sync"
+)
+
+// MemoryStore implements Store in memory. Entries do not survive the process.
+type MemoryStore struct {
+	entries map[string]Entry
+	mx      sync.Mutex
+}
+
+// NewMemoryStore creates a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{entries: make(map[string]Entry)}
+}
+
+// Get retrieves the entry with the given key. Expired entries are evicted.
+func (s *MemoryStore) Get(_ context.Context, key string) (*Entry, error) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	entry, ok := s.entries[key]
+	if !ok {
+		return nil, ErrCacheMiss
+	}
+	if entry.Expired() {
+		delete(s.entries, key)
+		return nil, ErrCacheMiss
+	}
+	return &entry, nil
+}
+
+// Set stores the entry.
+func (s *MemoryStore) Set(_ context.Context, key string, entry Entry) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.entries[key] = entry
+	return nil
+}
+
+// Delete removes the entry with the given key.
+func (s *MemoryStore) Delete(_ context.Context, key string) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	delete(s.entries, key)
+	return nil
+}
@@ -0,0 +1,94 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package caches
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore implements Store using a SQLite database.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at the given path and makes sure the cache table exists.
+func NewSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't deal well with concurrent writers, and the AI instances write from multiple workers
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS frags_cache (
+		key TEXT PRIMARY KEY,
+		response BLOB NOT NULL,
+		created_at TIMESTAMP NOT NULL,
+		expires_at TIMESTAMP
+	)`); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Get retrieves the entry with the given key. Expired entries are evicted.
+func (s *SQLiteStore) Get(ctx context.Context, key string) (*Entry, error) {
+	entry := Entry{}
+	var expiresAt sql.NullTime
+	if err := s.db.QueryRowContext(ctx, `SELECT response, created_at, expires_at FROM frags_cache WHERE key = ?`, key).
+		Scan(&entry.Response, &entry.CreatedAt, &expiresAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCacheMiss
+		}
+		return nil, err
+	}
+	entry.ExpiresAt = expiresAt.Time
+	if entry.Expired() {
+		_ = s.Delete(ctx, key)
+		return nil, ErrCacheMiss
+	}
+	return &entry, nil
+}
+
+// Set upserts the entry.
+func (s *SQLiteStore) Set(ctx context.Context, key string, entry Entry) error {
+	var expiresAt *time.Time
+	if !entry.ExpiresAt.IsZero() {
+		expiresAt = &entry.ExpiresAt
+	}
+	_, err := s.db.ExecContext(ctx, `INSERT INTO frags_cache (key, response, created_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(key) DO UPDATE SET response = excluded.response, created_at = excluded.created_at,
+		expires_at = excluded.expires_at`, key, entry.Response, entry.CreatedAt, expiresAt)
+	return err
+}
+
+// Delete removes the entry with the given key.
+func (s *SQLiteStore) Delete(ctx context.Context, key string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM frags_cache WHERE key = ?`, key)
+	return err
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
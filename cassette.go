@@ -0,0 +1,287 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// CassetteMode is the mode of a CassetteAi
+type CassetteMode string
+
+const (
+	// RecordCassetteMode proxies the requests to a real AI, and records the interactions
+	RecordCassetteMode = CassetteMode("record")
+	// ReplayCassetteMode serves the recorded interactions, without calling any AI
+	ReplayCassetteMode = CassetteMode("replay")
+)
+
+// Cassette is a recorded AI interaction. The request is stored for readability, but interactions are matched by
+// fingerprint only.
+type Cassette struct {
+	Fingerprint string          `json:"fingerprint"`
+	Request     CassetteRequest `json:"request"`
+	Response    string          `json:"response"`
+	ToolCalls   []CassetteCall  `json:"toolCalls,omitempty"`
+	Usage       util.ModelUsage `json:"usage,omitempty"`
+}
+
+// CassetteRequest is everything that determines the answer of the AI. Previous is the fingerprint of the previous
+// interaction in the same conversation, so the same prompt in a different conversation is a different request.
+type CassetteRequest struct {
+	Previous     string             `json:"previous,omitempty"`
+	SystemPrompt string             `json:"systemPrompt,omitempty"`
+	Prompt       string             `json:"prompt"`
+	Schema       *schema.Schema     `json:"schema,omitempty"`
+	Tools        ToolDefinitions    `json:"tools,omitempty"`
+	Resources    []CassetteResource `json:"resources,omitempty"`
+}
+
+// CassetteResource identifies a resource sent to the AI by its content hash
+type CassetteResource struct {
+	Identifier string `json:"identifier"`
+	MediaType  string `json:"mediaType"`
+	Hash       string `json:"hash"`
+}
+
+// CassetteCall is a function the AI called while answering. Tool calls are recorded for reference, but not performed
+// again in replay mode, as their results are already reflected in the response.
+type CassetteCall struct {
+	Name   string         `json:"name"`
+	Args   map[string]any `json:"args,omitempty"`
+	Result any            `json:"result,omitempty"`
+	Err    string         `json:"error,omitempty"`
+}
+
+// UnmatchedCassetteError is returned in replay mode when no recorded interaction matches the request
+type UnmatchedCassetteError struct {
+	Fingerprint string
+	Prompt      string
+}
+
+func (e UnmatchedCassetteError) Error() string {
+	return fmt.Sprintf("no recorded interaction matches the request %s (prompt: %.80q). The plan or its inputs "+
+		"changed since the recording", e.Fingerprint, e.Prompt)
+}
+
+// CassetteAi is an Ai decorator that records the interactions with a real AI to a directory of cassettes, or replays
+// them, matching each request by its fingerprint. Each interaction is stored in its own <fingerprint>.json file.
+type CassetteAi struct {
+	ai           Ai
+	mode         CassetteMode
+	dir          string
+	systemPrompt string
+	functions    ExternalFunctions
+	previous     string
+	usage        util.ModelUsage
+}
+
+// NewRecordingAi returns a CassetteAi that proxies the requests to the given AI, recording them in the directory.
+func NewRecordingAi(ai Ai, dir string) (*CassetteAi, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &CassetteAi{ai: ai, mode: RecordCassetteMode, dir: dir, usage: util.ModelUsage{}}, nil
+}
+
+// NewReplayingAi returns a CassetteAi that serves the interactions recorded in the directory.
+func NewReplayingAi(dir string) (*CassetteAi, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return nil, err
+	}
+	return &CassetteAi{mode: ReplayCassetteMode, dir: dir, usage: util.ModelUsage{}}, nil
+}
+
+// Ask records or replays the interaction, according to the Frags interface
+func (c *CassetteAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	request := newCassetteRequest(c.previous, c.systemPrompt, text, sx, tools, rx...)
+	fingerprint, err := request.Fingerprint()
+	if err != nil {
+		return nil, err
+	}
+	var cassette Cassette
+	if c.mode == ReplayCassetteMode {
+		if cassette, err = c.load(fingerprint); err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil, UnmatchedCassetteError{Fingerprint: fingerprint, Prompt: text}
+			}
+			return nil, err
+		}
+	} else {
+		if cassette, err = c.record(ctx, fingerprint, request, runner, rx...); err != nil {
+			return nil, err
+		}
+	}
+	c.previous = fingerprint
+	c.usage = c.usage.Add(cassette.Usage)
+	return []byte(cassette.Response), nil
+}
+
+// record asks the real AI and saves the interaction
+func (c *CassetteAi) record(ctx *util.FragsContext, fingerprint string, request CassetteRequest,
+	runner ExportableRunner, rx ...resources.ResourceData) (Cassette, error) {
+	recorder := &recordingRunner{ExportableRunner: runner}
+	var before util.ModelUsage
+	tracker, isTracker := c.ai.(UsageTracker)
+	if isTracker {
+		before = tracker.Usage()
+	}
+	data, err := c.ai.Ask(ctx, request.Prompt, request.Schema, request.Tools, recorder, rx...)
+	if err != nil {
+		// failed interactions are not recorded, as the runner is going to retry them
+		return Cassette{}, err
+	}
+	cassette := Cassette{
+		Fingerprint: fingerprint,
+		Request:     request,
+		Response:    string(data),
+		ToolCalls:   recorder.calls,
+	}
+	if isTracker {
+		cassette.Usage = tracker.Usage().Sub(before)
+	}
+	out, err := json.MarshalIndent(cassette, "", "  ")
+	if err != nil {
+		return cassette, err
+	}
+	return cassette, os.WriteFile(filepath.Join(c.dir, fingerprint+".json"), out, 0o644)
+}
+
+// load loads the cassette with the given fingerprint
+func (c *CassetteAi) load(fingerprint string) (Cassette, error) {
+	cassette := Cassette{}
+	data, err := os.ReadFile(filepath.Join(c.dir, fingerprint+".json"))
+	if err != nil {
+		return cassette, err
+	}
+	return cassette, json.Unmarshal(data, &cassette)
+}
+
+// New creates a new CassetteAi, starting a new conversation
+func (c *CassetteAi) New() Ai {
+	var ai Ai
+	if c.ai != nil {
+		ai = c.ai.New()
+	}
+	return &CassetteAi{
+		ai:           ai,
+		mode:         c.mode,
+		dir:          c.dir,
+		systemPrompt: c.systemPrompt,
+		functions:    c.functions,
+		usage:        util.ModelUsage{},
+	}
+}
+
+func (c *CassetteAi) SetFunctions(functions ExternalFunctions) {
+	c.functions = functions
+	if c.ai != nil {
+		c.ai.SetFunctions(functions)
+	}
+}
+
+func (c *CassetteAi) SetSystemPrompt(systemPrompt string) {
+	c.systemPrompt = systemPrompt
+	if c.ai != nil {
+		c.ai.SetSystemPrompt(systemPrompt)
+	}
+}
+
+func (c *CassetteAi) RunFunction(ctx *util.FragsContext, functionCall FunctionCaller, runner ExportableRunner) (any, error) {
+	if c.ai != nil {
+		return c.ai.RunFunction(ctx, functionCall, runner)
+	}
+	return runner.RunFunction(ctx, functionCall.Name, functionCall.Args)
+}
+
+// Usage returns the tokens used by this instance, as recorded. In replay mode, no token is actually spent, but
+// reporting the recorded usage keeps budgets and cost estimates testable.
+func (c *CassetteAi) Usage() util.ModelUsage {
+	return c.usage
+}
+
+// Engine returns the engine of the recorded AI that answered the last interaction, if it's an EngineReporter. In
+// replay mode, there's no AI to report.
+func (c *CassetteAi) Engine() string {
+	if reporter, ok := c.ai.(EngineReporter); ok {
+		return reporter.Engine()
+	}
+	return ""
+}
+
+// newCassetteRequest creates the request for an interaction. Resources are identified by the hash of their content.
+func newCassetteRequest(previous string, systemPrompt string, text string, sx *schema.Schema, tools ToolDefinitions,
+	rx ...resources.ResourceData) CassetteRequest {
+	request := CassetteRequest{
+		Previous:     previous,
+		SystemPrompt: systemPrompt,
+		Prompt:       text,
+		Schema:       sx,
+		Tools:        tools,
+	}
+	for _, r := range rx {
+		hash := sha256.Sum256(r.ByteContent)
+		request.Resources = append(request.Resources, CassetteResource{
+			Identifier: r.Identifier,
+			MediaType:  r.MediaType,
+			Hash:       hex.EncodeToString(hash[:]),
+		})
+	}
+	return request
+}
+
+// Fingerprint returns the hash that identifies the request
+func (r CassetteRequest) Fingerprint() (string, error) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(data)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+// recordingRunner intercepts the functions the AI calls, so they can be recorded
+type recordingRunner struct {
+	ExportableRunner
+	calls []CassetteCall
+	mutex sync.Mutex
+}
+
+func (r *recordingRunner) RunFunction(ctx *util.FragsContext, name string, args map[string]any) (any, error) {
+	res, err := r.ExportableRunner.RunFunction(ctx, name, args)
+	call := CassetteCall{Name: name, Args: args, Result: res}
+	if err != nil {
+		call.Err = err.Error()
+	}
+	r.mutex.Lock()
+	r.calls = append(r.calls, call)
+	r.mutex.Unlock()
+	return res, err
+}
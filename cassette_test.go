@@ -0,0 +1,106 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// toolCallingAi calls a function before answering, as a real AI would
+type toolCallingAi struct {
+	DummyAi
+}
+
+func (a *toolCallingAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	if _, err := runner.RunFunction(ctx, "f1", map[string]any{"text": text}); err != nil {
+		return nil, err
+	}
+	return a.DummyAi.Ask(ctx, text, sx, tools, runner, rx...)
+}
+
+func (a *toolCallingAi) New() Ai {
+	return &toolCallingAi{}
+}
+
+func TestCassetteAi(t *testing.T) {
+	plan := `
+sessions:
+  one:
+    prePrompt: think about cats
+    prompt: describe a cat
+schema:
+  properties:
+    p1:
+      type: string
+      x-session: one
+`
+	functions := ExternalFunctions{"f1": {Name: "f1", Func: func(ctx *util.FragsContext, data map[string]any) (any, error) {
+		return "meow", nil
+	}}}
+	dir := t.TempDir()
+
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(plan)))
+	recorder, err := NewRecordingAi(&toolCallingAi{}, dir)
+	assert.NoError(t, err)
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), recorder, WithExternalFunctions(functions))
+	recorded, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	recordedUsage := runner.Usage().Total
+	assert.NoError(t, err)
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	assert.Len(t, files, 2)
+	data, _ := os.ReadFile(files[0])
+	assert.Contains(t, string(data), `"result": "meow"`)
+
+	t.Run("replay", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(plan)))
+		replayer, err := NewReplayingAi(dir)
+		assert.NoError(t, err)
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), replayer)
+		start := time.Now()
+		replayed, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, recorded, replayed)
+		assert.False(t, recordedUsage.IsZero())
+		assert.Equal(t, recordedUsage, runner.Usage().Total)
+		// the dummy AI takes a second per interaction, the cassettes don't
+		assert.Less(t, time.Since(start), time.Second)
+	})
+	t.Run("unmatched requests fail", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(strings.Replace(plan, "describe a cat", "describe a dog", 1))))
+		replayer, _ := NewReplayingAi(dir)
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), replayer)
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		unmatchedErr := UnmatchedCassetteError{}
+		assert.True(t, errors.As(err, &unmatchedErr))
+		assert.Equal(t, "describe a dog", unmatchedErr.Prompt)
+	})
+}
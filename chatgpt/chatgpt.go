@@ -48,6 +48,7 @@ type Ai struct {
 	Functions    frags.ExternalFunctions
 	files        map[string]string
 	uploadMutex  *sync.Mutex
+	usage        util.Usage
 }
 type Config struct {
 	Model         string        `yaml:"model" json:"model"`
@@ -132,6 +133,22 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 
 		}
 	}
+	var responseSchema map[string]any
+	strict := true
+	if sx != nil {
+		downleveled, err := frags.DownlevelSchema(runner, engine, sx, schema.OpenAIDialect)
+		if err != nil {
+			return nil, err
+		}
+		// strict mode would force the maps of the schema to be empty, so we give up on it
+		if strict = downleveled.IsStrict(); !strict {
+			runner.Logger().Info(log.NewEvent(log.GenericEventType, log.AiComponent).WithEngine(engine).
+				WithMessage("the schema has maps, asking for a non-strict structured output"))
+		}
+		if responseSchema, err = schema.OpenAIDialect.Render(downleveled); err != nil {
+			return nil, err
+		}
+	}
 	d.content = append(d.content, msg)
 	keepGoing := true
 	out := ""
@@ -143,7 +160,7 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		}
 
 		runner.Logger().Debug(log.NewEvent(log.StartEventType, log.AiComponent).WithMessage("generating content").WithContent(d.content[len(d.content)-1]).WithEngine(engine))
-		req := NewResponseRequest(d.config.Model, d.content, d.systemPrompt, chatGptTools, sx)
+		req := NewResponseRequest(d.config.Model, d.content, d.systemPrompt, chatGptTools, responseSchema, strict)
 		if d.config.ThinkingLevel != nil {
 			req.Reasoning = &ReasoningConfig{
 				Effort: *d.config.ThinkingLevel,
@@ -174,6 +191,12 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		}); err != nil {
 			return nil, err
 		}
+		d.usage = d.usage.Add(util.Usage{
+			Input:     response.Usage.InputTokens,
+			Output:    response.Usage.OutputTokens,
+			Cached:    response.Usage.InputTokensDetails.CachedTokens,
+			Reasoning: response.Usage.OutputTokensDetails.ReasoningTokens,
+		})
 
 		for _, item := range response.Output {
 			d.content = append(d.content, item)
@@ -193,6 +216,16 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		}
 
 	}
+	if sx != nil && err == nil {
+		// strict mode makes every property required, so the optional ones come back as nulls the original schema
+		// may not allow
+		var value any
+		if json.Unmarshal([]byte(out), &value) == nil {
+			if pruned, marshalErr := json.Marshal(sx.PruneNulls(value)); marshalErr == nil {
+				return pruned, nil
+			}
+		}
+	}
 	return []byte(out), err
 }
 
@@ -276,3 +309,8 @@ func (d *Ai) handleFunctionCalls(ctx *util.FragsContext, responseMessage Respons
 func (d *Ai) RunFunction(ctx *util.FragsContext, functionCall frags.FunctionCaller, runner frags.ExportableRunner) (any, error) {
 	return runner.RunFunction(ctx, functionCall.Name, functionCall.Args)
 }
+
+// Usage returns the tokens used by this instance, according to the frags.UsageTracker interface
+func (d *Ai) Usage() util.ModelUsage {
+	return util.ModelUsage{d.config.Model: d.usage}
+}
@@ -20,8 +20,6 @@ package chatgpt
 import (
 	"bytes"
 	"encoding/json"
-
-	"github.com/theirish81/frags/schema"
 )
 
 const PartTypeInputText = "input_text"
@@ -52,7 +50,10 @@ type ResponseRequest struct {
 	Reasoning          *ReasoningConfig `json:"reasoning,omitempty"`
 }
 
-func NewResponseRequest(model string, input []Message, instructions string, tools []ChatGptTool, schema *schema.Schema) ResponseRequest {
+// NewResponseRequest creates a new request for the Responses API. The schema, if any, is expected to be already
+// downleveled to the strict mode dialect. Strict must be false if the schema has maps, which strict mode can't express.
+func NewResponseRequest(model string, input []Message, instructions string, tools []ChatGptTool, schema map[string]any,
+	strict bool) ResponseRequest {
 	req := ResponseRequest{
 		Model:        model,
 		Input:        input,
@@ -64,6 +65,7 @@ func NewResponseRequest(model string, input []Message, instructions string, tool
 			Format: &ResponseFormat{
 				Name:   "response",
 				Type:   PartTypeJsonSchema,
+				Strict: strict,
 				Schema: schema,
 			},
 		}
@@ -224,6 +226,19 @@ type Response struct {
 	Model      string   `json:"model"`
 	Output     Messages `json:"output"`
 	OutputText string   `json:"output_text,omitempty"`
+	Usage      Usage    `json:"usage"`
+}
+
+// Usage represents the token usage reported by the Responses API
+type Usage struct {
+	InputTokens        int64 `json:"input_tokens"`
+	OutputTokens       int64 `json:"output_tokens"`
+	InputTokensDetails struct {
+		CachedTokens int64 `json:"cached_tokens"`
+	} `json:"input_tokens_details"`
+	OutputTokensDetails struct {
+		ReasoningTokens int64 `json:"reasoning_tokens"`
+	} `json:"output_tokens_details"`
 }
 
 func (r Response) HasFunctionCalls() bool {
@@ -0,0 +1,136 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"context"
+	"encoding/json"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/theirish81/frags/checkpoints"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/util"
+)
+
+// initCheckpoint prepares the checkpoint of the current run. If a checkpoint to resume from is provided, the
+// runner state (statuses, data structure, vars) is restored from it.
+func (r *Runner) initCheckpoint(checkpoint *checkpoints.Checkpoint) {
+	r.checkpointMutex.Lock()
+	defer r.checkpointMutex.Unlock()
+	if checkpoint == nil {
+		id := r.checkpointID
+		if id == "" {
+			id = uuid.NewString()
+		}
+		r.checkpoint = checkpoints.NewCheckpoint(id)
+		r.checkpoint.Params = r.params
+		return
+	}
+	r.checkpoint = checkpoint
+	if r.checkpoint.Iterations == nil {
+		r.checkpoint.Iterations = make(map[string][]int)
+	}
+	// only finished sessions are considered done. Everything else (failed, noop, or interrupted while running) goes
+	// back in the queue, as its dependencies will be re-evaluated.
+	for k := range r.sessionManager.Sessions.Iter() {
+		if SessionStatus(checkpoint.Status[k]) == FinishedSessionStatus {
+			r.SetStatus(k, FinishedSessionStatus)
+		} else {
+			r.SetStatus(k, QueuedSessionStatus)
+		}
+	}
+	if checkpoint.Data != nil {
+		r.dataStructure = util.ProgMap(checkpoint.Data)
+	}
+	r.vars.Apply(checkpoint.Vars)
+	r.logger.Info(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage("resuming from checkpoint").
+		WithArg("checkpoint", checkpoint.ID))
+}
+
+// Checkpoint returns the checkpoint of the current (or last) run. It returns nil if the runner has never run.
+func (r *Runner) Checkpoint() *checkpoints.Checkpoint {
+	r.checkpointMutex.Lock()
+	defer r.checkpointMutex.Unlock()
+	return r.checkpoint
+}
+
+// iterationCompleted returns true if the checkpoint reports the iteration of the session as completed.
+func (r *Runner) iterationCompleted(sessionID string, iteration int) bool {
+	r.checkpointMutex.Lock()
+	defer r.checkpointMutex.Unlock()
+	return r.checkpoint.IterationCompleted(sessionID, iteration)
+}
+
+// completeIteration marks the iteration of the session as completed and saves the checkpoint.
+func (r *Runner) completeIteration(ctx context.Context, sessionID string, iteration int) {
+	r.updateState(sessionID, func(s *SessionState) {
+		s.CompletedIterations++
+	})
+	r.checkpointMutex.Lock()
+	if r.checkpoint != nil && !slices.Contains(r.checkpoint.Iterations[sessionID], iteration) {
+		r.checkpoint.Iterations[sessionID] = append(r.checkpoint.Iterations[sessionID], iteration)
+	}
+	r.checkpointMutex.Unlock()
+	r.saveCheckpoint(ctx)
+}
+
+// saveCheckpoint snapshots the runner state into the checkpoint and persists it to the checkpoint store, if any.
+// Failing to save a checkpoint is not fatal to the run, so errors are just logged. Dry runs produce no checkpoints.
+func (r *Runner) saveCheckpoint(ctx context.Context) {
+	if r.checkpointStore == nil || r.dryRun {
+		return
+	}
+	r.checkpointMutex.Lock()
+	defer r.checkpointMutex.Unlock()
+	if r.checkpoint == nil {
+		return
+	}
+	status := make(map[string]string)
+	for k, v := range r.status.Iter() {
+		status[k] = string(v)
+	}
+	// the data structure is serialized and deserialized so the checkpoint doesn't share memory with a data
+	// structure that workers keep on modifying
+	dataBytes, err := r.safeMarshalDataStructure(false)
+	if err != nil {
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("failed to save checkpoint").
+			WithErr(err))
+		return
+	}
+	data := make(map[string]any)
+	if err := json.Unmarshal(dataBytes, &data); err != nil {
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("failed to save checkpoint").
+			WithErr(err))
+		return
+	}
+	r.checkpoint.Status = status
+	r.checkpoint.Data = data
+	r.checkpoint.Vars = maps.Clone(r.vars)
+	r.checkpoint.UpdatedAt = time.Now()
+	// the checkpoint is most valuable when the run is dying, so we don't want a cancelled context to prevent saving
+	if err := r.checkpointStore.Save(context.WithoutCancel(ctx), *r.checkpoint); err != nil {
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("failed to save checkpoint").
+			WithErr(err))
+		return
+	}
+	r.logger.Debug(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage("checkpoint saved").
+		WithArg("checkpoint", r.checkpoint.ID))
+}
@@ -0,0 +1,83 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package checkpoints
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"time"
+)
+
+// ErrCheckpointNotFound is returned by a Store when the requested checkpoint does not exist.
+var ErrCheckpointNotFound = errors.New("checkpoint not found")
+
+// Checkpoint is a serializable snapshot of a plan run. It carries everything a runner needs to pick up where a
+// previous, interrupted, run left off.
+type Checkpoint struct {
+	// ID is the unique identifier of the run this checkpoint belongs to.
+	ID string `json:"id" yaml:"id"`
+	// CreatedAt is the point in time when the run started.
+	CreatedAt time.Time `json:"createdAt" yaml:"createdAt"`
+	// UpdatedAt is the point in time when the checkpoint was last saved.
+	UpdatedAt time.Time `json:"updatedAt" yaml:"updatedAt"`
+	// Params are the input parameters of the run.
+	Params any `json:"params,omitempty" yaml:"params,omitempty"`
+	// Status maps each session ID to its status at the time of the checkpoint.
+	Status map[string]string `json:"status" yaml:"status"`
+	// Data is the merged output of all the sessions that have produced data so far.
+	Data map[string]any `json:"data" yaml:"data"`
+	// Vars are the runner vars at the time of the checkpoint.
+	Vars map[string]any `json:"vars,omitempty" yaml:"vars,omitempty"`
+	// Iterations maps each session ID to the indexes of the iterations that have completed so far. It is used to
+	// resume sessions with an iterateOn that were interrupted halfway.
+	Iterations map[string][]int `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+}
+
+// NewCheckpoint creates a new, empty, checkpoint with the given ID.
+func NewCheckpoint(id string) *Checkpoint {
+	now := time.Now()
+	return &Checkpoint{
+		ID:         id,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		Status:     make(map[string]string),
+		Data:       make(map[string]any),
+		Vars:       make(map[string]any),
+		Iterations: make(map[string][]int),
+	}
+}
+
+// IterationCompleted returns true if the iteration of the given session has already completed.
+func (c *Checkpoint) IterationCompleted(sessionID string, iteration int) bool {
+	if c == nil || c.Iterations == nil {
+		return false
+	}
+	return slices.Contains(c.Iterations[sessionID], iteration)
+}
+
+// Store defines the interface for persisting and retrieving checkpoints.
+// Implementations handle the storage details (e.g., filesystem, database).
+type Store interface {
+	// Save persists the checkpoint, replacing any previous version with the same ID.
+	Save(ctx context.Context, checkpoint Checkpoint) error
+	// Load retrieves the checkpoint with the given ID. It returns ErrCheckpointNotFound if no such checkpoint exists.
+	Load(ctx context.Context, id string) (*Checkpoint, error)
+	// Delete removes the checkpoint with the given ID. Deleting a checkpoint that doesn't exist is not an error.
+	Delete(ctx context.Context, id string) error
+}
@@ -0,0 +1,68 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package checkpoints
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func testStore(t *testing.T, store Store) {
+	checkpoint := NewCheckpoint("abc")
+	checkpoint.Status["s1"] = "finished"
+	checkpoint.Data["p1"] = "foo"
+	checkpoint.Iterations["s2"] = []int{0, 1}
+
+	_, err := store.Load(t.Context(), "abc")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+
+	assert.NoError(t, store.Save(t.Context(), *checkpoint))
+	loaded, err := store.Load(t.Context(), "abc")
+	assert.NoError(t, err)
+	assert.Equal(t, "finished", loaded.Status["s1"])
+	assert.Equal(t, "foo", loaded.Data["p1"])
+	assert.True(t, loaded.IterationCompleted("s2", 1))
+	assert.False(t, loaded.IterationCompleted("s2", 2))
+
+	checkpoint.Status["s1"] = "failed"
+	assert.NoError(t, store.Save(t.Context(), *checkpoint))
+	loaded, _ = store.Load(t.Context(), "abc")
+	assert.Equal(t, "failed", loaded.Status["s1"])
+
+	assert.NoError(t, store.Delete(t.Context(), "abc"))
+	_, err = store.Load(t.Context(), "abc")
+	assert.ErrorIs(t, err, ErrCheckpointNotFound)
+}
+
+func TestFileStore(t *testing.T) {
+	store, err := NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+	testStore(t, store)
+	assert.Error(t, store.Save(t.Context(), Checkpoint{ID: "../escape"}))
+}
+
+func TestSQLiteStore(t *testing.T) {
+	store, err := NewSQLiteStore(t.Context(), filepath.Join(t.TempDir(), "checkpoints.db"))
+	assert.NoError(t, err)
+	defer func() {
+		_ = store.Close()
+	}()
+	testStore(t, store)
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package checkpoints
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// FileStore implements Store using one JSON file per checkpoint in a directory of the local filesystem.
+type FileStore struct {
+	dir string
+	mx  sync.Mutex
+}
+
+// NewFileStore creates a new FileStore. The directory is created if it doesn't exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Path returns the path of the file holding the checkpoint with the given ID.
+func (s *FileStore) Path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+// Save writes the checkpoint to its file. The file is first written to a temporary location and then renamed, so
+// a crash while saving never leaves a truncated checkpoint behind.
+func (s *FileStore) Save(_ context.Context, checkpoint Checkpoint) error {
+	if err := validateID(checkpoint.ID); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	data, err := json.MarshalIndent(checkpoint, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.Path(checkpoint.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path(checkpoint.ID))
+}
+
+// Load reads the checkpoint with the given ID from its file.
+func (s *FileStore) Load(_ context.Context, id string) (*Checkpoint, error) {
+	if err := validateID(id); err != nil {
+		return nil, err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	data, err := os.ReadFile(s.Path(id))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, ErrCheckpointNotFound
+		}
+		return nil, err
+	}
+	checkpoint := Checkpoint{}
+	if err := json.Unmarshal(data, &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Delete removes the file of the checkpoint with the given ID.
+func (s *FileStore) Delete(_ context.Context, id string) error {
+	if err := validateID(id); err != nil {
+		return err
+	}
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if err := os.Remove(s.Path(id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// validateID makes sure the ID can safely be used as a file name.
+func validateID(id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || id == "." || id == ".." {
+		return fmt.Errorf("invalid checkpoint ID: %q", id)
+	}
+	return nil
+}
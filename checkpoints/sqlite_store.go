@@ -0,0 +1,91 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package checkpoints
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	_ "modernc.org/sqlite"
+)
+
+// SQLiteStore implements Store using a SQLite database. Checkpoints are stored as JSON documents in a single table.
+type SQLiteStore struct {
+	db *sql.DB
+}
+
+// NewSQLiteStore opens (or creates) the SQLite database at the given path and makes sure the checkpoints table
+// exists.
+func NewSQLiteStore(ctx context.Context, path string) (*SQLiteStore, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite doesn't deal well with concurrent writers, and the runner saves checkpoints from multiple workers
+	db.SetMaxOpenConns(1)
+	if _, err := db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS frags_checkpoints (
+		id TEXT PRIMARY KEY,
+		updated_at TIMESTAMP NOT NULL,
+		data TEXT NOT NULL
+	)`); err != nil {
+		_ = db.Close()
+		return nil, err
+	}
+	return &SQLiteStore{db: db}, nil
+}
+
+// Save upserts the checkpoint.
+func (s *SQLiteStore) Save(ctx context.Context, checkpoint Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `INSERT INTO frags_checkpoints (id, updated_at, data) VALUES (?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET updated_at = excluded.updated_at, data = excluded.data`,
+		checkpoint.ID, checkpoint.UpdatedAt, string(data))
+	return err
+}
+
+// Load retrieves the checkpoint with the given ID.
+func (s *SQLiteStore) Load(ctx context.Context, id string) (*Checkpoint, error) {
+	var data string
+	if err := s.db.QueryRowContext(ctx, `SELECT data FROM frags_checkpoints WHERE id = ?`, id).Scan(&data); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCheckpointNotFound
+		}
+		return nil, err
+	}
+	checkpoint := Checkpoint{}
+	if err := json.Unmarshal([]byte(data), &checkpoint); err != nil {
+		return nil, err
+	}
+	return &checkpoint, nil
+}
+
+// Delete removes the checkpoint with the given ID.
+func (s *SQLiteStore) Delete(ctx context.Context, id string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM frags_checkpoints WHERE id = ?`, id)
+	return err
+}
+
+// Close closes the underlying database.
+func (s *SQLiteStore) Close() error {
+	return s.db.Close()
+}
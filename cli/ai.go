@@ -20,12 +20,15 @@ package main
 import (
 	"context"
 	"errors"
+	"fmt"
 	"os"
+	"sync"
 	"time"
 
 	"cloud.google.com/go/auth/credentials"
 	anthropicSdk "github.com/anthropics/anthropic-sdk-go"
 	"github.com/anthropics/anthropic-sdk-go/option"
+	"github.com/samber/lo"
 	"github.com/theirish81/frags"
 	"github.com/theirish81/frags/anthropic"
 	"github.com/theirish81/frags/chatgpt"
@@ -37,58 +40,138 @@ import (
 
 // initAi initializes the AI engine based on the configuration.
 func initAi() (frags.Ai, error) {
-	switch cfg.guessAi() {
+	engine := cfg.guessAi()
+	if engine == "" {
+		return nil, errors.New("no AI is fully configured. Check your .env file")
+	}
+	return newAiFactory(engine)(frags.AiConfig{Engine: engine})
+}
+
+// initAiFactories builds a factory for each configured engine, so plan sessions can select their own engine and model.
+func initAiFactories() frags.AiFactories {
+	factories := frags.AiFactories{}
+	for _, engine := range cfg.configuredEngines() {
+		factories[engine] = newAiFactory(engine)
+	}
+	return factories
+}
+
+// newAiFactory returns a factory of AIs of the given engine. Settings the session doesn't override are taken from the
+// configuration, and clients are created once and shared by all the AIs of the factory.
+func newAiFactory(engine string) frags.AiFactory {
+	switch engine {
 	case engineDummy:
-		return frags.NewDummyAi(), nil
-	case engineGemini:
-		client, err := newGeminiClient()
-		if err != nil {
-			return nil, err
-		}
-		config := gemini.Config{
-			Temperature: cfg.Temperature,
-			TopK:        cfg.TopK,
-			TopP:        cfg.TopP,
-			Model:       cfg.Model,
-			Attempts:    3,
-			RetryDelay:  3 * time.Second,
+		return func(_ frags.AiConfig) (frags.Ai, error) {
+			return frags.NewDummyAi(), nil
 		}
-		if cfg.ThinkingLevel != "" {
-			config.ThinkingLevel = util.Ptr(genai.ThinkingLevel(cfg.ThinkingLevel))
+	case engineGemini:
+		client := sync.OnceValues(newGeminiClient)
+		return func(aiConfig frags.AiConfig) (frags.Ai, error) {
+			model, err := aiModel(aiConfig)
+			if err != nil {
+				return nil, err
+			}
+			geminiClient, err := client()
+			if err != nil {
+				return nil, err
+			}
+			config := gemini.Config{
+				Temperature: lo.FromPtrOr(aiConfig.Temperature, cfg.Temperature),
+				TopK:        cfg.TopK,
+				TopP:        cfg.TopP,
+				Model:       model,
+				Attempts:    3,
+				RetryDelay:  3 * time.Second,
+			}
+			if thinkingLevel := lo.FromPtrOr(aiConfig.ThinkingLevel, cfg.ThinkingLevel); thinkingLevel != "" {
+				config.ThinkingLevel = util.Ptr(genai.ThinkingLevel(thinkingLevel))
+			}
+			return gemini.NewAI(geminiClient, config), nil
 		}
-
-		return gemini.NewAI(client, config), nil
 	case engineOllama:
-		return ollama.NewAI(cfg.OllamaBaseURL, ollama.Config{
-			Temperature: cfg.Temperature,
-			TopK:        cfg.TopK,
-			TopP:        cfg.TopP,
-			Model:       cfg.Model,
-			NumPredict:  cfg.NumPredict,
-		}), nil
-	case engineChatgpt:
-		gptCfg := chatgpt.Config{
-			Model:      cfg.Model,
-			Attempts:   3,
-			RetryDelay: 3 * time.Second,
+		return func(aiConfig frags.AiConfig) (frags.Ai, error) {
+			model, err := aiModel(aiConfig)
+			if err != nil {
+				return nil, err
+			}
+			return ollama.NewAI(cfg.OllamaBaseURL, ollama.Config{
+				Temperature: lo.FromPtrOr(aiConfig.Temperature, cfg.Temperature),
+				TopK:        cfg.TopK,
+				TopP:        cfg.TopP,
+				Model:       model,
+				NumPredict:  lo.FromPtrOr(aiConfig.MaxTokens, cfg.NumPredict),
+			}), nil
 		}
-		if cfg.ThinkingLevel != "" {
-			gptCfg.ThinkingLevel = util.Ptr(cfg.ThinkingLevel)
+	case engineChatgpt:
+		return func(aiConfig frags.AiConfig) (frags.Ai, error) {
+			model, err := aiModel(aiConfig)
+			if err != nil {
+				return nil, err
+			}
+			gptCfg := chatgpt.Config{
+				Model:      model,
+				Attempts:   3,
+				RetryDelay: 3 * time.Second,
+			}
+			if thinkingLevel := lo.FromPtrOr(aiConfig.ThinkingLevel, cfg.ThinkingLevel); thinkingLevel != "" {
+				gptCfg.ThinkingLevel = util.Ptr(thinkingLevel)
+			}
+			return chatgpt.NewAI(cfg.ChatGptBaseURL, cfg.ChatGptApiKey, gptCfg), nil
 		}
-		return chatgpt.NewAI(cfg.ChatGptBaseURL, cfg.ChatGptApiKey, gptCfg), nil
 	case engineAnthropic:
-		return anthropic.NewAI(newAnthropicClient(), anthropic.Config{
-			Temperature: cfg.Temperature,
-			TopK:        cfg.TopK,
-			TopP:        cfg.TopP,
-			Model:       cfg.Model,
-			MaxTokens:   cfg.NumPredict,
-			Attempts:    3,
-			RetryDelay:  3 * time.Second,
-		}), nil
+		client := sync.OnceValue(newAnthropicClient)
+		return func(aiConfig frags.AiConfig) (frags.Ai, error) {
+			model, err := aiModel(aiConfig)
+			if err != nil {
+				return nil, err
+			}
+			return anthropic.NewAI(client(), anthropic.Config{
+				Temperature: lo.FromPtrOr(aiConfig.Temperature, cfg.Temperature),
+				TopK:        cfg.TopK,
+				TopP:        cfg.TopP,
+				Model:       model,
+				MaxTokens:   lo.FromPtrOr(aiConfig.MaxTokens, cfg.NumPredict),
+				Attempts:    3,
+				RetryDelay:  3 * time.Second,
+			}), nil
+		}
 	default:
-		return nil, errors.New("no AI is fully configured. Check your .env file")
+		return func(_ frags.AiConfig) (frags.Ai, error) {
+			return nil, fmt.Errorf("unsupported AI engine %s", engine)
+		}
+	}
+}
+
+// aiModel returns the model the AI configuration selects. The configured model belongs to the default engine, so the
+// other engines require the session to select one.
+func aiModel(aiConfig frags.AiConfig) (string, error) {
+	if aiConfig.Model != "" {
+		return aiConfig.Model, nil
+	}
+	if aiConfig.Engine != cfg.guessAi() {
+		return "", fmt.Errorf("no model selected for AI engine %s", aiConfig.Engine)
+	}
+	return cfg.Model, nil
+}
+
+// rateLimiters are the rate limiters of the engines, shared by all the runs of the process
+var (
+	rateLimiters      = make(map[string]*frags.RateLimiter)
+	rateLimitersMutex sync.Mutex
+)
+
+// rateLimiter returns the rate limiter of the engine, or nil if no rate limits are configured
+func rateLimiter(engine string) *frags.RateLimiter {
+	limits := cfg.rateLimits()
+	if limits.IsZero() {
+		return nil
+	}
+	rateLimitersMutex.Lock()
+	defer rateLimitersMutex.Unlock()
+	if _, ok := rateLimiters[engine]; !ok {
+		rateLimiters[engine] = frags.NewRateLimiter(limits)
 	}
+	return rateLimiters[engine]
 }
 
 // newGeminiClient constructs a genai client using the configured service account.
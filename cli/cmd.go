@@ -20,8 +20,10 @@ package main
 import (
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/theirish81/frags"
 )
 
 var (
@@ -42,6 +44,10 @@ var (
 	stdio        bool
 	ws           bool
 	tcp          bool
+	budget       frags.Budget
+	maxWallTime  string
+	cachePath    string
+	cacheTTL     time.Duration
 )
 
 var rootCmd = cobra.Command{
@@ -71,4 +77,6 @@ func init() {
 	rootCmd.AddCommand(webCmd)
 	rootCmd.AddCommand(debugCmd)
 	rootCmd.AddCommand(lspCmd)
+	rootCmd.AddCommand(validateCmd)
+	rootCmd.AddCommand(schemaCmd)
 }
@@ -19,16 +19,22 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
+	"strings"
 
 	"github.com/alecthomas/chroma/v2/quick"
 	"github.com/charmbracelet/lipgloss"
+	"github.com/google/uuid"
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/theirish81/frags"
+	"github.com/theirish81/frags/caches"
+	"github.com/theirish81/frags/checkpoints"
 	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
 	"github.com/theirish81/frags/util"
@@ -66,15 +72,39 @@ var runCmd = &cobra.Command{
 			cmd.PrintErrln(err)
 			return
 		}
-		ctx := util.WithFragsContext(cmd.Context(), 15*time.Minute)
+		ctx := util.WithFragsContext(cmd.Context(), runTimeout(sm))
 		defer ctx.Cancel(nil)
 
+		runOptions, err := checkpointOptions(cmd, ctx)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		cacheOptions, err := cacheOptions(ctx)
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
+		runOptions = append(runOptions, cacheOptions...)
+
 		var result util.ProgMap
+		usage := frags.UsageReport{}
+		runOptions = append(runOptions, withUsageReport(&usage), withRunnerOptions(frags.WithBudget(budgetFromFlags())))
+		if recordDir != "" {
+			runOptions = append(runOptions, withCassettes(frags.RecordCassetteMode, recordDir))
+		} else if replayDir != "" {
+			runOptions = append(runOptions, withCassettes(frags.ReplayCassetteMode, replayDir))
+		}
+		dryRunCalls := make([]frags.DryRunCall, 0)
+		if dryRun {
+			runOptions = append(runOptions, withDryRun(&dryRunCalls),
+				withRunnerOptions(frags.WithStubbedPreCalls(stubPreCalls)))
+		}
 
 		useInteractive := !plain && !debug && isatty.IsTerminal(os.Stderr.Fd())
 
 		if useInteractive {
-			result, err = runWithBubbleTea(ctx, sm, paramsMap, toolsConfig, args)
+			result, err = runWithBubbleTea(ctx, sm, paramsMap, toolsConfig, args, runOptions...)
 		} else {
 			var streamerLogger *log.StreamerLogger
 			if debug {
@@ -85,15 +115,28 @@ var runCmd = &cobra.Command{
 				streamerLogger = log.NewStreamerLogger(slog.Default(), nil, log.InfoChannelLevel)
 			}
 			result, err = execute(ctx, sm, paramsMap, toolsConfig,
-				resources.NewFileResourceLoader(filepath.Dir(args[0])), streamerLogger)
+				resources.NewFileResourceLoader(filepath.Dir(args[0])), streamerLogger, runOptions...)
+		}
+		if !usage.Total.IsZero() {
+			cmd.PrintErrln(formatUsage(usage))
 		}
 		if err != nil {
 			cmd.PrintErrln(err)
-			return
+			// when sessions fail with a policy that lets the run proceed, the output of the others is still worth
+			// rendering. If the run was cancelled instead (a session with the fail policy, a budget, a signal), the run
+			// failed as a whole and there's no output to render, so scripts can tell it apart from a successful run
+			failedErr := util.SessionsFailedError{}
+			if !errors.As(err, &failedErr) || result == nil || ctx.Err() != nil {
+				return
+			}
 		}
 
-		// render output according to the chosen format
-		text, err := renderResult(result)
+		// render output according to the chosen format. Dry runs output what the AI would have received instead
+		var out any = result
+		if dryRun {
+			out = dryRunCalls
+		}
+		text, err := renderResult(out)
 		if err != nil {
 			cmd.PrintErrln(err)
 			return
@@ -119,6 +162,12 @@ var runCmd = &cobra.Command{
 }
 
 var plain bool
+var checkpointPath string
+var resumeCheckpoint string
+var dryRun bool
+var stubPreCalls bool
+var recordDir string
+var replayDir string
 
 func init() {
 	runCmd.Flags().StringVarP(&format, "format", "f", formatYAML, "output format (yaml, json or template)")
@@ -127,6 +176,83 @@ func init() {
 	runCmd.Flags().StringSliceVarP(&params, "param", "p", nil, "a parameter to pass to the plan (can be specified multiple times)")
 	runCmd.Flags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
 	runCmd.Flags().BoolVar(&plain, "plain", false, "enable plain output mode (use standard logger)")
+	runCmd.Flags().StringVar(&checkpointPath, "checkpoint", "", "save checkpoints to this directory, or SQLite database if the path ends with .db")
+	runCmd.Flags().StringVar(&resumeCheckpoint, "resume", "", "resume the run from a checkpoint ID, or the path to a checkpoint file")
+	runCmd.Flags().Int64Var(&budget.MaxTokens, "max-tokens", 0, "maximum number of tokens the run can use")
+	runCmd.Flags().Float64Var(&budget.MaxCost, "max-cost", 0, "maximum estimated cost of the run (requires PRICE_TABLE_PATH)")
+	runCmd.Flags().IntVar(&budget.MaxToolCalls, "max-tool-calls", 0, "maximum number of function calls the run can make")
+	runCmd.Flags().StringVar(&maxWallTime, "max-wall-time", "", "maximum duration of the run (e.g. 10m)")
+	runCmd.Flags().BoolVar(&dryRun, "dry-run", false, "render the prompts without calling the AI, and print what it would have received")
+	runCmd.Flags().BoolVar(&stubPreCalls, "stub-pre-calls", false, "with --dry-run, do not run the preCalls and postCalls functions")
+	runCmd.Flags().StringVar(&recordDir, "record", "", "record the AI interactions to cassettes in this directory")
+	runCmd.Flags().StringVar(&replayDir, "replay", "", "replay the AI interactions from the cassettes in this directory, without calling the AI")
+	runCmd.MarkFlagsMutuallyExclusive("record", "replay")
+	runCmd.Flags().StringVar(&cachePath, "cache", "", "cache the AI responses in this directory, or SQLite database if the path ends with .db")
+	runCmd.Flags().DurationVar(&cacheTTL, "cache-ttl", 0, "how long cached responses are valid (e.g. 24h). Zero means forever")
+}
+
+// checkpointOptions returns the execution options to save checkpoints and, if requested, resume from one.
+func checkpointOptions(cmd *cobra.Command, ctx context.Context) ([]executeOption, error) {
+	if checkpointPath == "" && resumeCheckpoint == "" {
+		return nil, nil
+	}
+	storePath := checkpointPath
+	checkpointID := resumeCheckpoint
+	// when no store is specified, --resume needs to point straight to a checkpoint file, and its directory
+	// becomes the store
+	if storePath == "" {
+		if !strings.HasSuffix(resumeCheckpoint, ".json") {
+			return nil, errors.New("--resume requires --checkpoint, unless it points to a checkpoint file")
+		}
+		storePath = filepath.Dir(resumeCheckpoint)
+		checkpointID = strings.TrimSuffix(filepath.Base(resumeCheckpoint), ".json")
+	}
+	store, err := openCheckpointStore(ctx, storePath)
+	if err != nil {
+		return nil, err
+	}
+	if checkpointID == "" {
+		checkpointID = uuid.NewString()
+		cmd.PrintErrf("checkpoint ID: %s\n", checkpointID)
+		return []executeOption{withRunnerOptions(frags.WithCheckpointStore(store), frags.WithCheckpointID(checkpointID))}, nil
+	}
+	checkpoint, err := store.Load(ctx, checkpointID)
+	if err != nil {
+		return nil, fmt.Errorf("cannot load checkpoint %s: %w", checkpointID, err)
+	}
+	return []executeOption{withRunnerOptions(frags.WithCheckpointStore(store)), withResume(checkpoint)}, nil
+}
+
+// openCheckpointStore opens a SQLite checkpoint store if the path has a .db extension, or a file store otherwise
+func openCheckpointStore(ctx context.Context, path string) (checkpoints.Store, error) {
+	if filepath.Ext(path) == ".db" {
+		return checkpoints.NewSQLiteStore(ctx, path)
+	}
+	return checkpoints.NewFileStore(path)
+}
+
+// cacheOptions returns the execution options to cache the AI responses, if requested
+func cacheOptions(ctx context.Context) ([]executeOption, error) {
+	if cachePath == "" {
+		return nil, nil
+	}
+	store, err := openCacheStore(ctx, cachePath)
+	if err != nil {
+		return nil, err
+	}
+	return []executeOption{withCache(store, cacheTTL)}, nil
+}
+
+// openCacheStore opens an in-memory cache store if the path is "memory", a SQLite cache store if the path has a .db
+// extension, or a file store otherwise
+func openCacheStore(ctx context.Context, path string) (caches.Store, error) {
+	if path == "memory" {
+		return caches.NewMemoryStore(), nil
+	}
+	if filepath.Ext(path) == ".db" {
+		return caches.NewSQLiteStore(ctx, path)
+	}
+	return caches.NewFileStore(path)
 }
 
 // validateRunArgs checks basic flag constraints and file existence.
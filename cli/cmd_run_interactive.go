@@ -40,23 +40,21 @@ type runResult struct {
 	err    error
 }
 
-type sessionState struct {
-	lastActivity string
-	component    string
-	startTime    time.Time
-}
+// stateTickMsg is the message to refresh the state of the run
+type stateTickMsg struct{}
 
 type model struct {
-	spinner        spinner.Model
-	eventChan      chan log.Event
-	resChan        chan runResult
-	events         []log.Event
-	activeSessions map[string]sessionState
-	done           bool
-	result         util.ProgMap
-	err            error
-	width          int
-	height         int
+	spinner   spinner.Model
+	eventChan chan log.Event
+	resChan   chan runResult
+	events    []log.Event
+	handle    *runHandle
+	state     frags.RunnerState
+	done      bool
+	result    util.ProgMap
+	err       error
+	width     int
+	height    int
 }
 
 func (m model) Init() tea.Cmd {
@@ -64,9 +62,17 @@ func (m model) Init() tea.Cmd {
 		m.spinner.Tick,
 		listenEvents(m.eventChan),
 		listenResult(m.resChan),
+		tickState(),
 	)
 }
 
+// tickState schedules the next refresh of the state of the run
+func tickState() tea.Cmd {
+	return tea.Tick(500*time.Millisecond, func(time.Time) tea.Msg {
+		return stateTickMsg{}
+	})
+}
+
 func listenEvents(ch chan log.Event) tea.Cmd {
 	return func() tea.Msg {
 		ev, ok := <-ch
@@ -95,7 +101,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.done = true
 			m.err = fmt.Errorf("interrupted by user")
 			return m, tea.Quit
+		case "p":
+			if runner := m.handle.getRunner(); runner != nil {
+				if runner.State().Paused {
+					runner.ResumeDispatch()
+				} else {
+					runner.PauseDispatch()
+				}
+				m.state = m.handle.state()
+			}
+			return m, nil
+		}
+
+	case stateTickMsg:
+		m.state = m.handle.state()
+		if m.done {
+			return m, nil
 		}
+		return m, tickState()
 
 	case tea.WindowSizeMsg:
 		m.width = msg.Width
@@ -112,30 +135,13 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if len(m.events) > 8 {
 			m.events = m.events[1:]
 		}
-
-		if msg.Session != nil {
-			sessID := *msg.Session
-			if msg.Component == log.SessionComponent && msg.Type == log.EndEventType {
-				delete(m.activeSessions, sessID)
-			} else {
-				state := m.activeSessions[sessID]
-				if msg.Message != "" {
-					state.lastActivity = msg.Message
-				}
-				state.component = string(msg.Component)
-				if state.startTime.IsZero() {
-					state.startTime = msg.Time
-				}
-				m.activeSessions[sessID] = state
-			}
-		}
-
 		return m, listenEvents(m.eventChan)
 
 	case runResult:
 		m.done = true
 		m.result = msg.result
 		m.err = msg.err
+		m.state = m.handle.state()
 		return m, tea.Quit
 	}
 
@@ -208,6 +214,9 @@ func formatEventLine(ev log.Event) string {
 	if ev.Iteration != nil {
 		details = append(details, fmt.Sprintf("iter=%d", *ev.Iteration))
 	}
+	if ev.Round != nil {
+		details = append(details, fmt.Sprintf("round=%d", *ev.Round))
+	}
 	if ev.Phase != nil {
 		details = append(details, fmt.Sprintf("phase=%d", *ev.Phase))
 	}
@@ -272,15 +281,22 @@ func (m model) View() string {
 	}
 	divider := StyleDivider.Render(strings.Repeat("─", dividerWidth))
 
-	if len(m.activeSessions) > 0 {
-		s.WriteString(StyleActiveSessionsHeader.Render("Active Sessions:") + "\n")
-		for id, state := range m.activeSessions {
+	if len(m.state.Sessions) > 0 {
+		s.WriteString(StyleActiveSessionsHeader.Render("Sessions: ") + StyleSessionText.Render(formatStatusCounts(m.state)))
+		if m.state.Paused {
+			s.WriteString(StyleSessionComp.Render(" (paused)"))
+		}
+		s.WriteString("\n")
+		for _, state := range m.state.Sessions {
+			if state.Status != frags.RunningSessionStatus {
+				continue
+			}
 			sessIcon := StyleSessionIcon.Render("●")
 			line := fmt.Sprintf("  %s %s [%s]: %s",
 				sessIcon,
-				StyleSessionID.Render(id),
-				StyleSessionComp.Render(state.component),
-				StyleSessionText.Render(state.lastActivity))
+				StyleSessionID.Render(state.ID),
+				StyleSessionComp.Render(string(state.Status)),
+				StyleSessionText.Render(formatSessionProgress(state)))
 			if m.width > 0 {
 				line = lipgloss.NewStyle().Width(m.width - 2).Render(line)
 			}
@@ -313,13 +329,48 @@ func (m model) View() string {
 			s.WriteString(StyleFooterSuccess.Render("Plan execution completed.") + "\n")
 		}
 	} else {
-		s.WriteString(StyleFooterDefault.Render("Press 'q' or 'Ctrl+C' to cancel") + "\n")
+		s.WriteString(StyleFooterDefault.Render("Press 'p' to pause or resume starting sessions, 'q' or 'Ctrl+C' to cancel") + "\n")
 	}
 
 	return s.String()
 }
 
-func runWithBubbleTea(ctx *util.FragsContext, sm frags.SessionManager, paramsMap map[string]any, toolConfig ExtendedToolsConfig, args []string) (util.ProgMap, error) {
+// formatStatusCounts returns the number of sessions in each status, in order of progress
+func formatStatusCounts(state frags.RunnerState) string {
+	counts := make(map[frags.SessionStatus]int)
+	for _, s := range state.Sessions {
+		counts[s.Status]++
+	}
+	parts := make([]string, 0)
+	for _, status := range []frags.SessionStatus{frags.QueuedSessionStatus, frags.CommittedSessionStatus,
+		frags.RunningSessionStatus, frags.FinishedSessionStatus, frags.FallbackSessionStatus,
+		frags.FailedSessionStatus, frags.NoOpSessionStatus} {
+		if counts[status] > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", counts[status], status))
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// formatSessionProgress returns a description of the progress of a running session
+func formatSessionProgress(state frags.SessionState) string {
+	parts := make([]string, 0)
+	if state.Iterations > 1 {
+		parts = append(parts, fmt.Sprintf("iteration %d/%d", state.CompletedIterations, state.Iterations))
+	}
+	if state.Round != nil && *state.Round > 0 {
+		parts = append(parts, fmt.Sprintf("round %d", *state.Round+1))
+	}
+	if state.Attempts > 1 {
+		parts = append(parts, fmt.Sprintf("%d attempts", state.Attempts))
+	}
+	if state.StartedAt != nil {
+		parts = append(parts, "running for "+time.Since(*state.StartedAt).Truncate(time.Second).String())
+	}
+	return strings.Join(parts, ", ")
+}
+
+func runWithBubbleTea(ctx *util.FragsContext, sm frags.SessionManager, paramsMap map[string]any, toolConfig ExtendedToolsConfig, args []string, options ...executeOption) (util.ProgMap, error) {
 	eventChan := make(chan log.Event, 200)
 	resChan := make(chan runResult, 1)
 
@@ -330,10 +381,12 @@ func runWithBubbleTea(ctx *util.FragsContext, sm frags.SessionManager, paramsMap
 	}
 	streamerLogger := log.NewStreamerLogger(discardLogger, eventChan, channelLevel)
 
+	handle := &runHandle{ctx: ctx}
 	go func() {
 		defer close(eventChan)
 		result, err := execute(ctx, sm, paramsMap, toolConfig,
-			resources.NewFileResourceLoader(filepath.Dir(args[0])), streamerLogger)
+			resources.NewFileResourceLoader(filepath.Dir(args[0])), streamerLogger,
+			append(options, withRunHandle(handle))...)
 		resChan <- runResult{result: result, err: err}
 	}()
 
@@ -342,10 +395,10 @@ func runWithBubbleTea(ctx *util.FragsContext, sm frags.SessionManager, paramsMap
 	s.Style = lipgloss.NewStyle().Foreground(ColorViolet)
 
 	m := model{
-		spinner:        s,
-		eventChan:      eventChan,
-		resChan:        resChan,
-		activeSessions: make(map[string]sessionState),
+		spinner:   s,
+		eventChan: eventChan,
+		resChan:   resChan,
+		handle:    handle,
 	}
 
 	p := tea.NewProgram(m, tea.WithOutput(os.Stderr))
@@ -0,0 +1,107 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/theirish81/frags"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+)
+
+var (
+	codegenPackage  string
+	codegenRootName string
+)
+
+var schemaCmd = &cobra.Command{
+	Use:   "schema",
+	Short: "Work with plan schemas",
+	Long:  `Work with plan schemas. Use "gen-go" and "gen-ts" to generate the types matching the output of a plan.`,
+}
+
+var schemaGenGoCmd = &cobra.Command{
+	Use:   "gen-go <path/to/plan.yaml|fml>",
+	Short: "Generate the Go types matching the plan schema",
+	Long: `
+Generate the Go types matching the plan schema, so the output of the plan can be decoded without hand-writing the
+structs. Objects become structs with json tags, properties that are not required become pointers, enums become typed
+constants and the referenced components become named types.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		generateCode(cmd, args[0], (*frags.SessionManager).GenerateGo)
+	},
+}
+
+var schemaGenTSCmd = &cobra.Command{
+	Use:   "gen-ts <path/to/plan.yaml|fml>",
+	Short: "Generate the TypeScript types matching the plan schema",
+	Long: `
+Generate the TypeScript types matching the plan schema. Objects become interfaces, properties that are not required
+become optional, enums become unions of literals and the referenced components become named types.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		generateCode(cmd, args[0], (*frags.SessionManager).GenerateTypeScript)
+	},
+}
+
+func init() {
+	schemaGenGoCmd.Flags().StringVarP(&codegenPackage, "package", "p", "model", "package of the generated file")
+	for _, c := range []*cobra.Command{schemaGenGoCmd, schemaGenTSCmd} {
+		c.Flags().StringVarP(&codegenRootName, "root", "r", "Result", "name of the type of the plan output")
+		c.Flags().StringVarP(&output, "output", "o", "", "output file")
+		schemaCmd.AddCommand(c)
+	}
+}
+
+// generateCode parses the plan and generates the code for its schema with the given generator, writing it to the
+// output file or stdout
+func generateCode(cmd *cobra.Command, planPath string,
+	generator func(*frags.SessionManager, schema.CodegenOptions) ([]byte, error)) {
+	data, err := os.ReadFile(planPath)
+	if err != nil {
+		cmd.PrintErrln(err)
+		return
+	}
+	sm, err := parsePlan(planPath, data)
+	if err != nil {
+		cmd.PrintErrln(err)
+		return
+	}
+	code, err := generator(&sm, schema.CodegenOptions{
+		Package:  codegenPackage,
+		RootName: codegenRootName,
+		// external references are relative to the plan, as they are when running it
+		Loader: resources.NewFileResourceLoader(filepath.Dir(planPath)),
+	})
+	if err != nil {
+		cmd.PrintErrln(err)
+		return
+	}
+	if output != "" {
+		if err := os.WriteFile(output, code, 0o644); err != nil {
+			cmd.PrintErrln(err)
+		}
+		return
+	}
+	fmt.Print(string(code))
+}
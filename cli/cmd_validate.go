@@ -0,0 +1,93 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"github.com/theirish81/frags"
+)
+
+const formatText = "text"
+
+var (
+	validateFormat string
+	strict         bool
+)
+
+// validationReport is the machine-readable output of the validate command
+type validationReport struct {
+	Valid       bool              `json:"valid"`
+	Diagnostics frags.Diagnostics `json:"diagnostics"`
+}
+
+// errInvalidPlan is returned by the validate command when the plan has errors, so the CLI exits with a non-zero status
+var errInvalidPlan = errors.New("the plan is not valid")
+
+var validateCmd = &cobra.Command{
+	Use:   "validate <path/to/plan.yaml|fml>",
+	Short: "Statically validate a plan, without running it",
+	Long: `
+Statically validate a plan, without running it. Reports dependency problems, malformed schemas, templates that do not
+parse, expressions that do not compile and invalid transformers. The command exits with a non-zero status if the plan
+has errors (or warnings, in strict mode), so it can be used to gate plan changes in CI.`,
+	Args: cobra.ExactArgs(1),
+	// the diagnostics are the output, the usage would only bury them
+	SilenceUsage: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		data, err := os.ReadFile(args[0])
+		if err != nil {
+			return err
+		}
+		diagnostics := frags.Diagnostics{}
+		sm, err := parsePlan(args[0], data)
+		if err != nil {
+			diagnostics = append(diagnostics, frags.Diagnostic{
+				Severity: frags.ErrorDiagnosticSeverity,
+				Path:     args[0],
+				Message:  err.Error(),
+			})
+		} else {
+			diagnostics = sm.Validate()
+		}
+		valid := !diagnostics.HasErrors() && (!strict || len(diagnostics.Warnings()) == 0)
+		switch validateFormat {
+		case formatJSON:
+			out, _ := json.MarshalIndent(validationReport{Valid: valid, Diagnostics: diagnostics}, "", " ")
+			fmt.Println(string(out))
+		default:
+			for _, d := range diagnostics {
+				fmt.Println(d.String())
+			}
+			fmt.Printf("%d error(s), %d warning(s)\n", len(diagnostics.Errors()), len(diagnostics.Warnings()))
+		}
+		if !valid {
+			return errInvalidPlan
+		}
+		return nil
+	},
+}
+
+func init() {
+	validateCmd.Flags().StringVarP(&validateFormat, "format", "f", formatText, "output format (text, json)")
+	validateCmd.Flags().BoolVarP(&strict, "strict", "", false, "treat warnings as errors")
+}
@@ -37,6 +37,7 @@ import (
 	"github.com/theirish81/frags"
 	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
 	"github.com/theirish81/frags/util"
 )
 
@@ -111,6 +112,12 @@ var errorHandler = func(err error, c echo.Context) {
 		_ = c.JSON(he.Code, echo.Map{"error": he.Message})
 		return
 	}
+	// schema violations (i.e. bad parameters) are reported individually, so API users can act on each of them
+	var violations schema.ValidationErrors
+	if errors.As(err, &violations) {
+		_ = c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error(), "violations": violations})
+		return
+	}
 	_ = c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
 }
 
@@ -138,9 +145,14 @@ safe environments.`,
 		}
 		e.HideBanner = true
 		e.HTTPErrorHandler = errorHandler
+		addRunEndpoints(e)
+		// the cache is shared by all the requests
+		cacheOptions, err := cacheOptions(cmd.Context())
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
 		e.POST("/execute", func(c echo.Context) error {
-			ctx := util.WithFragsContext(c.Request().Context(), 15*time.Minute)
-			defer ctx.Cancel(nil)
 			req := executeRequest{}
 			if err := c.Bind(&req); err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -158,6 +170,14 @@ safe environments.`,
 			if req.Plan.SessionManager != nil {
 				sm = *req.Plan.SessionManager
 			}
+			// the run lasts as long as its wall time budget allows, so the plan must be known before the run starts
+			ctx := util.WithFragsContext(c.Request().Context(), runTimeout(sm))
+			defer ctx.Cancel(nil)
+			run, err := startRun(c, ctx)
+			if err != nil {
+				return err
+			}
+			defer endRun(run)
 			loader, err := filesMapToResourceLoader(req.Resources)
 			if err != nil {
 				return err
@@ -172,7 +192,9 @@ safe environments.`,
 				defer streamerLogger.Close()
 				streamer := NewStreamer(c, streamerLogger)
 				streamer.Start()
-				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger)
+				usage := frags.UsageReport{}
+				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger,
+					requestOptions(&usage, run, cacheOptions...)...)
 				time.Sleep(100 * time.Millisecond)
 				if err != nil {
 					return streamer.Finish(log.NewEvent(log.ErrorEventType, log.AppComponent).WithContent(result).WithErr(err).WithLevel("err"))
@@ -181,14 +203,18 @@ safe environments.`,
 				if err != nil {
 					return err
 				}
-				return streamer.Finish(log.NewEvent(log.ResultEventType, log.AppComponent).WithContent(output).WithLevel("info"))
+				return streamer.Finish(log.NewEvent(log.ResultEventType, log.AppComponent).WithContent(output).
+					WithArg("usage", usage).WithLevel("info"))
 
 			} else {
 				streamerLogger := log.NewStreamerLogger(slog.Default(), nil, log.InfoChannelLevel)
-				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger)
+				usage := frags.UsageReport{}
+				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger,
+					requestOptions(&usage, run, cacheOptions...)...)
 				if err != nil {
 					return err
 				}
+				setUsageHeader(c, usage)
 				output, isTemplate, err := dataOrRenderTemplate(c, req, sm, result)
 				if err != nil {
 					return err
@@ -232,10 +258,15 @@ carefully and use this mode only in development or safe environments.`,
 		}
 		e.HideBanner = true
 		e.HTTPErrorHandler = errorHandler
+		addRunEndpoints(e)
+		// the cache is shared by all the requests
+		cacheOptions, err := cacheOptions(cmd.Context())
+		if err != nil {
+			cmd.PrintErrln(err)
+			return
+		}
 		initMCP(e)
 		e.POST("/run/:file", func(c echo.Context) error {
-			ctx := util.WithFragsContext(c.Request().Context(), 15*time.Minute)
-			defer ctx.Cancel(nil)
 			req := executeRequest{}
 			if err := c.Bind(&req); err != nil {
 				return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -252,6 +283,14 @@ carefully and use this mode only in development or safe environments.`,
 			if err != nil {
 				return err
 			}
+			// the run lasts as long as its wall time budget allows, so the plan must be known before the run starts
+			ctx := util.WithFragsContext(c.Request().Context(), runTimeout(sm))
+			defer ctx.Cancel(nil)
+			run, err := startRun(c, ctx)
+			if err != nil {
+				return err
+			}
+			defer endRun(run)
 			toolsConfig, err := readToolsFile()
 			if err != nil {
 				return err
@@ -266,7 +305,9 @@ carefully and use this mode only in development or safe environments.`,
 				defer streamerLogger.Close()
 				streamer := NewStreamer(c, streamerLogger)
 				streamer.Start()
-				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger)
+				usage := frags.UsageReport{}
+				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger,
+					requestOptions(&usage, run, cacheOptions...)...)
 				time.Sleep(100 * time.Millisecond)
 				if err != nil {
 					return streamer.Finish(log.NewEvent(log.ErrorEventType, log.AppComponent).WithErr(err).WithLevel("err"))
@@ -275,14 +316,18 @@ carefully and use this mode only in development or safe environments.`,
 				if err != nil {
 					return err
 				}
-				return streamer.Finish(log.NewEvent(log.ResultEventType, log.AppComponent).WithContent(output).WithLevel("info"))
+				return streamer.Finish(log.NewEvent(log.ResultEventType, log.AppComponent).WithContent(output).
+					WithArg("usage", usage).WithLevel("info"))
 
 			} else {
 				streamerLogger := log.NewStreamerLogger(logger, nil, log.InfoChannelLevel)
-				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger)
+				usage := frags.UsageReport{}
+				result, err := execute(ctx, sm, req.Parameters, req.ToolsOrDefault(toolsConfig), loader, streamerLogger,
+					requestOptions(&usage, run, cacheOptions...)...)
 				if err != nil {
 					return err
 				}
+				setUsageHeader(c, usage)
 				output, isTemplate, err := dataOrRenderLoadedTemplate(c, sm, result)
 				if err != nil {
 					return err
@@ -306,6 +351,12 @@ func init() {
 	webCmd.PersistentFlags().BoolVarP(&debug, "debug", "d", false, "enable debug logging")
 	webCmd.PersistentFlags().IntVarP(&port, "port", "", 8080, "port to listen on")
 	webCmd.PersistentFlags().StringVarP(&apiKey, "api-key", "", "", "a simple api key to protect the endpoint (it is expected in the x-api-key header)")
+	webCmd.PersistentFlags().Int64Var(&budget.MaxTokens, "max-tokens", 0, "maximum number of tokens each run can use")
+	webCmd.PersistentFlags().Float64Var(&budget.MaxCost, "max-cost", 0, "maximum estimated cost of each run (requires PRICE_TABLE_PATH)")
+	webCmd.PersistentFlags().IntVar(&budget.MaxToolCalls, "max-tool-calls", 0, "maximum number of function calls each run can make")
+	webCmd.PersistentFlags().StringVar(&maxWallTime, "max-wall-time", "", "maximum duration of each run (e.g. 10m)")
+	webCmd.PersistentFlags().StringVar(&cachePath, "cache", "", "cache the AI responses in memory (memory), in a directory, or SQLite database if the path ends with .db")
+	webCmd.PersistentFlags().DurationVar(&cacheTTL, "cache-ttl", 0, "how long cached responses are valid (e.g. 24h). Zero means forever")
 
 	webCmd.AddCommand(webExecuteCmd)
 
@@ -315,6 +366,12 @@ func init() {
 	webCmd.AddCommand(webRunCmd)
 }
 
+// requestOptions returns the execution options of a request
+func requestOptions(usage *frags.UsageReport, run *runHandle, options ...executeOption) []executeOption {
+	return append([]executeOption{withUsageReport(usage), withRunHandle(run),
+		withRunnerOptions(frags.WithBudget(budgetFromFlags()))}, options...)
+}
+
 // addRequestLoggerMiddleware adds a middleware that logs each request.
 func addRequestLoggerMiddleware(e *echo.Echo, log *slog.Logger) {
 	e.Use(middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
@@ -418,3 +475,10 @@ func dataOrRenderLoadedTemplate(c echo.Context, sm frags.SessionManager, data ut
 	}
 	return data, false, nil
 }
+
+// setUsageHeader reports the token usage of the run in the X-Frags-Usage response header, as JSON
+func setUsageHeader(c echo.Context, usage frags.UsageReport) {
+	if data, err := json.Marshal(usage.Total); err == nil {
+		c.Response().Header().Set("X-Frags-Usage", string(data))
+	}
+}
@@ -17,7 +17,11 @@
 
 package main
 
-import "strings"
+import (
+	"strings"
+
+	"github.com/theirish81/frags"
+)
 
 // supported AI engines
 const (
@@ -53,6 +57,10 @@ type Config struct {
 	AnthropicApiKey          string  `mapstructure:"ANTHROPIC_API_KEY" yaml:"ANTHROPIC_API_KEY" tui:"label=Anthropic API Key"`
 	ThinkingLevel            string  `mapstructure:"THINKING_LEVEL" yaml:"THINKING_LEVEL" tui:"label=Thinking Level,enum=LOW|MEDIUM|HIGH"`
 	OauthDisabled            bool    `mapstructure:"OAUTH_DISABLED" yaml:"OAUTH_DISABLED" tui:"label=OAuth Disabled"`
+	PriceTablePath           string  `mapstructure:"PRICE_TABLE_PATH" yaml:"PRICE_TABLE_PATH" tui:"label=Price Table Path"`
+	RequestsPerMinute        int     `mapstructure:"REQUESTS_PER_MINUTE" yaml:"REQUESTS_PER_MINUTE" tui:"label=Requests Per Minute"`
+	TokensPerMinute          int     `mapstructure:"TOKENS_PER_MINUTE" yaml:"TOKENS_PER_MINUTE" tui:"label=Tokens Per Minute"`
+	MaxConcurrentRequests    int     `mapstructure:"MAX_CONCURRENT_REQUESTS" yaml:"MAX_CONCURRENT_REQUESTS" tui:"label=Max Concurrent Requests"`
 }
 
 // guessAi tries to guess the AI engine based on the configuration.
@@ -84,4 +92,31 @@ func (c Config) guessAi() string {
 	return ""
 }
 
+// rateLimits returns the limits of the requests to each AI engine
+func (c Config) rateLimits() frags.RateLimits {
+	return frags.RateLimits{
+		RequestsPerMinute: c.RequestsPerMinute,
+		TokensPerMinute:   int64(c.TokensPerMinute),
+		MaxConcurrent:     c.MaxConcurrentRequests,
+	}
+}
+
+// configuredEngines returns the AI engines that have all the settings they need. The dummy engine is always available.
+func (c Config) configuredEngines() []string {
+	engines := make([]string, 0)
+	if c.OllamaBaseURL != "" {
+		engines = append(engines, engineOllama)
+	}
+	if c.GeminiServiceAccountPath != "" && c.GeminiProjectID != "" && c.GeminiLocation != "" {
+		engines = append(engines, engineGemini)
+	}
+	if c.ChatGptApiKey != "" && c.ChatGptBaseURL != "" {
+		engines = append(engines, engineChatgpt)
+	}
+	if c.AnthropicApiKey != "" {
+		engines = append(engines, engineAnthropic)
+	}
+	return append(engines, engineDummy)
+}
+
 var cfg = Config{}
@@ -20,9 +20,12 @@ package main
 import (
 	"os"
 	"strings"
+	"time"
 
 	"github.com/samber/lo"
 	"github.com/theirish81/frags"
+	"github.com/theirish81/frags/caches"
+	"github.com/theirish81/frags/checkpoints"
 	"github.com/theirish81/frags/evaluators"
 	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
@@ -32,9 +35,83 @@ import (
 	"github.com/theirish81/zealql"
 )
 
+// executeOptions are the optional settings of a plan execution
+type executeOptions struct {
+	runnerOptions []frags.RunnerOption
+	resume        *checkpoints.Checkpoint
+	usage         *frags.UsageReport
+	dryRun        *[]frags.DryRunCall
+	cassetteMode  frags.CassetteMode
+	cassetteDir   string
+	cache         caches.Store
+	cacheTTL      time.Duration
+	handle        *runHandle
+}
+
+// executeOption is an option for a plan execution
+type executeOption func(*executeOptions)
+
+// withRunnerOptions appends options to the ones the runner will be created with
+func withRunnerOptions(options ...frags.RunnerOption) executeOption {
+	return func(o *executeOptions) {
+		o.runnerOptions = append(o.runnerOptions, options...)
+	}
+}
+
+// withResume makes the execution resume from the given checkpoint, rather than starting from scratch
+func withResume(checkpoint *checkpoints.Checkpoint) executeOption {
+	return func(o *executeOptions) {
+		o.resume = checkpoint
+	}
+}
+
+// withUsageReport makes the execution fill the given report with the token usage of the run, once it's over
+func withUsageReport(report *frags.UsageReport) executeOption {
+	return func(o *executeOptions) {
+		o.usage = report
+	}
+}
+
+// withDryRun makes the execution render the prompts without calling the AI, and fill calls with what the AI would
+// have received
+func withDryRun(calls *[]frags.DryRunCall) executeOption {
+	return func(o *executeOptions) {
+		o.dryRun = calls
+		o.runnerOptions = append(o.runnerOptions, frags.WithDryRun(true))
+	}
+}
+
+// withCassettes makes the execution record the AI interactions to the directory, or replay them from it
+func withCassettes(mode frags.CassetteMode, dir string) executeOption {
+	return func(o *executeOptions) {
+		o.cassetteMode = mode
+		o.cassetteDir = dir
+	}
+}
+
+// withCache makes the execution cache the AI responses in the store
+func withCache(store caches.Store, ttl time.Duration) executeOption {
+	return func(o *executeOptions) {
+		o.cache = store
+		o.cacheTTL = ttl
+	}
+}
+
+// withRunHandle makes the runner of the execution available via the handle, as soon as it's created
+func withRunHandle(handle *runHandle) executeOption {
+	return func(o *executeOptions) {
+		o.handle = handle
+	}
+}
+
 // execute executes the plan using the specified parameters
 func execute(ctx *util.FragsContext, sm frags.SessionManager, paramsMap map[string]any, toolConfig ExtendedToolsConfig,
-	rl resources.ResourceLoader, logger *log.StreamerLogger) (util.ProgMap, error) {
+	rl resources.ResourceLoader, logger *log.StreamerLogger, options ...executeOption) (util.ProgMap, error) {
+	opts := executeOptions{}
+	for _, opt := range options {
+		opt(&opts)
+	}
+
 	// parameters can only be strings via CLI, so we tell the parameter validator to enable loose type checking,
 	// that is, if a string contains a number, it will be parsed as a number if the schema expects it
 	sm.Parameters.SetLooseType(true)
@@ -49,7 +126,7 @@ func execute(ctx *util.FragsContext, sm frags.SessionManager, paramsMap map[stri
 		sm.Vars, err = evaluators.EvaluateMapValues(sm.Vars, evaluators.NewEvalScope().WithParams(paramsMap).WithVars(env))
 	}
 
-	ai, err := initAi()
+	ai, aiFactories, err := initExecutionAi(opts)
 	if err != nil {
 		return nil, err
 	}
@@ -72,18 +149,98 @@ func execute(ctx *util.FragsContext, sm frags.SessionManager, paramsMap map[stri
 		workers = 1
 	}
 
-	runner := frags.NewRunner(
-		sm,
-		rl,
-		ai,
+	runnerOptions := []frags.RunnerOption{
 		frags.WithSessionWorkers(workers),
 		frags.WithLogger(logger),
 		frags.WithScriptEngine(scriptengines.NewJavascriptScriptingEngine()),
 		frags.WithExternalFunctions(functions),
 		frags.WithToolsDefinitions(definitions),
 		frags.WithInternalDatabase(db),
-	)
+		frags.WithAiFactories(aiFactories),
+	}
+	if cfg.PriceTablePath != "" {
+		prices, err := readPriceTable(cfg.PriceTablePath)
+		if err != nil {
+			return nil, err
+		}
+		runnerOptions = append(runnerOptions, frags.WithPriceTable(prices))
+	}
+	runner := frags.NewRunner(sm, rl, ai, append(runnerOptions, opts.runnerOptions...)...)
+	if opts.handle != nil {
+		opts.handle.setRunner(&runner)
+	}
+	if opts.usage != nil {
+		defer func() {
+			*opts.usage = runner.Usage()
+		}()
+	}
+	if opts.dryRun != nil {
+		defer func() {
+			*opts.dryRun = runner.DryRun()
+		}()
+	}
 	// execute
+	if opts.resume != nil {
+		return runner.Resume(ctx, opts.resume)
+	}
 	return runner.Run(ctx, paramsMap)
 
 }
+
+// initExecutionAi initializes the configured AI and the factories of the AIs sessions can select, wrapped in a cache
+// and a cassette recorder if requested. Replaying cassettes requires no AI engine at all.
+func initExecutionAi(opts executeOptions) (frags.Ai, frags.AiFactories, error) {
+	if opts.cassetteMode == frags.ReplayCassetteMode {
+		ai, err := frags.NewReplayingAi(opts.cassetteDir)
+		if err != nil {
+			return nil, nil, err
+		}
+		// interactions are recorded regardless of the engine, so every engine replays from the same cassettes
+		factories := frags.AiFactories{}
+		for _, engine := range []string{engineGemini, engineOllama, engineChatgpt, engineAnthropic, engineDummy} {
+			factories[engine] = func(_ frags.AiConfig) (frags.Ai, error) {
+				return ai.New(), nil
+			}
+		}
+		return ai, factories, nil
+	}
+	ai, err := initAi()
+	if err != nil {
+		return nil, nil, err
+	}
+	ai, err = decorateAi(ai, frags.AiConfig{Engine: cfg.guessAi(), Model: cfg.Model}, opts)
+	if err != nil {
+		return nil, nil, err
+	}
+	factories := initAiFactories()
+	for engine, factory := range factories {
+		factories[engine] = func(aiConfig frags.AiConfig) (frags.Ai, error) {
+			ai, err := factory(aiConfig)
+			if err != nil {
+				return nil, err
+			}
+			return decorateAi(ai, aiConfig, opts)
+		}
+	}
+	return ai, factories, nil
+}
+
+// decorateAi wraps the AI in a rate limiter, a cache and a cassette recorder, if requested. The rate limiter is the
+// innermost, so cache hits don't count against the limits.
+func decorateAi(ai frags.Ai, aiConfig frags.AiConfig, opts executeOptions) (frags.Ai, error) {
+	if limiter := rateLimiter(aiConfig.Engine); limiter != nil {
+		ai = frags.NewRateLimitedAi(ai, aiConfig.Engine, limiter)
+	}
+	if opts.cache != nil {
+		// the cache key includes the model, so different models never share responses
+		model, err := aiModel(aiConfig)
+		if err != nil {
+			return nil, err
+		}
+		ai = frags.NewCachedAi(ai, opts.cache, aiConfig.Engine+"/"+model, opts.cacheTTL)
+	}
+	if opts.cassetteMode == frags.RecordCassetteMode {
+		return frags.NewRecordingAi(ai, opts.cassetteDir)
+	}
+	return ai, nil
+}
@@ -88,5 +88,8 @@ func main() {
 	if err := viper.Unmarshal(&cfg); err != nil {
 		panic(err)
 	}
-	_ = rootCmd.Execute()
+	// commands returning an error make the CLI exit with a non-zero status, which scripts and CI rely on
+	if err := rootCmd.Execute(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,159 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/labstack/echo/v4"
+	"github.com/theirish81/frags"
+	"github.com/theirish81/frags/util"
+)
+
+// runIDHeader is the header carrying the ID of a run. Clients can choose the ID of their runs by setting it in the
+// request, otherwise a random one is generated. Either way, it's returned in the response.
+const runIDHeader = "X-Frags-Run-ID"
+
+// runHandle gives access to the runner of an execution, once it has been created
+type runHandle struct {
+	id     string
+	ctx    *util.FragsContext
+	mutex  sync.Mutex
+	runner *frags.Runner
+}
+
+// setRunner sets the runner of the execution
+func (h *runHandle) setRunner(runner *frags.Runner) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.runner = runner
+}
+
+// getRunner returns the runner of the execution, or nil if it has not been created yet
+func (h *runHandle) getRunner() *frags.Runner {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.runner
+}
+
+// state returns the state of the run, which is empty until the runner is created
+func (h *runHandle) state() frags.RunnerState {
+	if runner := h.getRunner(); runner != nil {
+		return runner.State()
+	}
+	return frags.RunnerState{Sessions: make([]frags.SessionState, 0)}
+}
+
+// activeRuns are the runs in progress on the web server, by ID
+var (
+	activeRuns      = make(map[string]*runHandle)
+	activeRunsMutex sync.Mutex
+)
+
+// startRun registers a new run of the request, and returns its ID in the response header
+func startRun(c echo.Context, ctx *util.FragsContext) (*runHandle, error) {
+	id := c.Request().Header.Get(runIDHeader)
+	if id == "" {
+		id = uuid.NewString()
+	}
+	activeRunsMutex.Lock()
+	defer activeRunsMutex.Unlock()
+	if _, ok := activeRuns[id]; ok {
+		return nil, echo.NewHTTPError(http.StatusConflict, "a run with ID "+id+" is already in progress")
+	}
+	handle := &runHandle{id: id, ctx: ctx}
+	activeRuns[id] = handle
+	c.Response().Header().Set(runIDHeader, id)
+	return handle, nil
+}
+
+// endRun unregisters the run
+func endRun(handle *runHandle) {
+	activeRunsMutex.Lock()
+	defer activeRunsMutex.Unlock()
+	delete(activeRuns, handle.id)
+}
+
+// findRun returns the run with the ID in the path, or a not found error
+func findRun(c echo.Context) (*runHandle, error) {
+	activeRunsMutex.Lock()
+	defer activeRunsMutex.Unlock()
+	handle, ok := activeRuns[c.Param("id")]
+	if !ok {
+		return nil, echo.NewHTTPError(http.StatusNotFound, "run not found")
+	}
+	return handle, nil
+}
+
+// addRunEndpoints adds the endpoints to inspect and control the runs in progress
+func addRunEndpoints(e *echo.Echo) {
+	e.GET("/runs/:id", func(c echo.Context) error {
+		handle, err := findRun(c)
+		if err != nil {
+			return err
+		}
+		return c.JSON(http.StatusOK, handle.state())
+	})
+	e.POST("/runs/:id/pause", func(c echo.Context) error {
+		return controlRun(c, func(runner *frags.Runner) error {
+			runner.PauseDispatch()
+			return nil
+		})
+	})
+	e.POST("/runs/:id/resume", func(c echo.Context) error {
+		return controlRun(c, func(runner *frags.Runner) error {
+			runner.ResumeDispatch()
+			return nil
+		})
+	})
+	e.POST("/runs/:id/sessions/:session/cancel", func(c echo.Context) error {
+		return controlRun(c, func(runner *frags.Runner) error {
+			if err := runner.CancelSession(c.Param("session")); err != nil {
+				return echo.NewHTTPError(http.StatusConflict, err.Error())
+			}
+			return nil
+		})
+	})
+	e.POST("/runs/:id/cancel", func(c echo.Context) error {
+		handle, err := findRun(c)
+		if err != nil {
+			return err
+		}
+		handle.ctx.Cancel(errors.New("run cancelled by request"))
+		return c.JSON(http.StatusOK, handle.state())
+	})
+}
+
+// controlRun applies the action to the runner of the run with the ID in the path, and responds with its state
+func controlRun(c echo.Context, action func(runner *frags.Runner) error) error {
+	handle, err := findRun(c)
+	if err != nil {
+		return err
+	}
+	runner := handle.getRunner()
+	if runner == nil {
+		return echo.NewHTTPError(http.StatusConflict, "the run has not started yet")
+	}
+	if err := action(runner); err != nil {
+		return err
+	}
+	return c.JSON(http.StatusOK, runner.State())
+}
@@ -20,10 +20,13 @@ package main
 import (
 	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
+	"time"
 
 	fmlCompiler "github.com/theirish81/fml/compiler"
 	fmlParser "github.com/theirish81/fml/parser"
@@ -76,3 +79,67 @@ func parsePlan(filename string, data []byte) (frags.SessionManager, error) {
 	err := sm.FromYAML(data)
 	return sm, err
 }
+
+// budgetFromFlags returns the budget set with the command line flags
+func budgetFromFlags() frags.Budget {
+	b := budget
+	if maxWallTime != "" {
+		b.MaxWallTime = &maxWallTime
+	}
+	return b
+}
+
+// defaultRunTimeout is the timeout of the runs without a wall time budget
+const defaultRunTimeout = 15 * time.Minute
+
+// runTimeoutGrace is added to the wall time budget, so the budget reports the exceeded limit before the context of
+// the run expires
+const runTimeoutGrace = time.Minute
+
+// runTimeout returns the timeout of the context of a run of the plan, based on the strictest wall time budget
+// between the flags and the plan. Without one, the default timeout applies.
+func runTimeout(sm frags.SessionManager) time.Duration {
+	b := budgetFromFlags()
+	if sm.Budget != nil {
+		b = b.Merge(*sm.Budget)
+	}
+	wallTime := util.ParseDurationOrDefault(b.MaxWallTime, 0)
+	if wallTime <= 0 {
+		return defaultRunTimeout
+	}
+	return wallTime + runTimeoutGrace
+}
+
+// readPriceTable reads a YAML file mapping model names to their prices per million tokens
+func readPriceTable(path string) (util.PriceTable, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	prices := util.PriceTable{}
+	if err := yaml.Unmarshal(data, &prices); err != nil {
+		return nil, fmt.Errorf("invalid price table %s: %w", path, err)
+	}
+	return prices, nil
+}
+
+// formatUsage returns a one-line summary of the token usage of a run
+func formatUsage(report frags.UsageReport) string {
+	s := fmt.Sprintf("tokens: %d input (%d cached), %d output (%d reasoning)", report.Total.Input,
+		report.Total.Cached, report.Total.Output, report.Total.Reasoning)
+	if report.Total.Cost != nil {
+		s += fmt.Sprintf(" - estimated cost: $%.4f", *report.Total.Cost)
+	}
+	// the engines that answered are only reported by the sessions with fallbacks
+	engines := make([]string, 0)
+	for _, iterations := range report.Engines {
+		for _, engine := range iterations {
+			engines = append(engines, engine)
+		}
+	}
+	if len(engines) > 0 {
+		slices.Sort(engines)
+		s += " - answered by: " + strings.Join(slices.Compact(engines), ", ")
+	}
+	return s
+}
@@ -51,10 +51,10 @@ func (r *Runner) CheckDependencies(dependencies Dependencies) (DependencyCheckRe
 	for _, dep := range dependencies {
 		if dep.Session != nil {
 			dependencyStatus, _ := r.status.Load(*dep.Session)
-			if slices.Contains([]SessionStatus{failedSessionStatus, noOpSessionStatus}, dependencyStatus) {
+			if slices.Contains([]SessionStatus{FailedSessionStatus, NoOpSessionStatus}, dependencyStatus) {
 				return DependencyCheckUnsolvable, nil
 			}
-			if slices.Contains([]SessionStatus{queuedSessionStatus, committedSessionStatus, runningSessionStatus}, dependencyStatus) {
+			if slices.Contains([]SessionStatus{QueuedSessionStatus, CommittedSessionStatus, RunningSessionStatus}, dependencyStatus) {
 				return DependencyCheckFailed, nil
 			}
 		}
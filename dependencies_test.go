@@ -28,12 +28,12 @@ func TestRunner_CheckDependencies(t *testing.T) {
 	rx := Runner{
 		status: &SafeMap[string, SessionStatus]{
 			data: map[string]SessionStatus{
-				"foo": queuedSessionStatus,
-				"fuz": finishedSessionStatus,
-				"bar": runningSessionStatus,
-				"baz": failedSessionStatus,
-				"bat": noOpSessionStatus,
-				"bam": committedSessionStatus,
+				"foo": QueuedSessionStatus,
+				"fuz": FinishedSessionStatus,
+				"bar": RunningSessionStatus,
+				"baz": FailedSessionStatus,
+				"bat": NoOpSessionStatus,
+				"bam": CommittedSessionStatus,
 			},
 		},
 		dataStructure: map[string]any{
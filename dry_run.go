@@ -0,0 +1,116 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+)
+
+// dryRunText is the text the AI answers with in dry-run mode
+const dryRunText = "dry run"
+
+// DryRunCall describes an AI interaction that was not performed because the runner is in dry-run mode. It carries
+// everything the AI would have received.
+type DryRunCall struct {
+	Session      string          `json:"session" yaml:"session"`
+	Iteration    int             `json:"iteration" yaml:"iteration"`
+	SystemPrompt string          `json:"systemPrompt,omitempty" yaml:"systemPrompt,omitempty"`
+	Prompt       string          `json:"prompt" yaml:"prompt"`
+	Resources    []DryRunFile    `json:"resources,omitempty" yaml:"resources,omitempty"`
+	Schema       *schema.Schema  `json:"schema,omitempty" yaml:"schema,omitempty"`
+	Tools        ToolDefinitions `json:"tools,omitempty" yaml:"tools,omitempty"`
+	seq          int
+}
+
+// DryRunFile describes a resource that would have been sent to the AI
+type DryRunFile struct {
+	Identifier string `json:"identifier" yaml:"identifier"`
+	MediaType  string `json:"mediaType" yaml:"mediaType"`
+	Size       int    `json:"size" yaml:"size"`
+}
+
+// dryRunAsk records the interaction instead of asking the AI, and answers with placeholder data that matches the
+// schema, so the dependent sessions can run as well.
+func (r *Runner) dryRunAsk(sessionID string, iteratorIdx int, text string, sx *schema.Schema, tools ToolDefinitions,
+	rx ...resources.ResourceData) ([]byte, error) {
+	call := DryRunCall{
+		Session:      sessionID,
+		Iteration:    iteratorIdx,
+		SystemPrompt: r.systemPrompt,
+		Prompt:       text,
+		Schema:       sx,
+		Tools:        tools,
+	}
+	for _, resource := range rx {
+		call.Resources = append(call.Resources, DryRunFile{
+			Identifier: resource.Identifier,
+			MediaType:  resource.MediaType,
+			Size:       len(resource.ByteContent),
+		})
+	}
+	r.recordDryRunCall(call)
+	r.logger.Info(log.NewEvent(log.GenericEventType, log.AiComponent).WithMessage("dry run, the AI was not called").
+		WithSession(sessionID).WithIteration(iteratorIdx).WithContent(text))
+	if sx == nil {
+		return []byte(dryRunText), nil
+	}
+	return json.Marshal(dummyOutput(sx, dryRunText))
+}
+
+// recordDryRunCall records an interaction of the dry run. The interactions of a sub-plan are recorded as interactions
+// of the session running it as well.
+func (r *Runner) recordDryRunCall(call DryRunCall) {
+	r.dryRunMutex.Lock()
+	call.seq = len(r.dryRunCalls)
+	r.dryRunCalls = append(r.dryRunCalls, call)
+	r.dryRunMutex.Unlock()
+	if r.parent != nil {
+		call.Session = r.parent.sessionID
+		call.Iteration = r.parent.iteration
+		r.parent.runner.recordDryRunCall(call)
+	}
+}
+
+// DryRun returns the AI interactions of the current (or last) dry run, in plan order. Interactions of the same
+// session are sorted by iteration, then by the order they were performed in.
+func (r *Runner) DryRun() []DryRunCall {
+	r.dryRunMutex.Lock()
+	calls := slices.Clone(r.dryRunCalls)
+	r.dryRunMutex.Unlock()
+	order := r.sessionManager.Sessions.Order
+	slices.SortStableFunc(calls, func(a, b DryRunCall) int {
+		if a.Session != b.Session {
+			return slices.Index(order, a.Session) - slices.Index(order, b.Session)
+		}
+		if a.Iteration != b.Iteration {
+			return a.Iteration - b.Iteration
+		}
+		return a.seq - b.seq
+	})
+	return calls
+}
+
+// stubFunctionCall returns the placeholder result of a function call that was not performed
+func stubFunctionCall(fc FunctionCaller) any {
+	return map[string]any{"stub": fc.Name}
+}
@@ -0,0 +1,144 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestRunner_DryRun(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+systemPrompt: you are an expert of {{ .vars.topic }}
+vars:
+  topic: animals
+  animals: [cat, dog]
+sessions:
+  lookup:
+    preCalls:
+      - name: search
+        args:
+          query: "{{ .vars.topic }}"
+    prePrompt: read the search results
+    prompt: list some animals
+  describe:
+    iterateOn: vars.animals
+    prompt: describe the {{ .it }}
+    dependsOn:
+      - session: lookup
+schema:
+  properties:
+    animals:
+      type: array
+      items:
+        type: string
+      x-session: lookup
+    descriptions:
+      type: array
+      items:
+        type: string
+      x-session: describe
+`)))
+	searched := false
+	functions := ExternalFunctions{"search": {Name: "search", Func: func(ctx *util.FragsContext, data map[string]any) (any, error) {
+		searched = true
+		return "cats and dogs", nil
+	}}}
+	// the AI fails any prompt, so the run can only succeed if it's never called
+	ai := &failingAi{failOn: ""}
+
+	t.Run("prompts are rendered", func(t *testing.T) {
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai, WithDryRun(true),
+			WithExternalFunctions(functions), WithSessionWorkers(2))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.True(t, searched)
+		calls := runner.DryRun()
+		assert.Len(t, calls, 4)
+		assert.Equal(t, "you are an expert of animals", calls[0].SystemPrompt)
+		assert.Equal(t, "lookup", calls[0].Session)
+		assert.Contains(t, calls[0].Prompt, "cats and dogs")
+		assert.Contains(t, calls[0].Prompt, "read the search results")
+		assert.Nil(t, calls[0].Schema)
+		assert.Equal(t, "list some animals", calls[1].Prompt)
+		assert.NotNil(t, calls[1].Schema)
+		assert.Equal(t, "describe", calls[2].Session)
+		assert.Contains(t, calls[2].Prompt, "describe the cat")
+		assert.Equal(t, 1, calls[3].Iteration)
+		assert.Contains(t, calls[3].Prompt, "describe the dog")
+	})
+	t.Run("preCalls can be stubbed", func(t *testing.T) {
+		searched = false
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai, WithDryRun(true), WithStubbedPreCalls(true),
+			WithExternalFunctions(functions))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.False(t, searched)
+		assert.Contains(t, runner.DryRun()[0].Prompt, `{"stub":"search"}`)
+	})
+}
+
+func TestRunner_DryRunConstrainedSchema(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  classify:
+    prompt: classify the ticket
+  escalate:
+    prompt: escalate the ticket opened on {{ .context.opened }}
+    dependsOn:
+      - session: classify
+        expression: context.severity == 'high'
+schema:
+  required: [severity, opened, tags]
+  properties:
+    severity:
+      type: string
+      enum: [high, low]
+      x-session: classify
+    opened:
+      type: string
+      format: date
+      x-session: classify
+    tags:
+      type: array
+      minItems: 2
+      items:
+        type: string
+        pattern: "^[a-z]+$"
+      x-session: classify
+    escalation:
+      type: string
+      x-session: escalate
+`)))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), &failingAi{failOn: ""}, WithDryRun(true))
+	out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "high", out["severity"])
+	assert.Equal(t, "2000-01-01", out["opened"])
+	calls := runner.DryRun()
+	// no repair prompts, and the dependent session is rendered with the placeholder of the enum
+	assert.Len(t, calls, 2)
+	assert.Equal(t, "escalate", calls[1].Session)
+	assert.Contains(t, calls[1].Prompt, "escalate the ticket opened on 2000-01-01")
+}
@@ -0,0 +1,96 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/theirish81/frags/evaluators"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/util"
+)
+
+// OnErrorPolicy defines what happens to a run when a session fails.
+type OnErrorPolicy string
+
+const (
+	// FailOnErrorPolicy cancels the whole run. This is the default.
+	FailOnErrorPolicy OnErrorPolicy = "fail"
+	// ContinueOnErrorPolicy marks the session as failed and lets the independent sessions proceed. The sessions that
+	// depend on it won't run.
+	ContinueOnErrorPolicy OnErrorPolicy = "continue"
+	// FallbackOnErrorPolicy merges the session Fallback into the output, and lets the run proceed as if the session
+	// had succeeded.
+	FallbackOnErrorPolicy OnErrorPolicy = "fallback"
+)
+
+// Fallback is the default output of a session that failed, when its OnError policy is FallbackOnErrorPolicy.
+// Value is a static object. Expression is an expr expression evaluating to an object, that can reference the
+// error message as `error`. If both are set, Expression wins. In both cases, the object is merged into the output
+// just like the LLM response would, so its keys are the properties of the session schema slice.
+type Fallback struct {
+	Value      map[string]any `json:"value,omitempty" yaml:"value,omitempty"`
+	Expression *string        `json:"expression,omitempty" yaml:"expression,omitempty"`
+}
+
+// handleSessionFailure applies the OnError policy of a failed session.
+func (r *Runner) handleSessionFailure(mainContext *util.FragsContext, sessionID string, session Session, sessionErr error) {
+	r.sessionErrors.Store(sessionID, sessionErr)
+	switch session.OnError {
+	case ContinueOnErrorPolicy:
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.SessionComponent).
+			WithMessage("session failed, continuing").WithSession(sessionID).WithErr(sessionErr))
+		r.SetStatus(sessionID, FailedSessionStatus)
+	case FallbackOnErrorPolicy:
+		if err := r.applyFallback(sessionID, session, sessionErr); err != nil {
+			r.logger.Err(log.NewEvent(log.ErrorEventType, log.SessionComponent).
+				WithMessage("failed to apply fallback").WithSession(sessionID).WithErr(err))
+			r.SetStatus(sessionID, FailedSessionStatus)
+			mainContext.Cancel(errors.Join(sessionErr, err))
+			return
+		}
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.SessionComponent).
+			WithMessage("session failed, fallback applied").WithSession(sessionID).WithErr(sessionErr))
+		r.SetStatus(sessionID, FallbackSessionStatus)
+	default:
+		r.SetStatus(sessionID, FailedSessionStatus)
+		mainContext.Cancel(sessionErr)
+	}
+}
+
+// applyFallback merges the fallback of a session into the data structure.
+func (r *Runner) applyFallback(sessionID string, session Session, sessionErr error) error {
+	if session.Fallback == nil {
+		return fmt.Errorf("session %s has no fallback", sessionID)
+	}
+	value := session.Fallback.Value
+	if session.Fallback.Expression != nil {
+		scope := r.newEvalScope().WithVars(session.Vars)
+		scope[evaluators.ErrorAttr] = sessionErr.Error()
+		res, err := evaluators.EvaluateExpression(*session.Fallback.Expression, scope)
+		if err != nil {
+			return err
+		}
+		var ok bool
+		if value, ok = res.(map[string]any); !ok {
+			return errors.New("fallback expression did not evaluate to an object")
+		}
+	}
+	return r.safeMergeDataStructure(value)
+}
@@ -36,6 +36,9 @@ const (
 	IteratorAttr   = "it"
 	VarsAttr       = "vars"
 	DbAttr         = "db"
+	ErrorAttr      = "error"
+	OutputAttr     = "output"
+	RoundAttr      = "round"
 )
 
 // EvalScope is the scope for evaluating expressions.
@@ -64,6 +67,12 @@ func (e EvalScope) WithDB(db *zealql.Database) EvalScope {
 	return e
 }
 
+// WithOutput adds the output of a session.
+func (e EvalScope) WithOutput(output any) EvalScope {
+	e[OutputAttr] = output
+	return e
+}
+
 func (e EvalScope) WithParams(params map[string]any) EvalScope {
 	if params == nil {
 		e[ParamsAttr] = make(map[string]any)
@@ -110,6 +119,19 @@ func EvaluateTemplate(text string, scope EvalScope) (string, error) {
 	return text, nil
 }
 
+// CompileTemplate parses a Golang template without executing it. Useful to statically validate a template.
+func CompileTemplate(text string) error {
+	_, err := template.New("tpl").Funcs(templateFuncs).Parse(text)
+	return err
+}
+
+// CompileExpression compiles an expr expression without executing it. Useful to statically validate an expression.
+// No environment is provided, so variables that will only be known at runtime are accepted.
+func CompileExpression(expression string) error {
+	_, err := expr.Compile(expression, exprFunctions()...)
+	return err
+}
+
 func EvaluateExpression(expression string, scope EvalScope) (any, error) {
 	c, err := expr.Compile(expression, append(exprFunctions(), expr.Env(scope))...)
 	if err != nil {
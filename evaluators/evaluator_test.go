@@ -152,3 +152,14 @@ func TestEvaluateExpression_Render(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "What do we say? come monkey!", out)
 }
+
+func TestCompileTemplate(t *testing.T) {
+	assert.NoError(t, CompileTemplate(`{{ .params.animal }} {{ json .context }}`))
+	assert.Error(t, CompileTemplate(`{{ .params.animal `))
+	assert.Error(t, CompileTemplate(`{{ unknownFunc .params }}`))
+}
+
+func TestCompileExpression(t *testing.T) {
+	assert.NoError(t, CompileExpression(`len(context.animals) > 0 && params.foo == "bar"`))
+	assert.Error(t, CompileExpression(`len(context.animals) >`))
+}
@@ -0,0 +1,170 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// EngineReporter is implemented by the AIs that delegate to other engines. Engine returns the name of the engine that
+// answered the last interaction.
+type EngineReporter interface {
+	Engine() string
+}
+
+// FallbackMember is an AI of a FallbackAi, with the name it is reported by
+type FallbackMember struct {
+	Name string
+	Ai   Ai
+}
+
+// FallbackAi is an Ai that asks an ordered list of AIs, moving to the next one when an AI fails with a transient
+// error (quota, rate limit, overload or connectivity), after its own retries are exhausted. Other errors are returned
+// as they are.
+// Once an AI has failed, the conversation carries on with the next one. As the next AI has never seen the previous
+// interactions of the conversation, they are asked again to bring it up to speed.
+type FallbackAi struct {
+	members []FallbackMember
+	active  int
+	history []interaction
+	engine  string
+}
+
+// NewFallbackAi returns a FallbackAi asking the members in order
+func NewFallbackAi(members ...FallbackMember) *FallbackAi {
+	return &FallbackAi{members: members}
+}
+
+// Ask asks the active AI, falling back to the next ones on transient errors, according to the Frags interface
+func (f *FallbackAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	if len(f.members) == 0 {
+		return nil, errors.New("the fallback AI has no members")
+	}
+	var err error
+	for i := f.active; i < len(f.members); i++ {
+		member := f.members[i]
+		if i != f.active {
+			runner.Logger().Warn(log.NewEvent(log.ErrorEventType, log.AiComponent).
+				WithMessage("AI engine failed, falling back").WithEngine(f.members[i-1].Name).WithErr(err).
+				WithArg("fallback", member.Name))
+			err = f.catchUp(ctx, member, runner)
+		}
+		var data []byte
+		if err == nil {
+			data, err = member.Ai.Ask(ctx, text, sx, tools, runner, rx...)
+		}
+		if err == nil {
+			f.active = i
+			f.engine = member.Name
+			f.history = append(f.history, interaction{text: text, schema: sx, tools: tools, resources: rx})
+			runner.Logger().Debug(log.NewEvent(log.GenericEventType, log.AiComponent).WithMessage("AI engine answered").
+				WithEngine(member.Name))
+			return data, nil
+		}
+		// a cancelled run is not a provider failure, and other errors would most likely repeat with any engine
+		if ctx.Err() != nil || !IsTransientAiError(err) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// catchUp asks the member the previous interactions of the conversation
+func (f *FallbackAi) catchUp(ctx *util.FragsContext, member FallbackMember, runner ExportableRunner) error {
+	for _, i := range f.history {
+		if _, err := member.Ai.Ask(ctx, i.text, i.schema, i.tools, runner, i.resources...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// New creates a new FallbackAi, with a new instance of each member
+func (f *FallbackAi) New() Ai {
+	members := make([]FallbackMember, len(f.members))
+	for i, m := range f.members {
+		members[i] = FallbackMember{Name: m.Name, Ai: m.Ai.New()}
+	}
+	return NewFallbackAi(members...)
+}
+
+// SetFunctions sets the functions of all the members
+func (f *FallbackAi) SetFunctions(functions ExternalFunctions) {
+	for _, m := range f.members {
+		m.Ai.SetFunctions(functions)
+	}
+}
+
+// SetSystemPrompt sets the system prompt of all the members
+func (f *FallbackAi) SetSystemPrompt(systemPrompt string) {
+	for _, m := range f.members {
+		m.Ai.SetSystemPrompt(systemPrompt)
+	}
+}
+
+// RunFunction runs the function through the active member
+func (f *FallbackAi) RunFunction(ctx *util.FragsContext, functionCall FunctionCaller, runner ExportableRunner) (any, error) {
+	if len(f.members) == 0 {
+		return nil, errors.New("the fallback AI has no members")
+	}
+	return f.members[f.active].Ai.RunFunction(ctx, functionCall, runner)
+}
+
+// Usage returns the tokens used by all the members
+func (f *FallbackAi) Usage() util.ModelUsage {
+	usage := util.ModelUsage{}
+	for _, m := range f.members {
+		if tracker, ok := m.Ai.(UsageTracker); ok {
+			usage = usage.Add(tracker.Usage())
+		}
+	}
+	return usage
+}
+
+// Engine returns the name of the member that answered the last interaction
+func (f *FallbackAi) Engine() string {
+	return f.engine
+}
+
+// IsTransientAiError returns true if the error reports a quota, rate limit, overload or connectivity problem of an AI
+// provider, that another provider would likely not have.
+func IsTransientAiError(err error) bool {
+	if err == nil {
+		return false
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	errStr := strings.ToLower(err.Error())
+	for _, s := range []string{"resource_exhausted", "429", "500", "502", "503", "504", "529", "timeout",
+		"overloaded", "rate limit", "quota", "unavailable"} {
+		if strings.Contains(errStr, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,142 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// flakyAi fails with the given error after answering a number of times
+type flakyAi struct {
+	DummyAi
+	answers int
+	err     error
+}
+
+func (a *flakyAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	if a.answers <= 0 {
+		return nil, a.err
+	}
+	a.answers--
+	return a.DummyAi.Ask(ctx, text, sx, tools, runner, rx...)
+}
+
+func (a *flakyAi) New() Ai {
+	return &flakyAi{answers: a.answers, err: a.err}
+}
+
+func TestFallbackAi(t *testing.T) {
+	quotaErr := errors.New("Error 429, Message: Resource exhausted, Status: RESOURCE_EXHAUSTED")
+	runner := NewRunner(NewSessionManager(), resources.NewDummyResourceLoader(), NewDummyAi())
+	ctx := util.NewFragsContext(time.Minute)
+
+	t.Run("transient errors fall back", func(t *testing.T) {
+		second := NewDummyAi()
+		ai := NewFallbackAi(FallbackMember{Name: "first", Ai: &flakyAi{err: quotaErr}},
+			FallbackMember{Name: "second", Ai: second})
+		_, err := ai.Ask(ctx, "describe a cat", nil, nil, &runner)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", ai.Engine())
+		assert.Len(t, second.History, 1)
+	})
+	t.Run("other errors are returned", func(t *testing.T) {
+		second := NewDummyAi()
+		ai := NewFallbackAi(FallbackMember{Name: "first", Ai: &flakyAi{err: errors.New("invalid schema")}},
+			FallbackMember{Name: "second", Ai: second})
+		_, err := ai.Ask(ctx, "describe a cat", nil, nil, &runner)
+		assert.ErrorContains(t, err, "invalid schema")
+		assert.Empty(t, second.History)
+	})
+	t.Run("the last error is returned when all members fail", func(t *testing.T) {
+		ai := NewFallbackAi(FallbackMember{Name: "first", Ai: &flakyAi{err: quotaErr}},
+			FallbackMember{Name: "second", Ai: &flakyAi{err: errors.New("503 service unavailable")}})
+		_, err := ai.Ask(ctx, "describe a cat", nil, nil, &runner)
+		assert.ErrorContains(t, err, "503")
+	})
+	t.Run("the next member catches up with the conversation", func(t *testing.T) {
+		first := &flakyAi{answers: 1, err: quotaErr}
+		second := NewDummyAi()
+		ai := NewFallbackAi(FallbackMember{Name: "first", Ai: first}, FallbackMember{Name: "second", Ai: second})
+		_, err := ai.Ask(ctx, "describe a cat", nil, nil, &runner)
+		assert.NoError(t, err)
+		assert.Equal(t, "first", ai.Engine())
+		_, err = ai.Ask(ctx, "describe a dog", nil, nil, &runner)
+		assert.NoError(t, err)
+		assert.Equal(t, "second", ai.Engine())
+		assert.Len(t, second.History, 2)
+		assert.Equal(t, "describe a cat", second.History[0].Text)
+		assert.Equal(t, "describe a dog", second.History[1].Text)
+		assert.Len(t, first.History, 1)
+	})
+	t.Run("new instances start from the first member", func(t *testing.T) {
+		ai := NewFallbackAi(FallbackMember{Name: "first", Ai: NewDummyAi()},
+			FallbackMember{Name: "second", Ai: NewDummyAi()})
+		ai.active = 1
+		newAi := ai.New().(*FallbackAi)
+		assert.Equal(t, 0, newAi.active)
+		assert.Len(t, newAi.members, 2)
+	})
+}
+
+func TestRunner_AiFallbacks(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+ai:
+  engine: flaky
+  model: small
+  fallbacks:
+    - engine: stable
+      model: large
+sessions:
+  one:
+    prompt: describe a cat
+  two:
+    prompt: describe a dog
+    ai:
+      engine: stable
+schema:
+  properties:
+    cat:
+      type: string
+      x-session: one
+    dog:
+      type: string
+      x-session: two
+`)))
+	factories := AiFactories{
+		"flaky": func(config AiConfig) (Ai, error) {
+			return &flakyAi{err: errors.New("model is overloaded")}, nil
+		},
+		"stable": func(config AiConfig) (Ai, error) {
+			return NewDummyAi(), nil
+		},
+	}
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithAiFactories(factories))
+	_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	report := runner.Usage()
+	assert.Equal(t, map[string]map[int]string{"one": {0: "stable/large"}}, report.Engines)
+}
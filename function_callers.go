@@ -42,7 +42,7 @@ type FunctionCaller struct {
 	Code        *string                    `yaml:"code" json:"code"`
 	Args        map[string]any             `yaml:"args" json:"args"`
 	Description *string                    `yaml:"description" json:"description"`
-	In          *FunctionCallDestination   `yaml:"in" json:"in" validate:"omitempty,oneof=ai vars context"`
+	In          *FunctionCallDestination   `yaml:"in" json:"in" validate:"omitempty,oneof=ai vars context db"`
 	Var         *string                    `yaml:"var" json:"var"`
 	Func        FunctionCallerCallbackFunc `yaml:"-" json:"-"`
 }
@@ -108,6 +108,9 @@ func (r *Runner) runFunctionCaller(ctx *util.FragsContext, fc FunctionCaller, sc
 	if err != nil {
 		return nil, err
 	}
+	if r.dryRun && r.stubPreCalls {
+		return stubFunctionCall(clonedFc), nil
+	}
 	if fc.Func != nil {
 		return fc.Func(ctx, clonedFc.Args)
 	} else if fc.Code != nil {
@@ -55,6 +55,7 @@ type Ai struct {
 	content      []*genai.Content
 	Functions    frags.ExternalFunctions
 	config       Config
+	usage        util.Usage
 }
 
 type Config struct {
@@ -126,7 +127,11 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		ct = textContentType
 		genAiSchema = nil
 	} else {
-		if err := sx.CopyTo(genAiSchema); err != nil {
+		downleveled, err := frags.DownlevelSchema(runner, engine, sx, schema.GeminiDialect)
+		if err != nil {
+			return nil, err
+		}
+		if err := downleveled.CopyTo(genAiSchema); err != nil {
 			return nil, err
 		}
 	}
@@ -198,6 +203,7 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		}); err != nil {
 			return nil, err
 		}
+		d.trackUsage(res.UsageMetadata)
 		d.content = append(d.content, res.Candidates[0].Content)
 		if res.FunctionCalls() != nil && len(res.FunctionCalls()) > 0 {
 			// It seems that if function calls are more than one, Gemini expects all the responses in one content,
@@ -233,6 +239,25 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 	return []byte(out), err
 }
 
+// trackUsage adds the usage metadata of a response to the usage of the instance. Gemini counts thoughts apart from
+// the candidates, so they're added to the output.
+func (d *Ai) trackUsage(metadata *genai.GenerateContentResponseUsageMetadata) {
+	if metadata == nil {
+		return
+	}
+	d.usage = d.usage.Add(util.Usage{
+		Input:     int64(metadata.PromptTokenCount + metadata.ToolUsePromptTokenCount),
+		Output:    int64(metadata.CandidatesTokenCount + metadata.ThoughtsTokenCount),
+		Cached:    int64(metadata.CachedContentTokenCount),
+		Reasoning: int64(metadata.ThoughtsTokenCount),
+	})
+}
+
+// Usage returns the tokens used by this instance, according to the frags.UsageTracker interface
+func (d *Ai) Usage() util.ModelUsage {
+	return util.ModelUsage{d.config.Model: d.usage}
+}
+
 func (d *Ai) configureTools(tools frags.ToolDefinitions) ([]*genai.Tool, error) {
 	tx := make([]*genai.Tool, 0)
 	fd := make([]*genai.FunctionDeclaration, 0)
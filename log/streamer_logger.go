@@ -26,6 +26,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/theirish81/frags/util"
 )
 
 type EventType string
@@ -37,6 +38,9 @@ const LoadEventType EventType = "load"
 const ErrorEventType EventType = "error"
 const ResultEventType EventType = "result"
 const AuthEventType EventType = "auth"
+const UsageEventType EventType = "usage"
+const CacheEventType EventType = "cache"
+const RateLimitEventType EventType = "rateLimit"
 
 type EventComponent string
 
@@ -58,6 +62,7 @@ const InfoChannelLevel ChannelLevel = "info"
 
 type Event struct {
 	Level       string         `json:"level"`
+	Namespace   *string        `json:"namespace,omitempty"`
 	Component   EventComponent `json:"component"`
 	ID          string         `json:"id"`
 	Type        EventType      `json:"type"`
@@ -67,10 +72,12 @@ type Event struct {
 	Resource    *string        `json:"resource,omitempty"`
 	Phase       *int           `json:"phase,omitempty"`
 	Iteration   *int           `json:"iteration,omitempty"`
+	Round       *int           `json:"round,omitempty"`
 	Content     *any           `json:"content,omitempty"`
 	Function    *string        `json:"function,omitempty"`
 	Transformer *string        `json:"transformer,omitempty"`
 	Engine      *string        `json:"engine,omitempty"`
+	Usage       *util.Usage    `json:"usage,omitempty"`
 	Err         *EventError    `json:"error,omitempty"`
 	Args        map[string]any `json:"args,omitempty"`
 }
@@ -121,6 +128,11 @@ func (e Event) WithIteration(iteration int) Event {
 	return e
 }
 
+func (e Event) WithRound(round int) Event {
+	e.Round = &round
+	return e
+}
+
 func (e Event) WithErr(err error) Event {
 	e.Err = &EventError{Message: err.Error()}
 	return e
@@ -150,6 +162,11 @@ func (e Event) WithEngine(engine string) Event {
 	return e
 }
 
+func (e Event) WithUsage(usage util.Usage) Event {
+	e.Usage = &usage
+	return e
+}
+
 func (e Event) WithLevel(level string) Event {
 	e.Level = level
 	return e
@@ -206,6 +223,7 @@ type StreamerLogger struct {
 	progressChannel chan Event
 	logger          *slog.Logger
 	channelLevel    ChannelLevel
+	namespace       string
 }
 
 func NewStreamerLogger(logger *slog.Logger, channel chan Event, channelLevel ChannelLevel) *StreamerLogger {
@@ -216,6 +234,20 @@ func NewStreamerLogger(logger *slog.Logger, channel chan Event, channelLevel Cha
 	}
 }
 
+// WithNamespace returns a logger writing to the same logger and channel, that marks its events with the namespace.
+// Namespaces nest, so the namespace of a namespaced logger is appended to its own, separated by a slash.
+func (l *StreamerLogger) WithNamespace(namespace string) *StreamerLogger {
+	if l.namespace != "" {
+		namespace = l.namespace + "/" + namespace
+	}
+	return &StreamerLogger{
+		progressChannel: l.progressChannel,
+		logger:          l.logger,
+		channelLevel:    l.channelLevel,
+		namespace:       namespace,
+	}
+}
+
 func (l *StreamerLogger) SetChannel(channel chan Event, level ChannelLevel) {
 	l.progressChannel = channel
 	l.channelLevel = level
@@ -237,6 +269,7 @@ func (l *StreamerLogger) Logger() *slog.Logger {
 
 func (l *StreamerLogger) Debug(event Event) {
 	event.Level = "debug"
+	event = l.withNamespace(event)
 	l.logger.Debug(event.Message, event.ToArray()...)
 	if l.channelLevel == DebugChannelLevel {
 		l.Send(event)
@@ -245,22 +278,33 @@ func (l *StreamerLogger) Debug(event Event) {
 
 func (l *StreamerLogger) Info(event Event) {
 	event.Level = "info"
+	event = l.withNamespace(event)
 	l.logger.Info(event.Message, event.ToArray()...)
 	l.Send(event)
 }
 
 func (l *StreamerLogger) Warn(event Event) {
 	event.Level = "warn"
+	event = l.withNamespace(event)
 	l.logger.Warn(event.Message, event.ToArray()...)
 	l.Send(event)
 }
 
 func (l *StreamerLogger) Err(event Event) {
 	event.Level = "err"
+	event = l.withNamespace(event)
 	l.logger.Error(event.Message, event.ToArray()...)
 	l.Send(event)
 }
 
+// withNamespace marks the event with the namespace of the logger, if any
+func (l *StreamerLogger) withNamespace(event Event) Event {
+	if l.namespace != "" {
+		event.Namespace = &l.namespace
+	}
+	return event
+}
+
 func (l *StreamerLogger) Send(event Event) {
 	if l.progressChannel != nil {
 		select {
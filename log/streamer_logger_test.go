@@ -159,3 +159,19 @@ func TestStreamerLogger_Close(t *testing.T) {
 	event := NewEvent(GenericEventType, AppComponent).WithMessage("test after close")
 	streamerLogger.Info(event)
 }
+
+func TestStreamerLogger_WithNamespace(t *testing.T) {
+	ch := make(chan Event, 2)
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	streamerLogger := NewStreamerLogger(logger, ch, InfoChannelLevel)
+
+	streamerLogger.WithNamespace("parent").WithNamespace("child").Info(NewEvent(GenericEventType, AppComponent))
+	streamerLogger.Info(NewEvent(GenericEventType, AppComponent))
+
+	if receivedEvent := <-ch; receivedEvent.Namespace == nil || *receivedEvent.Namespace != "parent/child" {
+		t.Errorf("Expected namespace 'parent/child', got '%v'", receivedEvent.Namespace)
+	}
+	if receivedEvent := <-ch; receivedEvent.Namespace != nil {
+		t.Errorf("Expected no namespace, got '%s'", *receivedEvent.Namespace)
+	}
+}
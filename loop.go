@@ -0,0 +1,80 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"github.com/theirish81/frags/evaluators"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/util"
+)
+
+// DefaultLoopMaxRounds is the number of rounds of a looping session, when MaxRounds is not set.
+const DefaultLoopMaxRounds = 5
+
+// Loop makes a session repeat its prompt, in the same conversation, until a condition is met. Until is an expr
+// expression that can reference the output of the last round as `output`, and the round index as `round`. Prompts
+// can reference the same, where `output` is the output of the previous round. MaxRounds
+// caps the number of rounds, including the first one. When the cap is hit, the output of the last round is used.
+type Loop struct {
+	Until     string `json:"until" yaml:"until" validate:"required"`
+	MaxRounds int    `json:"maxRounds,omitempty" yaml:"maxRounds,omitempty" validate:"omitempty,min=1"`
+}
+
+// maxRounds returns the maximum number of rounds of the loop
+func (l Loop) maxRounds() int {
+	if l.MaxRounds > 0 {
+		return l.MaxRounds
+	}
+	return DefaultLoopMaxRounds
+}
+
+// runLoop repeats the prompt of a looping session until its condition is met, starting from the output of the first
+// round. Every round sees the output of the previous one in scope, and the output of the last round is returned.
+func (r *Runner) runLoop(ctx *util.FragsContext, ai Ai, sessionID string, session Session, iteratorIdx int,
+	scope evaluators.EvalScope, output promptOutput) (promptOutput, error) {
+	for round := 0; ; round++ {
+		r.updateState(sessionID, func(s *SessionState) {
+			s.Round = &round
+		})
+		scope = scope.WithOutput(output.value)
+		done, err := evaluators.EvaluateBooleanExpression(session.Loop.Until, scope)
+		if err != nil {
+			r.logger.Err(log.NewEvent(log.ErrorEventType, log.SessionComponent).
+				WithMessage("failed to evaluate loop condition").WithErr(err).WithSession(sessionID).
+				WithIteration(iteratorIdx).WithRound(round))
+			return output, err
+		}
+		if done {
+			r.logger.Info(log.NewEvent(log.EndEventType, log.SessionComponent).WithMessage("loop condition met").
+				WithSession(sessionID).WithIteration(iteratorIdx).WithRound(round))
+			return output, nil
+		}
+		if round+1 >= session.Loop.maxRounds() {
+			r.logger.Warn(log.NewEvent(log.GenericEventType, log.SessionComponent).
+				WithMessage("loop condition not met after the maximum number of rounds").WithSession(sessionID).
+				WithIteration(iteratorIdx).WithRound(round))
+			return output, nil
+		}
+		r.logger.Info(log.NewEvent(log.StartEventType, log.SessionComponent).WithMessage("starting a new round").
+			WithSession(sessionID).WithIteration(iteratorIdx).WithRound(round + 1))
+		scope[evaluators.RoundAttr] = round + 1
+		if output, err = r.runPrompt(ctx, ai, sessionID, session, iteratorIdx, round+1, scope, nil, nil); err != nil {
+			return output, err
+		}
+	}
+}
@@ -41,7 +41,9 @@ type FunctionDef struct {
 
 // Response represents a response from Ollama
 type Response struct {
-	Message Message `json:"message"`
+	Message         Message `json:"message"`
+	PromptEvalCount int64   `json:"prompt_eval_count"`
+	EvalCount       int64   `json:"eval_count"`
 }
 
 type ToolCall struct {
@@ -34,6 +34,7 @@ type Ai struct {
 	messages     []Message
 	systemPrompt string
 	Functions    frags.ExternalFunctions
+	usage        util.Usage
 }
 
 type Config struct {
@@ -108,6 +109,10 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		message.Content += message.Content + " === " + r.Identifier + " === \n" + string(r.ByteContent) + "\n===\n"
 		runner.Logger().Debug(log.NewEvent(log.LoadEventType, log.AiComponent).WithMessage("adding file resource").WithEngine(engine).WithResource(r.Identifier))
 	}
+	format, err := frags.DownlevelSchema(runner, engine, sx, schema.OllamaDialect)
+	if err != nil {
+		return nil, err
+	}
 	useThinking := strings.HasPrefix(text, "/think")
 	message.Content += "\n" + text
 	d.messages = append(d.messages, message)
@@ -115,7 +120,7 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 		Messages: d.messages,
 		Model:    d.config.Model,
 		Think:    useThinking,
-		Format:   sx,
+		Format:   format,
 		Tools:    make([]ToolDefinition, 0),
 		Options: Options{
 			NumPredict:  d.config.NumPredict,
@@ -136,6 +141,7 @@ func (d *Ai) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools f
 			if err != nil {
 				return err
 			}
+			d.usage = d.usage.Add(util.Usage{Input: responseMessage.PromptEvalCount, Output: responseMessage.EvalCount})
 			d.messages = append(d.messages, responseMessage.Message)
 			if len(responseMessage.Message.ToolCalls) > 0 {
 				err := d.handleFunctionCall(ctx, responseMessage, runner)
@@ -265,3 +271,8 @@ func (d *Ai) configureTools(tools frags.ToolDefinitions) ([]ToolDefinition, erro
 func (d *Ai) RunFunction(ctx *util.FragsContext, functionCall frags.FunctionCaller, runner frags.ExportableRunner) (any, error) {
 	return runner.RunFunction(ctx, functionCall.Name, functionCall.Args)
 }
+
+// Usage returns the tokens used by this instance, according to the frags.UsageTracker interface
+func (d *Ai) Usage() util.ModelUsage {
+	return util.ModelUsage{d.config.Model: d.usage}
+}
@@ -0,0 +1,102 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+const defaultRepairRounds = 2
+
+// OutputValidationError is returned when the output of a prompt still doesn't match the session schema after all the
+// repair rounds.
+type OutputValidationError struct {
+	SessionID string
+	Errors    []*schema.ValidationError
+}
+
+func (e OutputValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("output of session %s does not match the schema: %s", e.SessionID, strings.Join(messages, "; "))
+}
+
+// validateOutput validates the output of a prompt against the session schema. If it doesn't match, the AI is asked
+// to fix it, in the same conversation, up to the configured number of repair rounds. It returns the valid output.
+func (r *Runner) validateOutput(ctx *util.FragsContext, ai Ai, sessionID string, session Session, iteratorIdx int,
+	sessionSchema *schema.Schema, data []byte) ([]byte, error) {
+	// dry runs answer with placeholders, so there's nothing worth validating, and a repair would only add fake
+	// interactions to the dry run
+	if r.dryRun {
+		return data, nil
+	}
+	rounds := r.repairRounds
+	if session.RepairRounds != nil {
+		rounds = *session.RepairRounds
+	}
+	for round := 1; ; round++ {
+		validationErrors := validateAgainstSchema(sessionSchema, data)
+		if len(validationErrors) == 0 {
+			return data, nil
+		}
+		if round > rounds {
+			return data, OutputValidationError{SessionID: sessionID, Errors: validationErrors}
+		}
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.PromptComponent).
+			WithMessage("output does not match the schema, asking for a repair").WithSession(sessionID).
+			WithIteration(iteratorIdx).WithArg("round", round).
+			WithErr(OutputValidationError{SessionID: sessionID, Errors: validationErrors}))
+		var err error
+		if data, err = r.ask(ctx, ai, sessionID, iteratorIdx, repairPrompt(validationErrors), sessionSchema,
+			ToolDefinitions{}); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// validateAgainstSchema parses the output and validates it against the schema, returning all the violations
+func validateAgainstSchema(sx *schema.Schema, data []byte) []*schema.ValidationError {
+	var value any
+	if err := json.Unmarshal(data, &value); err != nil {
+		return []*schema.ValidationError{{Message: fmt.Sprintf("the output is not valid JSON: %s", err.Error())}}
+	}
+	return sx.ValidateAll(value, nil)
+}
+
+// repairPrompt is the follow-up message asking the AI to fix an output that doesn't match the schema
+func repairPrompt(validationErrors []*schema.ValidationError) string {
+	sb := strings.Builder{}
+	sb.WriteString("Your answer does not match the provided JSON schema. These are the problems:\n")
+	for _, err := range validationErrors {
+		path := err.Path
+		if path == "" {
+			path = "(root)"
+		}
+		sb.WriteString(fmt.Sprintf("- %s: %s\n", path, err.Message))
+	}
+	sb.WriteString("Answer again with the complete JSON, fixing these problems.")
+	return sb.String()
+}
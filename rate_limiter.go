@@ -0,0 +1,235 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// RateLimits are the limits of the requests to an AI provider. Zero values mean no limit.
+type RateLimits struct {
+	RequestsPerMinute int   `json:"requestsPerMinute,omitempty" yaml:"requestsPerMinute,omitempty"`
+	TokensPerMinute   int64 `json:"tokensPerMinute,omitempty" yaml:"tokensPerMinute,omitempty"`
+	MaxConcurrent     int   `json:"maxConcurrent,omitempty" yaml:"maxConcurrent,omitempty"`
+}
+
+// IsZero returns true if no limit is set
+func (l RateLimits) IsZero() bool {
+	return l == RateLimits{}
+}
+
+// RateLimit is the name of a rate limit, as reported in the events
+type RateLimit string
+
+const (
+	RequestsPerMinuteRateLimit RateLimit = "requestsPerMinute"
+	TokensPerMinuteRateLimit   RateLimit = "tokensPerMinute"
+	MaxConcurrentRateLimit     RateLimit = "maxConcurrent"
+)
+
+// tokenSpend is the number of tokens an interaction used, and when it ended
+type tokenSpend struct {
+	at     time.Time
+	tokens int64
+}
+
+// RateLimiter enforces RateLimits over sliding windows of one minute. It is safe for concurrent use, and meant to be
+// shared by all the AIs talking to the same provider.
+// Tokens are only known once an interaction is over, so the tokens per minute limit holds new requests until the
+// tokens used in the last minute fall below the limit.
+type RateLimiter struct {
+	limits   RateLimits
+	window   time.Duration
+	mutex    sync.Mutex
+	requests []time.Time
+	tokens   []tokenSpend
+	slots    chan struct{}
+}
+
+// NewRateLimiter returns a RateLimiter enforcing the limits
+func NewRateLimiter(limits RateLimits) *RateLimiter {
+	limiter := &RateLimiter{limits: limits, window: time.Minute}
+	if limits.MaxConcurrent > 0 {
+		limiter.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	return limiter
+}
+
+// Acquire waits until the limits allow a new request. onWait, if not nil, is invoked every time the request has to
+// wait, with the limit that holds it and the expected wait, which is zero if unknown. The returned function must be
+// invoked once the request is over, with the tokens it used.
+func (l *RateLimiter) Acquire(ctx context.Context, onWait func(limit RateLimit, wait time.Duration)) (func(tokens int64), error) {
+	if l.slots != nil {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			if onWait != nil {
+				onWait(MaxConcurrentRateLimit, 0)
+			}
+			select {
+			case l.slots <- struct{}{}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+	}
+	for {
+		l.mutex.Lock()
+		limit, wait := l.delay(time.Now())
+		if wait <= 0 {
+			l.requests = append(l.requests, time.Now())
+			l.mutex.Unlock()
+			break
+		}
+		l.mutex.Unlock()
+		if onWait != nil {
+			onWait(limit, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			l.releaseSlot()
+			return nil, ctx.Err()
+		}
+	}
+	return func(tokens int64) {
+		if tokens > 0 {
+			l.mutex.Lock()
+			l.tokens = append(l.tokens, tokenSpend{at: time.Now(), tokens: tokens})
+			l.mutex.Unlock()
+		}
+		l.releaseSlot()
+	}, nil
+}
+
+// releaseSlot frees a concurrent request slot, if the concurrency is limited
+func (l *RateLimiter) releaseSlot() {
+	if l.slots != nil {
+		<-l.slots
+	}
+}
+
+// delay drops what fell out of the window, and returns how long a new request has to wait, and because of which
+// limit. It must be invoked holding the mutex.
+func (l *RateLimiter) delay(now time.Time) (RateLimit, time.Duration) {
+	start := now.Add(-l.window)
+	for len(l.requests) > 0 && !l.requests[0].After(start) {
+		l.requests = l.requests[1:]
+	}
+	for len(l.tokens) > 0 && !l.tokens[0].at.After(start) {
+		l.tokens = l.tokens[1:]
+	}
+	if l.limits.RequestsPerMinute > 0 && len(l.requests) >= l.limits.RequestsPerMinute {
+		return RequestsPerMinuteRateLimit, l.requests[len(l.requests)-l.limits.RequestsPerMinute].Sub(start)
+	}
+	if l.limits.TokensPerMinute > 0 {
+		var used int64
+		for _, t := range l.tokens {
+			used += t.tokens
+		}
+		// we wait until enough of the oldest spends fall out of the window
+		for _, t := range l.tokens {
+			if used < l.limits.TokensPerMinute {
+				break
+			}
+			used -= t.tokens
+			if used < l.limits.TokensPerMinute {
+				return TokensPerMinuteRateLimit, t.at.Sub(start)
+			}
+		}
+	}
+	return "", 0
+}
+
+// RateLimitedAi is an Ai decorator that holds the requests until the RateLimiter allows them. All the instances created
+// with New share the same RateLimiter. Each interaction counts as one request, even when the AI calls tools.
+type RateLimitedAi struct {
+	ai      Ai
+	name    string
+	limiter *RateLimiter
+}
+
+// NewRateLimitedAi returns a RateLimitedAi wrapping the AI. Name identifies the provider in the events.
+func NewRateLimitedAi(ai Ai, name string, limiter *RateLimiter) *RateLimitedAi {
+	return &RateLimitedAi{ai: ai, name: name, limiter: limiter}
+}
+
+// Ask waits for the rate limiter, then asks the AI, according to the Frags interface
+func (a *RateLimitedAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	release, err := a.limiter.Acquire(ctx, func(limit RateLimit, wait time.Duration) {
+		event := log.NewEvent(log.RateLimitEventType, log.AiComponent).WithMessage("waiting for the rate limit").
+			WithArg("limit", limit)
+		if a.name != "" {
+			event = event.WithEngine(a.name)
+		}
+		if wait > 0 {
+			event = event.WithArg("wait", wait.String())
+		}
+		runner.Logger().Info(event)
+	})
+	if err != nil {
+		return nil, err
+	}
+	before := a.Usage()
+	data, err := a.ai.Ask(ctx, text, sx, tools, runner, rx...)
+	release(a.Usage().Sub(before).Total().Total())
+	return data, err
+}
+
+// New creates a new RateLimitedAi, sharing the same RateLimiter
+func (a *RateLimitedAi) New() Ai {
+	return NewRateLimitedAi(a.ai.New(), a.name, a.limiter)
+}
+
+func (a *RateLimitedAi) SetFunctions(functions ExternalFunctions) {
+	a.ai.SetFunctions(functions)
+}
+
+func (a *RateLimitedAi) SetSystemPrompt(systemPrompt string) {
+	a.ai.SetSystemPrompt(systemPrompt)
+}
+
+func (a *RateLimitedAi) RunFunction(ctx *util.FragsContext, functionCall FunctionCaller, runner ExportableRunner) (any, error) {
+	return a.ai.RunFunction(ctx, functionCall, runner)
+}
+
+// Usage returns the tokens used by the wrapped AI
+func (a *RateLimitedAi) Usage() util.ModelUsage {
+	if tracker, ok := a.ai.(UsageTracker); ok {
+		return tracker.Usage()
+	}
+	return util.ModelUsage{}
+}
+
+// Engine returns the engine of the wrapped AI that answered the last interaction, if it's an EngineReporter
+func (a *RateLimitedAi) Engine() string {
+	if reporter, ok := a.ai.(EngineReporter); ok {
+		return reporter.Engine()
+	}
+	return ""
+}
@@ -0,0 +1,151 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestRateLimiter(t *testing.T) {
+	newLimiter := func(limits RateLimits) *RateLimiter {
+		limiter := NewRateLimiter(limits)
+		limiter.window = 200 * time.Millisecond
+		return limiter
+	}
+
+	t.Run("requests per minute", func(t *testing.T) {
+		limiter := newLimiter(RateLimits{RequestsPerMinute: 2})
+		waits := make([]RateLimit, 0)
+		onWait := func(limit RateLimit, _ time.Duration) {
+			waits = append(waits, limit)
+		}
+		start := time.Now()
+		for i := 0; i < 3; i++ {
+			release, err := limiter.Acquire(t.Context(), onWait)
+			assert.NoError(t, err)
+			release(0)
+		}
+		assert.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond)
+		assert.Equal(t, []RateLimit{RequestsPerMinuteRateLimit}, waits)
+	})
+	t.Run("tokens per minute", func(t *testing.T) {
+		limiter := newLimiter(RateLimits{TokensPerMinute: 100})
+		release, err := limiter.Acquire(t.Context(), nil)
+		assert.NoError(t, err)
+		release(150)
+		waits := make([]RateLimit, 0)
+		start := time.Now()
+		release, err = limiter.Acquire(t.Context(), func(limit RateLimit, wait time.Duration) {
+			waits = append(waits, limit)
+			assert.Greater(t, wait, time.Duration(0))
+		})
+		assert.NoError(t, err)
+		release(0)
+		assert.GreaterOrEqual(t, time.Since(start), 150*time.Millisecond)
+		assert.Equal(t, []RateLimit{TokensPerMinuteRateLimit}, waits)
+	})
+	t.Run("max concurrent", func(t *testing.T) {
+		limiter := newLimiter(RateLimits{MaxConcurrent: 1})
+		release, err := limiter.Acquire(t.Context(), nil)
+		assert.NoError(t, err)
+		go func() {
+			time.Sleep(100 * time.Millisecond)
+			release(0)
+		}()
+		waits := make([]RateLimit, 0)
+		start := time.Now()
+		release, err = limiter.Acquire(t.Context(), func(limit RateLimit, _ time.Duration) {
+			waits = append(waits, limit)
+		})
+		assert.NoError(t, err)
+		release(0)
+		assert.GreaterOrEqual(t, time.Since(start), 100*time.Millisecond)
+		assert.Equal(t, []RateLimit{MaxConcurrentRateLimit}, waits)
+	})
+	t.Run("cancelled waits fail", func(t *testing.T) {
+		limiter := newLimiter(RateLimits{MaxConcurrent: 1})
+		_, err := limiter.Acquire(t.Context(), nil)
+		assert.NoError(t, err)
+		ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+		defer cancel()
+		_, err = limiter.Acquire(ctx, nil)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+	})
+}
+
+func TestRunner_RunRateLimits(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/concurrent_iterations.yaml")
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML(sessionData))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(),
+		WithRateLimits(RateLimits{MaxConcurrent: 2}))
+	start := time.Now()
+	out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	assert.Len(t, out["describe"], 4)
+	// each iteration takes 1 second, and only two can run at the same time
+	assert.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+	assert.Positive(t, runner.Usage().Total.Total())
+}
+
+func TestRunner_RunRateLimitsSharedWithFactories(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  default:
+    prompt: describe a cat
+  selected:
+    prompt: describe a dog
+    ai:
+      engine: dummy
+`)))
+	factories := AiFactories{"dummy": func(_ AiConfig) (Ai, error) {
+		return NewDummyAi(), nil
+	}}
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithSessionWorkers(2),
+		WithAiFactories(factories), WithAiEngine("dummy"), WithRateLimits(RateLimits{MaxConcurrent: 1}))
+	start := time.Now()
+	_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	// both sessions use the dummy engine, so they share the limiter and can't ask at the same time
+	assert.GreaterOrEqual(t, time.Since(start), 2*time.Second)
+}
+
+func TestRunner_RunRateLimitsReportEngines(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+`)))
+	ai := NewFallbackAi(FallbackMember{Name: "first", Ai: &flakyAi{err: errors.New("quota exceeded")}},
+		FallbackMember{Name: "second", Ai: NewDummyAi()})
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai, WithRateLimits(RateLimits{MaxConcurrent: 1}))
+	_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	// the limiter wraps the fallback AI, but the engine that answered is still reported
+	assert.Equal(t, map[string]map[int]string{"one": {0: "second"}}, runner.Usage().Engines)
+}
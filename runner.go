@@ -18,16 +18,20 @@
 package frags
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"maps"
 	"os"
 	"regexp"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/avast/retry-go/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/theirish81/frags/checkpoints"
 	"github.com/theirish81/frags/evaluators"
 	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
@@ -48,6 +52,7 @@ type ExportableRunner interface {
 type Runner struct {
 	sessionManager    SessionManager
 	status            *SafeMap[string, SessionStatus]
+	sessionErrors     *SafeMap[string, error]
 	resourceLoader    resources.ResourceLoader
 	ai                Ai
 	dataStructure     util.ProgMap
@@ -55,8 +60,8 @@ type Runner struct {
 	marshalingMutex   sync.Mutex
 	statusMutex       sync.Mutex
 	sessionChan       chan sessionTask
+	sessionDone       chan string
 	sessionWorkers    int
-	wg                sync.WaitGroup
 	running           bool
 	logger            *log.StreamerLogger
 	scriptEngine      ScriptEngine
@@ -65,6 +70,36 @@ type Runner struct {
 	ExternalFunctions ExternalFunctions
 	ToolsDefinitions  ToolDefinitions
 	db                *zealql.Database
+	checkpointStore   checkpoints.Store
+	checkpointID      string
+	checkpoint        *checkpoints.Checkpoint
+	checkpointMutex   sync.Mutex
+	repairRounds      int
+	usage             map[string]map[int]util.ModelUsage
+	usageMutex        sync.Mutex
+	engines           map[string]map[int]string
+	priceTable        util.PriceTable
+	budget            Budget
+	budgetMutex       sync.Mutex
+	toolCalls         int
+	budgetCancel      func(error)
+	dryRun            bool
+	stubPreCalls      bool
+	systemPrompt      string
+	dryRunCalls       []DryRunCall
+	dryRunMutex       sync.Mutex
+	aiFactories       AiFactories
+	rateLimits        RateLimits
+	rateLimiters      map[string]*RateLimiter
+	rateLimitersMutex sync.Mutex
+	stateMutex        sync.Mutex
+	sessionStates     map[string]*SessionState
+	paused            bool
+	dispatchResumed   chan struct{}
+	sessionCancels    map[string]func(error)
+	cancelledSessions map[string]bool
+	plans             map[string]SessionManager
+	parent            *parentRun
 }
 
 // SessionStatus is the status of a session.
@@ -72,12 +107,13 @@ type SessionStatus string
 
 // Session statuses.
 const (
-	queuedSessionStatus    = SessionStatus("queued")
-	committedSessionStatus = SessionStatus("committed")
-	runningSessionStatus   = SessionStatus("running")
-	finishedSessionStatus  = SessionStatus("finished")
-	failedSessionStatus    = SessionStatus("failed")
-	noOpSessionStatus      = SessionStatus("noop")
+	QueuedSessionStatus    = SessionStatus("queued")
+	CommittedSessionStatus = SessionStatus("committed")
+	RunningSessionStatus   = SessionStatus("running")
+	FinishedSessionStatus  = SessionStatus("finished")
+	FailedSessionStatus    = SessionStatus("failed")
+	NoOpSessionStatus      = SessionStatus("noop")
+	FallbackSessionStatus  = SessionStatus("fallback")
 )
 
 // sessionTask is a message to run a session.
@@ -96,6 +132,17 @@ type RunnerOptions struct {
 	externalFunctions ExternalFunctions
 	toolsDefinitions  ToolDefinitions
 	db                *zealql.Database
+	checkpointStore   checkpoints.Store
+	checkpointID      string
+	repairRounds      int
+	priceTable        util.PriceTable
+	budget            Budget
+	dryRun            bool
+	stubPreCalls      bool
+	aiFactories       AiFactories
+	aiEngine          string
+	rateLimits        RateLimits
+	plans             map[string]SessionManager
 }
 
 // RunnerOption is an option for the runner.
@@ -139,10 +186,94 @@ func WithInternalDatabase(db *zealql.Database) RunnerOption {
 	}
 }
 
+// WithCheckpointStore sets the store the runner will persist its progress to, after each session or iteration.
+func WithCheckpointStore(store checkpoints.Store) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.checkpointStore = store
+	}
+}
+
+// WithCheckpointID sets the ID of the checkpoint the runner will write. If not set, a random ID is generated.
+func WithCheckpointID(id string) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.checkpointID = id
+	}
+}
+
+// WithRepairRounds sets how many times the AI is asked to fix an output that doesn't match the session schema, before
+// the prompt fails. Sessions can override it. Defaults to 2. Zero disables the repairs, but the output is still validated.
+func WithRepairRounds(rounds int) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.repairRounds = rounds
+	}
+}
+
+// WithPriceTable sets the model prices used to estimate the cost of a run.
+func WithPriceTable(prices util.PriceTable) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.priceTable = prices
+	}
+}
+
+// WithBudget caps the resources a run can consume. If the plan has a budget too, the strictest limits apply.
+func WithBudget(budget Budget) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.budget = budget
+	}
+}
+
+// WithDryRun makes the runner render every prompt without calling the AI. The interactions the AI would have received
+// are available via Runner.DryRun, and the AI answers with placeholder data matching the schema.
+func WithDryRun(dryRun bool) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.dryRun = dryRun
+	}
+}
+
+// WithStubbedPreCalls makes a dry run skip the functions of preCalls and postCalls, which return a placeholder result
+// instead.
+func WithStubbedPreCalls(stub bool) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.stubPreCalls = stub
+	}
+}
+
+// WithAiFactories registers the factories of the AI engines sessions can select with their ai block.
+func WithAiFactories(factories AiFactories) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.aiFactories = factories
+	}
+}
+
+// WithAiEngine tells the engine of the AI the runner is created with. With rate limits, the AI shares the limiter of
+// the AIs the AiFactories create for the same engine.
+func WithAiEngine(engine string) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.aiEngine = engine
+	}
+}
+
+// WithRateLimits limits the requests to the AI providers. Each engine of the AiFactories is limited separately, and
+// the AI the runner is created with shares the limits of its engine (see WithAiEngine). Without an engine, it has
+// limits of its own. The limits are shared by all the workers and iterations.
+func WithRateLimits(limits RateLimits) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.rateLimits = limits
+	}
+}
+
+// WithPlans registers the plans sessions can run as sub-plans, by name.
+func WithPlans(plans map[string]SessionManager) RunnerOption {
+	return func(o *RunnerOptions) {
+		o.plans = plans
+	}
+}
+
 // NewRunner creates a new runner.
 func NewRunner(sessionManager SessionManager, resourceLoader resources.ResourceLoader, ai Ai, options ...RunnerOption) Runner {
 	opts := RunnerOptions{
 		sessionWorkers: 1,
+		repairRounds:   defaultRepairRounds,
 		logger: log.NewStreamerLogger(slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
 			Level: slog.LevelDebug,
 		})), nil, log.DebugChannelLevel),
@@ -150,13 +281,19 @@ func NewRunner(sessionManager SessionManager, resourceLoader resources.ResourceL
 	for _, opt := range options {
 		opt(&opts)
 	}
+	rateLimiters := make(map[string]*RateLimiter)
+	if !opts.rateLimits.IsZero() {
+		rateLimiters[opts.aiEngine] = NewRateLimiter(opts.rateLimits)
+		ai = NewRateLimitedAi(ai, opts.aiEngine, rateLimiters[opts.aiEngine])
+	}
 	status := NewSafeMap[string, SessionStatus]()
 	for k, _ := range sessionManager.Sessions.Iter() {
-		status.Store(k, queuedSessionStatus)
+		status.Store(k, QueuedSessionStatus)
 	}
 	return Runner{
 		sessionManager:    sessionManager,
 		status:            status,
+		sessionErrors:     NewSafeMap[string, error](),
 		resourceLoader:    resourceLoader,
 		ai:                ai,
 		marshalingMutex:   sync.Mutex{},
@@ -169,11 +306,43 @@ func NewRunner(sessionManager SessionManager, resourceLoader resources.ResourceL
 		ToolsDefinitions:  opts.toolsDefinitions,
 		vars:              make(evaluators.Vars),
 		db:                opts.db,
+		checkpointStore:   opts.checkpointStore,
+		checkpointID:      opts.checkpointID,
+		repairRounds:      opts.repairRounds,
+		usage:             make(map[string]map[int]util.ModelUsage),
+		engines:           make(map[string]map[int]string),
+		priceTable:        opts.priceTable,
+		budget:            opts.budget,
+		dryRun:            opts.dryRun,
+		stubPreCalls:      opts.stubPreCalls,
+		aiFactories:       opts.aiFactories,
+		rateLimits:        opts.rateLimits,
+		rateLimiters:      rateLimiters,
+		sessionStates:     make(map[string]*SessionState),
+		dispatchResumed:   make(chan struct{}, 1),
+		sessionCancels:    make(map[string]func(error)),
+		cancelledSessions: make(map[string]bool),
+		plans:             opts.plans,
 	}
 }
 
 // Run runs the runner against an optional collection fo parameters
 func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
+	return r.run(ctx, params, nil)
+}
+
+// Resume resumes an interrupted run from a checkpoint. Sessions that were already finished are not run again, and
+// sessions with an iterator skip the iterations that were already completed. The parameters, data and vars of the
+// original run are restored from the checkpoint.
+func (r *Runner) Resume(ctx *util.FragsContext, checkpoint *checkpoints.Checkpoint) (util.ProgMap, error) {
+	if checkpoint == nil {
+		return nil, errors.New("cannot resume from a nil checkpoint")
+	}
+	return r.run(ctx, checkpoint.Params, checkpoint)
+}
+
+// run runs the runner, optionally restoring the state of a previous run from a checkpoint
+func (r *Runner) run(ctx *util.FragsContext, params any, checkpoint *checkpoints.Checkpoint) (util.ProgMap, error) {
 	// you cannot invoke Run if an existing Run is in progress
 	if r.running {
 		return nil, errors.New("this frags instance is running")
@@ -186,6 +355,15 @@ func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
 	if err := validator.New().Struct(r.sessionManager); err != nil {
 		return nil, err
 	}
+	// static validation of the plan. Errors prevent the run from starting, while warnings are just reported
+	diagnostics := r.sessionManager.Validate()
+	for _, d := range diagnostics.Warnings() {
+		r.logger.Warn(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage(d.Message).
+			WithArg("path", d.Path))
+	}
+	if diagnostics.HasErrors() {
+		return nil, PlanValidationError{Diagnostics: diagnostics.Errors()}
+	}
 	r.params = params
 
 	// checking whether the plan has input parameters required and comparing with the input params
@@ -196,11 +374,24 @@ func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
 	if err := r.checkToolsRequirements(); err != nil {
 		return nil, err
 	}
+	// checking whether the AI engines the sessions require are registered
+	if err := r.checkAiRequirements(); err != nil {
+		return nil, err
+	}
+	// from now on, the budget limits are enforced
+	stopBudget, err := r.startBudget(ctx.Cancel)
+	if err != nil {
+		return nil, err
+	}
+	defer stopBudget()
 	// initializing the session channel. This is where session tasks will be dispatched
 	r.sessionChan = make(chan sessionTask)
 	defer func() {
 		close(r.sessionChan)
 	}()
+	// initializing the done channel. This is where workers notify the scheduler that a session reached a terminal
+	// state. It's large enough to hold a notification for each session, so workers never hang on it.
+	r.sessionDone = make(chan string, len(r.sessionManager.Sessions.Order))
 
 	// sessionManager vars are copied to the runner
 	r.vars.Apply(r.sessionManager.Vars)
@@ -208,9 +399,14 @@ func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
 	// the dataStructure is instantiated. This is a more complex task than it seems, with generics
 	r.dataStructure = util.NewProgMap()
 
+	// if we're resuming, we restore the state of the previous run, otherwise we start a fresh checkpoint
+	r.resetState()
+	r.initCheckpoint(checkpoint)
+	r.dryRunCalls = make([]DryRunCall, 0)
+
 	// we resolve all the $refs
-	if err := r.sessionManager.Schema.Resolve(r.sessionManager.Components.Schemas); err != nil {
-		return r.dataStructure, errors.New("failed to resolve schema")
+	if err := r.sessionManager.Schema.ResolveWithLoader(r.sessionManager.Components.Schemas, r.resourceLoader); err != nil {
+		return r.dataStructure, fmt.Errorf("failed to resolve schema: %w", err)
 	}
 
 	// if the system prompt is available, it evaluates it and set it to the AI
@@ -220,6 +416,7 @@ func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
 			return nil, err
 		}
 		r.ai.SetSystemPrompt(systemPrompt)
+		r.systemPrompt = systemPrompt
 	}
 
 	// start all workers
@@ -233,17 +430,29 @@ func (r *Runner) Run(ctx *util.FragsContext, params any) (util.ProgMap, error) {
 		return r.dataStructure, err
 	}
 
-	// as long as all sessions have not reached a terminal state, keep scanning sessions
-	for !r.IsCompleted() {
-		// if the scan fails, we return the error and stop scanning. This will end the program
-		if err := r.scanSessions(ctx); err != nil {
-			r.logger.Err(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("failed to scan sessions").WithErr(err))
-			return r.dataStructure, err
-		}
+	// the scheduler dispatches sessions to the workers as their dependencies are met, until all sessions have
+	// reached a terminal state. If scheduling fails, we return the error. This will end the program
+	if err := r.schedule(ctx); err != nil {
+		r.logger.Err(log.NewEvent(log.ErrorEventType, log.RunnerComponent).WithMessage("failed to schedule sessions").WithErr(err))
+		r.saveCheckpoint(ctx)
+		return r.dataStructure, err
 	}
 	r.running = false
+	r.saveCheckpoint(ctx)
 	if failedSessions := r.ListFailedSessions(); len(failedSessions) > 0 {
-		return r.dataStructure, util.SessionsFailedError{FailedSessions: failedSessions, Err: ctx.Err()}
+		// if the run was cancelled, the cause is in the context. Otherwise, sessions failed with a policy that
+		// let the run proceed, and we report their errors
+		err := ctx.Err()
+		if err == nil {
+			errs := make([]error, 0, len(failedSessions))
+			for _, id := range failedSessions {
+				if sessionErr, ok := r.sessionErrors.Load(id); ok {
+					errs = append(errs, fmt.Errorf("session %s: %w", id, sessionErr))
+				}
+			}
+			err = errors.Join(errs...)
+		}
+		return r.dataStructure, util.SessionsFailedError{FailedSessions: failedSessions, Err: err}
 	}
 	return r.dataStructure, nil
 }
@@ -261,51 +470,120 @@ func (r *Runner) checkToolsRequirements() error {
 	return nil
 }
 
-// scanSessions keeps scanning sessions until completion, sending tasks to workers and orchestrating priority and
-// concurrency
-func (r *Runner) scanSessions(ctx *util.FragsContext) error {
-	r.wg = sync.WaitGroup{}
-	// listing all the sessions still in queued state
-	for k, s := range r.ListQueued().Iter() {
-		if ctx.Err() != nil {
-			return ctx.Err()
+// schedule dispatches sessions to the workers as soon as their dependencies are met. Every time a session reaches
+// a terminal state, the queued sessions are re-evaluated, so the dependents of a fast session don't have to wait for
+// unrelated slow sessions to complete. It returns when all sessions have reached a terminal state, or when the context
+// is cancelled and all the sessions in flight have returned.
+func (r *Runner) schedule(ctx *util.FragsContext) error {
+	ready := make([]sessionTask, 0)
+	inFlight := 0
+	done := ctx.Done()
+	for {
+		paused := r.isPaused()
+		if ctx.Err() == nil {
+			if paused {
+				// while the dispatch is paused, sessions stay queued, so the state doesn't report them as committed.
+				// They are evaluated again once the dispatch resumes
+				for _, t := range ready {
+					r.SetStatus(t.id, QueuedSessionStatus)
+				}
+				ready = ready[:0]
+			} else {
+				tasks, err := r.evaluateQueued()
+				if err != nil {
+					return err
+				}
+				ready = append(ready, tasks...)
+			}
 		}
-		depCheck, err := r.CheckDependencies(s.DependsOn)
-		if err != nil {
-			return err
+		// nothing is running and nothing can be dispatched: we're done. While paused, queued sessions are waiting
+		// for the dispatch to resume
+		waiting := paused && len(r.ListQueued().Order) > 0
+		if inFlight == 0 && ((len(ready) == 0 && !waiting) || ctx.Err() != nil) {
+			break
 		}
-		switch depCheck {
-		// if the dependency check fails, it means that RIGHT NOW, we cannot start this session, but we may later
-		case DependencyCheckFailed:
-			continue
-		// if the dependency check results as unsolvable, it means that we will never be able to start this session.
-		// A dependency is unsolvable in 2 different scenarios
-		// * The dependency is a session that has failed or won't run because of its dependencies
-		// * The dependency is an expression that fails
-		// We mark it as no-op, which is a terminal state for the session, and we move on.
-		case DependencyCheckUnsolvable:
-			r.SetStatus(k, noOpSessionStatus)
-			continue
+		// the dispatch case of the select is only enabled when there is something to dispatch, the context is
+		// still alive and the dispatch is not paused. A nil channel blocks forever, which disables the case.
+		var sessionChan chan sessionTask
+		var next sessionTask
+		if len(ready) > 0 && ctx.Err() == nil && !paused {
+			sessionChan = r.sessionChan
+			next = ready[0]
+		}
+		select {
+		case sessionChan <- next:
+			ready = ready[1:]
+			inFlight++
+		case id := <-r.sessionDone:
+			inFlight--
+			r.logger.Debug(log.NewEvent(log.GenericEventType, log.RunnerComponent).
+				WithMessage("session reached a terminal state, re-evaluating dependents").WithSession(id))
+		case <-r.dispatchResumed:
+			r.logger.Debug(log.NewEvent(log.GenericEventType, log.RunnerComponent).
+				WithMessage("dispatch resumed, re-evaluating sessions"))
+		case <-done:
+			// from now on we only wait for the sessions in flight to return
+			done = nil
 		}
-		// our parallelism has a layered approach. Every run of scanSessions is a layer, and we will wait for the whole
-		// layer to complete before moving on to the next layer.
-		r.wg.Add(1)
-		r.logger.Debug(log.NewEvent(log.GenericEventType, log.RunnerComponent).
-			WithMessage("sending message to workers for session").WithSession(k))
-		timeout := util.ParseDurationOrDefault(s.Timeout, 10*time.Minute)
-		r.SetStatus(k, committedSessionStatus)
-		// sending the message to the workers. If all workers are busy, we'll hang here for a while, until a worker
-		// is free, so we can complete this layer
-		r.sessionChan <- sessionTask{
-			id:      k,
-			session: s,
-			timeout: timeout,
-		}
-	}
-	r.wg.Wait()
+	}
+	if ctx.Err() != nil && (len(ready) > 0 || !r.IsCompleted()) {
+		return ctx.Err()
+	}
+	// if sessions are still queued at this point, nothing is running that could ever unlock them, which happens
+	// when the dependencies reference unknown sessions or form a cycle. We mark them as no-op, so the run can end.
+	for k := range r.ListQueued().Iter() {
+		r.logger.Warn(log.NewEvent(log.ErrorEventType, log.RunnerComponent).
+			WithMessage("session dependencies can never be met").WithSession(k))
+		r.SetStatus(k, NoOpSessionStatus)
+	}
 	return nil
 }
 
+// evaluateQueued checks the dependencies of all the queued sessions, returning the tasks for the sessions that can
+// start right away. Sessions whose dependencies can never be met are marked as no-op. As that may make the
+// dependencies of other sessions unsolvable, the evaluation is repeated until nothing changes.
+func (r *Runner) evaluateQueued() ([]sessionTask, error) {
+	tasks := make([]sessionTask, 0)
+	for changed := true; changed; {
+		changed = false
+		for k, s := range r.ListQueued().Iter() {
+			// sessions cancelled before they could start never start
+			if r.isCancelled(k) {
+				r.failCancelledSession(k)
+				changed = true
+				continue
+			}
+			depCheck, err := r.CheckDependencies(s.DependsOn)
+			if err != nil {
+				return tasks, err
+			}
+			switch depCheck {
+			// if the dependency check fails, it means that RIGHT NOW, we cannot start this session, but we may later
+			case DependencyCheckFailed:
+				continue
+			// if the dependency check results as unsolvable, it means that we will never be able to start this session.
+			// A dependency is unsolvable in 2 different scenarios
+			// * The dependency is a session that has failed or won't run because of its dependencies
+			// * The dependency is an expression that fails
+			// We mark it as no-op, which is a terminal state for the session, and we move on.
+			case DependencyCheckUnsolvable:
+				r.SetStatus(k, NoOpSessionStatus)
+				changed = true
+				continue
+			}
+			r.logger.Debug(log.NewEvent(log.GenericEventType, log.RunnerComponent).
+				WithMessage("sending message to workers for session").WithSession(k))
+			r.SetStatus(k, CommittedSessionStatus)
+			tasks = append(tasks, sessionTask{
+				id:      k,
+				session: s,
+				timeout: util.ParseDurationOrDefault(s.Timeout, 10*time.Minute),
+			})
+		}
+	}
+	return tasks, nil
+}
+
 // runSession runs a session.
 func (r *Runner) runSession(ctx *util.FragsContext, sessionID string, session Session) error {
 	if session.Vars == nil {
@@ -341,47 +619,164 @@ func (r *Runner) runSession(ctx *util.FragsContext, sessionID string, session Se
 			return err
 		}
 	}
+	r.updateState(sessionID, func(s *SessionState) {
+		s.Iterations = len(iterator)
+	})
 
+	concurrency := max(session.Concurrency, 1)
+	// the semaphore bounds the number of iterations running at the same time
+	semaphore := make(chan struct{}, concurrency)
+	wg := sync.WaitGroup{}
+	errMutex := sync.Mutex{}
+	errs := make([]error, 0)
+	failed := func() bool {
+		errMutex.Lock()
+		defer errMutex.Unlock()
+		return len(errs) > 0
+	}
+	// iterations may complete in any order, but their outputs are merged in the iterateOn order, so consumers can
+	// match them with the inputs. Each iteration closes its channel once its output is merged (or it has failed),
+	// and the next one waits for it before merging its own.
+	merged := make([]chan struct{}, len(iterator))
+	for i := range merged {
+		merged[i] = make(chan struct{})
+	}
+	first := make(chan struct{})
+	close(first)
+	previous := func(itIdx int) <-chan struct{} {
+		if itIdx == 0 {
+			return first
+		}
+		return merged[itIdx-1]
+	}
 	for itIdx, it := range iterator {
-		// here we're creating a new instance of the AI for this session, so it has no state.
-		ai := r.ai.New()
+		// if we're resuming a run, iterations that were already completed are not run again, as their output is
+		// already in the data structure.
+		if r.iterationCompleted(sessionID, itIdx) {
+			r.logger.Info(log.NewEvent(log.GenericEventType, log.SessionComponent).
+				WithMessage("iteration already completed, skipping").WithSession(sessionID).WithIteration(itIdx))
+			close(merged[itIdx])
+			continue
+		}
+		semaphore <- struct{}{}
+		// once an iteration has failed the session is doomed, so we stop dispatching new iterations and wait for
+		// the running ones to complete
+		if failed() || ctx.Err() != nil {
+			<-semaphore
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			if err := r.runIteration(ctx, sessionID, session, itIdx, it, localVars, sessionResources, aiResources,
+				previous(itIdx), merged[itIdx]); err != nil {
+				// errors are wrapped with their index only if the session is actually iterating
+				if session.IterateOn != nil {
+					err = util.IterationError{Index: itIdx, Err: err}
+				}
+				errMutex.Lock()
+				errs = append(errs, err)
+				errMutex.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	return errors.Join(errs...)
+}
 
-		// we take a reference of AI resources. This is useful because we may empty the local collection as we don't
-		// want the resources to be loaded into the AI context more than once. For example, if we have a prePrompt,
-		// that will load the resources and the prompt will not. If we only have a prompt, then ONLY the first phase
-		// will load the resources, and the rest will use them from the AI context.
-		localResources := aiResources
+// runIteration runs a single iteration of a session. Each iteration gets its own AI instance and its own copy of the
+// local variables, so iterations can run concurrently. The output is merged once the previous channel is closed, and
+// the merged channel is closed once the iteration is done with the data structure, whether it succeeded or not.
+func (r *Runner) runIteration(ctx *util.FragsContext, sessionID string, session Session, itIdx int, it any,
+	localVars evaluators.Vars, sessionResources resources.ResourceDataItems, aiResources resources.ResourceDataItems,
+	previous <-chan struct{}, merged chan struct{}) error {
+	releaseTurn := sync.OnceFunc(func() { close(merged) })
+	defer releaseTurn()
+	r.updateState(sessionID, func(s *SessionState) {
+		s.Iteration = &itIdx
+	})
+	// here we're creating a new instance of the AI for this iteration, so it has no state.
+	ai, err := r.newSessionAi(sessionID, session)
+	if err != nil {
+		return err
+	}
+	// pre-calls may write variables, so each iteration works on its own copy
+	localVars = maps.Clone(localVars)
 
-		// run all the pre-calls with CONTEXT as destination and set the results to the context
-		aiContext, err := r.RunAllFunctionCallers(ctx, session.PreCalls, r.newEvalScope().WithVars(localVars).WithIterator(it).WithDB(r.db), localVars)
-		if err != nil {
+	// we take a reference of AI resources. This is useful because we may empty the local collection as we don't
+	// want the resources to be loaded into the AI context more than once. For example, if we have a prePrompt,
+	// that will load the resources and the prompt will not. If we only have a prompt, then ONLY the first phase
+	// will load the resources, and the rest will use them from the AI context.
+	localResources := aiResources
+
+	// run all the pre-calls with CONTEXT as destination and set the results to the context
+	aiContext, err := r.RunAllFunctionCallers(ctx, session.PreCalls, r.newEvalScope().WithVars(localVars).WithIterator(it).WithDB(r.db), localVars)
+	if err != nil {
+		return err
+	}
+	scope := r.newEvalScope().WithVars(localVars).WithIterator(it)
+	var output promptOutput
+	if session.SubPlan != nil {
+		// sessions with a sub-plan don't prompt the AI themselves, the plan does
+		if output, err = r.runSubPlan(ctx, ai, sessionID, session, itIdx, scope); err != nil {
 			return err
 		}
-		scope := r.newEvalScope().WithVars(localVars).WithIterator(it)
+	} else {
+		if session.Loop != nil {
+			scope[evaluators.RoundAttr] = 0
+		}
 		if session.HasPrePrompt() {
-			// these are the resources that will be loaded into the AI context by the first prePrompt.
-			ppResources := append(localResources, sessionResources.FilterPrePromptResources()...)
-			// we reset localResources because they've already been introduced in the context by the first prePrompt.
-			// The prompt would need to include them only if the prePrompt was not present.
+			// these are the resources that will be loaded into the AI context by the first prePrompt. The slice is
+			// cloned, as appending to it would otherwise race with the other iterations.
+			ppResources := append(slices.Clone(localResources), sessionResources.FilterPrePromptResources()...)
+			// we reset localResources because they've already been introduced in the context by the first
+			// prePrompt. The prompt would need to include them only if the prePrompt was not present.
 			localResources = make(resources.ResourceDataItems, 0)
 			if err := r.runPrePrompts(ctx, ai, sessionID, session, itIdx, scope, aiContext, ppResources); err != nil {
 				return err
 			}
 		}
-		pResources := append(localResources, sessionResources.FilterPromptResources()...)
-		if err := r.runPrompt(ctx, ai, sessionID, session, itIdx, scope, aiContext, pResources); err != nil {
+		pResources := append(slices.Clone(localResources), sessionResources.FilterPromptResources()...)
+		if output, err = r.runPrompt(ctx, ai, sessionID, session, itIdx, 0, scope, aiContext, pResources); err != nil {
 			return err
 		}
+		if session.Loop != nil {
+			if output, err = r.runLoop(ctx, ai, sessionID, session, itIdx, scope, output); err != nil {
+				return err
+			}
+		}
 	}
+	// only the output of the last round makes it to the data structure, after the output of the previous iteration
+	<-previous
+	if err := r.safeUnmarshalDataStructure(output.data); err != nil {
+		r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).WithMessage("failed to unmarshal data").
+			WithErr(err).WithSession(sessionID).WithIteration(itIdx))
+		return err
+	}
+	releaseTurn()
+	// post-calls run once the output is in the data structure, and they get the output itself in their scope. As
+	// there's no AI interaction left, results with the AI destination are discarded.
+	if _, err := r.RunAllFunctionCallers(ctx, session.PostCalls, r.newEvalScope().WithVars(localVars).WithIterator(it).
+		WithDB(r.db).WithOutput(output.value), localVars); err != nil {
+		return err
+	}
+	r.completeIteration(ctx, sessionID, itIdx)
 	return nil
 }
 
-// ListQueued returns a list of queued sessions
+// ListQueued returns a list of queued sessions, in the order they appear in the plan
 func (r *Runner) ListQueued() Sessions {
 	sessions := NewSessions()
-	for k, v := range r.status.Iter() {
-		if v == queuedSessionStatus {
-			sessions.Set(k, r.sessionManager.Sessions.Get(k))
+	status := r.status.Iter()
+	for k, s := range r.sessionManager.Sessions.Iter() {
+		if status[k] == QueuedSessionStatus {
+			sessions.Set(k, s)
 		}
 	}
 	return sessions
@@ -410,7 +805,7 @@ func (r *Runner) runPrePrompts(ctx *util.FragsContext, ai Ai, sessionID string,
 	if err = util.Retry(ctx, session.Attempts, func() error {
 		tools := ToolDefinitions{}
 		tools = append(tools, session.Tools...)
-		_, err := ai.Ask(ctx, prePrompt, nil, tools, r, resources...)
+		_, err := r.ask(ctx, ai, sessionID, iteratorIdx, prePrompt, nil, tools, resources...)
 		if err != nil {
 			r.logger.Err(log.NewEvent(log.ErrorEventType, log.PrePromptComponent).WithMessage("error asking pre-prompt").
 				WithSession(sessionID).WithErr(err).WithIteration(iteratorIdx))
@@ -425,7 +820,7 @@ func (r *Runner) runPrePrompts(ctx *util.FragsContext, ai Ai, sessionID string,
 	// we run the remaining prePrompts, if any.
 	for _, pp := range prePrompts[1:] {
 		if err = util.Retry(ctx, session.Attempts, func() error {
-			_, err := ai.Ask(ctx, pp, nil, session.Tools, r, resources...)
+			_, err := r.ask(ctx, ai, sessionID, iteratorIdx, pp, nil, session.Tools, resources...)
 			if err != nil {
 				r.logger.Err(log.NewEvent(log.ErrorEventType, log.PrePromptComponent).
 					WithMessage("error asking pre-prompt").WithSession(sessionID).WithErr(err).
@@ -442,8 +837,19 @@ func (r *Runner) runPrePrompts(ctx *util.FragsContext, ai Ai, sessionID string,
 	return nil
 }
 
+// promptOutput is the output of a prompt, after the OnSessionOutput transformers.
+type promptOutput struct {
+	// data is the JSON to be merged into the data structure
+	data []byte
+	// value is the output itself, as seen by expressions
+	value any
+}
+
+// runPrompt runs the prompt of a session and returns its output. Round is the round of a looping session, and
+// prompts are contextualized only in the first one.
 func (r *Runner) runPrompt(ctx *util.FragsContext, ai Ai, sessionID string, session Session, iteratorIdx int,
-	scope evaluators.EvalScope, aiContext *scoper.KnowledgeNode, promptResources resources.ResourceDataItems) error {
+	round int, scope evaluators.EvalScope, aiContext *scoper.KnowledgeNode,
+	promptResources resources.ResourceDataItems) (promptOutput, error) {
 	var sessionSchema *schema.Schema
 	// previously every plan was required to have a schema. With the introduction of sub-agent mode, a schema
 	// may not be required, and while the final output is going to be structured, when the schema is absent
@@ -457,8 +863,13 @@ func (r *Runner) runPrompt(ctx *util.FragsContext, ai Ai, sessionID string, sess
 		}
 	}
 
+	transformers := r.Transformers().FilterOnSessionOutput(sessionID)
+	output := promptOutput{}
 	// ...we retry the prompt a number of times, depending on the session's attempts.
 	err := retry.New(retry.Attempts(uint(session.Attempts)), retry.Delay(time.Second*5), retry.Context(ctx)).Do(func() error {
+		r.updateState(sessionID, func(s *SessionState) {
+			s.Attempts++
+		})
 		if ctx.Err() != nil {
 			r.logger.Info(log.NewEvent(log.ErrorEventType, log.PromptComponent).
 				WithMessage("context cancelled").WithSession(sessionID).
@@ -477,7 +888,7 @@ func (r *Runner) runPrompt(ctx *util.FragsContext, ai Ai, sessionID string, sess
 		}
 		// as this is the first phase, and there was no prePrompt, we contextualize the prompt with Frags
 		// context or preCalls, if so configured.
-		if !session.HasPrePrompt() {
+		if !session.HasPrePrompt() && round == 0 {
 			prompt, err = r.contextualizePrompt(prompt, aiContext, session, scope)
 			if err != nil {
 				r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).
@@ -488,7 +899,7 @@ func (r *Runner) runPrompt(ctx *util.FragsContext, ai Ai, sessionID string, sess
 		}
 		// finally, we ask the LLM for an answer. Notice we pass NO TOOLS, as only  the prePrompt is allowed
 		// to use tools.
-		data, err = ai.Ask(ctx, prompt, sessionSchema, ToolDefinitions{}, r, promptResources...)
+		data, err = r.ask(ctx, ai, sessionID, iteratorIdx, prompt, sessionSchema, ToolDefinitions{}, promptResources...)
 		if err != nil {
 			r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).WithMessage("error asking prompt").
 				WithErr(err).WithSession(sessionID).WithIteration(iteratorIdx))
@@ -498,28 +909,58 @@ func (r *Runner) runPrompt(ctx *util.FragsContext, ai Ai, sessionID string, sess
 		// we don't want subsequent phases to load them again.
 		promptResources = make(resources.ResourceDataItems, 0)
 		if sessionSchema != nil {
-			// regardless data is returned and is ideally structured, considering a schema.
-			// was provided. We can unmarshal it in the runner data structure.
-			if err := r.safeUnmarshalDataStructure(data); err != nil {
+			// the output is validated against the schema before it gets anywhere near the data structure. If it
+			// doesn't match, the AI is asked to fix it
+			if data, err = r.validateOutput(ctx, ai, sessionID, session, iteratorIdx, sessionSchema, data); err != nil {
+				r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).
+					WithMessage("output does not match the schema").WithErr(err).WithSession(sessionID).
+					WithIteration(iteratorIdx))
+				return err
+			}
+			var value any
+			if err := json.Unmarshal(data, &value); err != nil {
 				r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).WithMessage("failed to unmarshal data").
 					WithErr(err).WithSession(sessionID).WithIteration(iteratorIdx))
 				return err
 			}
+			// the transformers may reshape the output before it gets merged
+			if len(transformers) > 0 {
+				if value, err = transformers.Transform(ctx, value, r); err != nil {
+					r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).
+						WithMessage("failed to transform output").WithErr(err).WithSession(sessionID).
+						WithIteration(iteratorIdx))
+					return err
+				}
+				if data, err = json.Marshal(value); err != nil {
+					return err
+				}
+			}
+			// regardless data is returned and is ideally structured, considering a schema.
+			// was provided. It's ready to be unmarshalled in the runner data structure.
+			output = promptOutput{data: data, value: value}
 		} else {
 			// however, if the schema was not provided, we are in the "subagent" mode and data is just plain
 			// text. So we are going to add that data to the output in an array of text
-			if err := r.safeMergeDataStructure(map[string]any{sessionID: []any{string(data)}}); err != nil {
+			value, err := transformers.Transform(ctx, string(data), r)
+			if err != nil {
+				r.logger.Err(log.NewEvent(log.ErrorEventType, log.PromptComponent).
+					WithMessage("failed to transform output").WithErr(err).WithSession(sessionID).
+					WithIteration(iteratorIdx))
 				return err
 			}
+			if data, err = json.Marshal(map[string]any{sessionID: []any{value}}); err != nil {
+				return err
+			}
+			output = promptOutput{data: data, value: value}
 		}
 		r.logger.Info(log.NewEvent(log.EndEventType, log.PromptComponent).WithSession(sessionID).
 			WithIteration(iteratorIdx))
 		return nil
 	})
 	if err != nil {
-		return err
+		return output, err
 	}
-	return nil
+	return output, nil
 }
 
 // loadSessionResources loads resources for a session.
@@ -594,7 +1035,14 @@ func (r *Runner) runSessionWorker(mainContext *util.FragsContext, index int) {
 		// if the main context has been cancelled, we discard any message that may be on the channel to drive
 		// the runner to its demise as soon as possible
 		if mainContext.Err() != nil {
-			r.wg.Done()
+			r.sessionDone <- t.id
+			continue
+		}
+		// sessions cancelled while waiting to be dispatched never start
+		if r.isCancelled(t.id) {
+			r.failCancelledSession(t.id)
+			r.saveCheckpoint(mainContext)
+			r.sessionDone <- t.id
 			continue
 		}
 		r.logger.Info(log.NewEvent(log.StartEventType, log.SessionComponent).WithSession(t.id))
@@ -603,11 +1051,12 @@ func (r *Runner) runSessionWorker(mainContext *util.FragsContext, index int) {
 			var sessionErr error
 			// we will create a context for each session, so we can cancel it if it takes too long
 			sessionContext := mainContext.Child(t.timeout)
+			r.trackSessionContext(t.id, sessionContext)
 			// This "defer" is crucial!
 			// Other than canceling the context, it also ensures that:
 			// 1. if the worker panics, the failure is handled gracefully
-			// 2. the status is always set either to finishedSessionStatus or failedSessionStatus.
-			// 3. the worker is removed from the wait group.
+			// 2. the status is always set either to FinishedSessionStatus or FailedSessionStatus.
+			// 3. the scheduler is notified that the session reached a terminal state.
 			defer func() {
 				if err := recover(); err != nil {
 					var castErr error
@@ -617,18 +1066,23 @@ func (r *Runner) runSessionWorker(mainContext *util.FragsContext, index int) {
 					r.logger.Err(log.NewEvent(log.ErrorEventType, log.WorkerComponent).WithMessage("worker panicked").
 						WithIteration(index).WithSession(t.id).WithErr(castErr))
 					success = false
+					sessionErr = fmt.Errorf("worker panicked: %v", err)
 				}
 				sessionContext.Cancel(nil)
+				r.untrackSessionContext(t.id)
 				if success {
-					r.SetStatus(t.id, finishedSessionStatus)
+					r.SetStatus(t.id, FinishedSessionStatus)
+				} else if r.isCancelled(t.id) && mainContext.Err() == nil {
+					// a cancelled session doesn't follow its onError policy, as the failure was requested
+					r.failCancelledSession(t.id)
 				} else {
-					r.SetStatus(t.id, failedSessionStatus)
-					mainContext.Cancel(sessionErr)
+					r.handleSessionFailure(mainContext, t.id, t.session, sessionErr)
 				}
 				r.logger.Info(log.NewEvent(log.EndEventType, log.SessionComponent).WithSession(t.id))
-				r.wg.Done()
+				r.saveCheckpoint(mainContext)
+				r.sessionDone <- t.id
 			}()
-			r.SetStatus(t.id, runningSessionStatus)
+			r.SetStatus(t.id, RunningSessionStatus)
 			if err := r.runSession(sessionContext, t.id, t.session); err != nil {
 				success = false
 				sessionErr = err
@@ -643,22 +1097,26 @@ func (r *Runner) SetStatus(sessionID string, status SessionStatus) {
 	r.statusMutex.Lock()
 	defer r.statusMutex.Unlock()
 	r.status.Store(sessionID, status)
+	r.trackStatus(sessionID, status)
 }
 
 // IsCompleted returns true if all sessions are completed
 func (r *Runner) IsCompleted() bool {
 	for _, s := range r.status.Iter() {
-		if s == queuedSessionStatus {
+		if s == QueuedSessionStatus {
 			return false
 		}
 	}
 	return true
 }
 
+// ListFailedSessions returns the sessions that failed, including the ones that were recovered with a fallback, in
+// the order they appear in the plan
 func (r *Runner) ListFailedSessions() []string {
 	failedSessions := make([]string, 0)
-	for id, s := range r.status.Iter() {
-		if s == failedSessionStatus {
+	status := r.status.Iter()
+	for _, id := range r.sessionManager.Sessions.Order {
+		if status[id] == FailedSessionStatus || status[id] == FallbackSessionStatus {
 			failedSessions = append(failedSessions, id)
 		}
 	}
@@ -668,6 +1126,9 @@ func (r *Runner) ListFailedSessions() []string {
 func (r *Runner) RunFunction(ctx *util.FragsContext, name string, args map[string]any) (any, error) {
 	f, ok := r.ExternalFunctions[name]
 	if ok {
+		if err := r.spendToolCall(); err != nil {
+			return nil, err
+		}
 		return f.Run(ctx, args, r)
 	}
 	return nil, fmt.Errorf("function %s not found", name)
@@ -19,13 +19,19 @@ package frags
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/checkpoints"
+	"github.com/theirish81/frags/log"
 	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
 	"github.com/theirish81/frags/util"
 )
 
@@ -61,6 +67,264 @@ func TestRunner_RunDependenciesAndContext(t *testing.T) {
 	assert.False(t, ok)
 }
 
+func TestRunner_RunDispatchesAsSoonAsDependenciesAreMet(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/scheduled_sessions.yaml")
+	mgr := NewSessionManager()
+	err := mgr.FromYAML(sessionData)
+	assert.Nil(t, err)
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithSessionWorkers(3))
+	start := time.Now()
+	out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	assert.Len(t, out, 3)
+	// the slow session takes 2 seconds (prePrompt + prompt), while fast and dependant take 1 second each. If
+	// dependant had to wait for slow, the run would take 3 seconds.
+	assert.Less(t, time.Since(start), 2800*time.Millisecond)
+}
+
+// failingAi fails any prompt containing the given text
+type failingAi struct {
+	DummyAi
+	failOn string
+}
+
+func (f *failingAi) Ask(ctx *util.FragsContext, text string, schema *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, resources ...resources.ResourceData) ([]byte, error) {
+	if strings.Contains(text, f.failOn) {
+		return nil, errors.New("nope")
+	}
+	return f.DummyAi.Ask(ctx, text, schema, tools, runner, resources...)
+}
+
+func (f *failingAi) New() Ai {
+	return &failingAi{failOn: f.failOn}
+}
+
+// staggeredAi answers with the prompt itself, after the delay of the first key the prompt contains
+type staggeredAi struct {
+	DummyAi
+	delays map[string]time.Duration
+}
+
+func (s *staggeredAi) Ask(_ *util.FragsContext, text string, _ *schema.Schema, _ ToolDefinitions, _ ExportableRunner,
+	_ ...resources.ResourceData) ([]byte, error) {
+	for k, delay := range s.delays {
+		if strings.Contains(text, k) {
+			time.Sleep(delay)
+			break
+		}
+	}
+	return []byte(text), nil
+}
+
+func (s *staggeredAi) New() Ai {
+	return s
+}
+
+func TestRunner_RunConcurrentIterations(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/concurrent_iterations.yaml")
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML(sessionData))
+
+	t.Run("iterations run concurrently", func(t *testing.T) {
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi())
+		start := time.Now()
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Len(t, out["describe"], 4)
+		// each iteration takes 1 second, sequentially it would take 4
+		assert.Less(t, time.Since(start), 2*time.Second)
+	})
+
+	t.Run("outputs keep the iterateOn order", func(t *testing.T) {
+		// the earlier the animal, the slower the answer, so iterations complete in reverse order
+		ai := &staggeredAi{delays: map[string]time.Duration{
+			"cat": 400 * time.Millisecond, "dog": 300 * time.Millisecond, "cow": 200 * time.Millisecond,
+			"horse": 100 * time.Millisecond,
+		}}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		outputs, _ := out["describe"].([]any)
+		assert.Len(t, outputs, 4)
+		for i, animal := range []string{"cat", "dog", "cow", "horse"} {
+			assert.Contains(t, outputs[i], "describe the "+animal)
+		}
+	})
+
+	t.Run("failures report the iteration index", func(t *testing.T) {
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), &failingAi{failOn: "cow"})
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		iterationErr := util.IterationError{}
+		assert.True(t, errors.As(err, &iterationErr))
+		assert.Equal(t, 2, iterationErr.Index)
+	})
+}
+
+func TestRunner_RunErrorPolicies(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/error_policies.yaml")
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML(sessionData))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), &failingAi{failOn: "explode"}, WithSessionWorkers(3))
+	out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	failedErr := util.SessionsFailedError{}
+	assert.True(t, errors.As(err, &failedErr))
+	assert.Equal(t, []string{"broken", "optional"}, failedErr.FailedSessions)
+	assert.ErrorContains(t, err, "session optional:")
+	assert.Contains(t, out["broken"], "n/a:")
+	assert.Contains(t, out["broken"], "nope")
+	assert.Contains(t, out["after_broken"], "cow")
+	assert.Contains(t, out["independent"], "goat")
+	assert.NotContains(t, out, "optional")
+	assert.NotContains(t, out, "after_optional")
+}
+
+// sloppyAi returns an output that doesn't match the schema for its first answers
+type sloppyAi struct {
+	DummyAi
+	mistakes int
+}
+
+func (s *sloppyAi) Ask(ctx *util.FragsContext, text string, schema *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, resources ...resources.ResourceData) ([]byte, error) {
+	if len(s.History) < s.mistakes {
+		s.History = append(s.History, dummyHistoryItem{Text: text, Schema: schema})
+		return []byte(`{"p1": 42}`), nil
+	}
+	return s.DummyAi.Ask(ctx, text, schema, tools, runner, resources...)
+}
+
+// New returns the same instance, so the test can inspect the conversation
+func (s *sloppyAi) New() Ai {
+	return s
+}
+
+func TestRunner_RunRepairsInvalidOutput(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+schema:
+  properties:
+    p1:
+      type: string
+      x-session: one
+`)))
+	t.Run("invalid output is repaired", func(t *testing.T) {
+		ai := &sloppyAi{mistakes: 1}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Len(t, ai.History, 2)
+		assert.Contains(t, ai.History[1].Text, "- p1: expected string, got float64")
+		assert.Equal(t, ai.History[1].Text, out["p1"])
+	})
+	t.Run("all the violations are reported", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+schema:
+  required: [p2]
+  properties:
+    p1:
+      type: string
+      x-session: one
+    p2:
+      type: string
+      x-session: one
+`)))
+		ai := &sloppyAi{mistakes: 1}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai)
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Contains(t, ai.History[1].Text, "- (root): missing required property: p2\n- p1: expected string, got float64")
+	})
+	t.Run("output that cannot be repaired fails the session", func(t *testing.T) {
+		ai := &sloppyAi{mistakes: 5}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), ai, WithRepairRounds(1))
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		validationErr := OutputValidationError{}
+		assert.True(t, errors.As(err, &validationErr))
+		assert.Equal(t, "one", validationErr.SessionID)
+		assert.Len(t, ai.History, 2)
+		assert.NotContains(t, out, "p1")
+	})
+}
+
+func TestRunner_Usage(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/concurrent_iterations.yaml")
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML(sessionData))
+	events := make(chan log.Event, 100)
+	logger := log.NewStreamerLogger(slog.Default(), events, log.InfoChannelLevel)
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithLogger(logger),
+		WithPriceTable(util.PriceTable{"dummy": {Input: 1, Output: 2}}))
+	_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	close(events)
+	usageEvents := 0
+	for event := range events {
+		if event.Type == log.UsageEventType {
+			usageEvents++
+			assert.Equal(t, "dummy", event.Args["model"])
+			assert.NotZero(t, event.Usage.Input)
+		}
+	}
+	assert.Equal(t, 4, usageEvents)
+
+	report := runner.Usage()
+	assert.Len(t, report.Iterations["describe"], 4)
+	assert.Equal(t, report.Total.Usage, report.Sessions["describe"].Usage)
+	assert.Equal(t, report.Total.Usage, report.Models["dummy"].Usage)
+	iterationsTotal := util.Usage{}
+	for _, stats := range report.Iterations["describe"] {
+		iterationsTotal = iterationsTotal.Add(stats.Usage)
+	}
+	assert.Equal(t, report.Total.Usage, iterationsTotal)
+	assert.NotNil(t, report.Total.Cost)
+	assert.InDelta(t, float64(report.Total.Input+2*report.Total.Output)/1_000_000, *report.Total.Cost, 0.0000001)
+}
+
+func TestRunner_Resume(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/sessions.yaml")
+	mgr := NewSessionManager()
+	err := mgr.FromYAML(sessionData)
+	assert.Nil(t, err)
+	store, err := checkpoints.NewFileStore(t.TempDir())
+	assert.NoError(t, err)
+
+	t.Run("run saves a checkpoint", func(t *testing.T) {
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithCheckpointStore(store),
+			WithCheckpointID("first"))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), map[string]any{"animal": "dog"})
+		assert.NoError(t, err)
+		checkpoint, err := store.Load(t.Context(), "first")
+		assert.NoError(t, err)
+		assert.Equal(t, "finished", checkpoint.Status["session_one"])
+		assert.Equal(t, "finished", checkpoint.Status["session_two"])
+		assert.NotEmpty(t, checkpoint.Data["p1"])
+		assert.Equal(t, []int{0}, checkpoint.Iterations["session_two"])
+	})
+
+	t.Run("resume skips finished sessions", func(t *testing.T) {
+		checkpoint := checkpoints.NewCheckpoint("second")
+		checkpoint.Params = map[string]any{"animal": "cat"}
+		checkpoint.Status = map[string]string{"session_one": "finished", "session_two": "running"}
+		checkpoint.Data = map[string]any{"p1": "from checkpoint"}
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithCheckpointStore(store))
+		out, err := runner.Resume(util.NewFragsContext(time.Minute), checkpoint)
+		assert.NoError(t, err)
+		assert.Equal(t, "from checkpoint", out["p1"])
+		assert.Contains(t, out["p3"], "cat")
+		saved, err := store.Load(t.Context(), "second")
+		assert.NoError(t, err)
+		assert.Equal(t, "finished", saved.Status["session_two"])
+	})
+}
+
 func TestRunner_LoadSessionResource(t *testing.T) {
 	sessionData, _ := os.ReadFile("test_data/session_resources.yaml")
 	mgr := NewSessionManager()
@@ -115,3 +379,71 @@ func TestRunner_RunAllFunctionCalls(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, map[string]any{"f1": "val1", "f2": "val2 + val1"}, outVars)
 }
+
+func TestRunner_RunPostCalls(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+transformers:
+  - name: upper
+    onSessionOutput: describe
+    expr: "{'animal': args.animal contains 'cat' ? 'CAT' : 'OTHER'}"
+sessions:
+  describe:
+    prompt: describe a cat
+    postCalls:
+      - name: store
+        args:
+          animal: "{{ .output.animal }}"
+        in: context
+        var: stored
+schema:
+  properties:
+    animal:
+      type: string
+      x-session: describe
+`)))
+	session := mgr.Sessions.Get("describe")
+	session.PostCalls[0].Func = func(ctx *util.FragsContext, args map[string]any) (any, error) {
+		return "stored " + args["animal"].(string), nil
+	}
+	mgr.Sessions.Set("describe", session)
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi())
+	out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "CAT", out["animal"])
+	assert.Equal(t, "stored CAT", out["stored"])
+}
+
+func TestRunner_RunLoop(t *testing.T) {
+	plan := func(maxRounds int) SessionManager {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(fmt.Sprintf(`
+sessions:
+  describe:
+    prompt: "describe a cat{{ if .output }}, round {{ .round }}{{ end }}"
+    loop:
+      until: "output.animal contains 'round 2'"
+      maxRounds: %d
+schema:
+  properties:
+    animal:
+      type: string
+      x-session: describe
+`, maxRounds))))
+		return mgr
+	}
+	t.Run("until the condition is met", func(t *testing.T) {
+		runner := NewRunner(plan(5), resources.NewDummyResourceLoader(), NewDummyAi())
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "describe a cat, round 2", out["animal"])
+		assert.Equal(t, util.Ptr(2), sessionState(&runner, "describe").Round)
+		assert.Equal(t, 3, sessionState(&runner, "describe").Attempts)
+	})
+	t.Run("until the maximum number of rounds", func(t *testing.T) {
+		runner := NewRunner(plan(2), resources.NewDummyResourceLoader(), NewDummyAi())
+		out, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		assert.NoError(t, err)
+		assert.Equal(t, "describe a cat, round 1", out["animal"])
+	})
+}
@@ -0,0 +1,475 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"path"
+	"slices"
+	"strings"
+	"unicode"
+
+	"github.com/theirish81/frags/resources"
+)
+
+// CodegenOptions configures the generation of code from a schema.
+type CodegenOptions struct {
+	// Package is the package of the generated Go file. Defaults to "model"
+	Package string
+	// RootName is the name of the type generated for the root schema. Defaults to "Result"
+	RootName string
+	// Components are the plan components, the #/components/schemas/ references point to
+	Components map[string]Schema
+	// Loader loads the files of external references. If nil, files are read from the file system
+	Loader resources.ResourceLoader
+}
+
+// typeKind is the kind of generated type
+type typeKind int
+
+const (
+	anyKind typeKind = iota
+	stringKind
+	integerKind
+	numberKind
+	booleanKind
+	arrayKind
+	mapKind
+	namedKind
+	unionKind
+)
+
+// typeRef is a language-neutral reference to a type, as it appears in a field, an array or a map
+type typeRef struct {
+	kind     typeKind
+	name     string
+	elem     *typeRef
+	members  []*typeRef
+	nullable bool
+	// recursive is set when the named type references itself, in which case it can't be embedded by value
+	recursive bool
+}
+
+// namedType is a type declaration: a struct (fields), an enum (enum values of the base type) or an alias of another
+// type (base only)
+type namedType struct {
+	name        string
+	description string
+	fields      []*codegenField
+	enum        []any
+	base        *typeRef
+}
+
+// codegenField is a property of a struct
+type codegenField struct {
+	name        string
+	property    string
+	description string
+	typ         *typeRef
+	required    bool
+}
+
+// codegen turns a schema into named types, which the language emitters render
+type codegen struct {
+	resolver *resolver
+	types    []*namedType
+	names    map[string]bool
+	refs     map[string]string
+	// pending are the referenced types being generated. Referencing them again means the reference is recursive
+	pending map[string]bool
+	// unions tells whether anyOf and oneOf are rendered as unions of their members, or just as any
+	unions bool
+}
+
+// newCodegen creates a codegen for the given root schema
+func newCodegen(s *Schema, options CodegenOptions, unions bool) *codegen {
+	return &codegen{
+		resolver: &resolver{
+			components:  options.Components,
+			defs:        s.Defs,
+			definitions: s.Definitions,
+			loader:      options.Loader,
+			documents:   make(map[string]any),
+			visited:     make(map[string]bool),
+		},
+		names:   make(map[string]bool),
+		refs:    make(map[string]string),
+		pending: make(map[string]bool),
+		unions:  unions,
+	}
+}
+
+// generate collects the named types of the schema, starting from the root type
+func (g *codegen) generate(s *Schema, rootName string) error {
+	if s == nil {
+		return errors.New("no schema to generate code from")
+	}
+	g.names[rootName] = true
+	_, err := g.typeOf(s, "", rootName, true)
+	return err
+}
+
+// typeOf returns the type of the schema node. file is the document the node comes from, empty for the plan itself.
+// If the node needs a named type, it's named after the hint. When exact is true, the hint has already been reserved
+// and the node always gets a named type, an alias if nothing else.
+func (g *codegen) typeOf(node *Schema, file string, hint string, exact bool) (*typeRef, error) {
+	t, err := g.unnamedTypeOf(node, file, hint, exact)
+	if err != nil {
+		return nil, err
+	}
+	if exact && (t.kind != namedKind || t.name != hint) {
+		g.types = append(g.types, &namedType{name: hint, description: description(node), base: t})
+		return &typeRef{kind: namedKind, name: hint}, nil
+	}
+	return t, nil
+}
+
+// unnamedTypeOf does the actual job of typeOf
+func (g *codegen) unnamedTypeOf(node *Schema, file string, hint string, exact bool) (*typeRef, error) {
+	if node == nil {
+		return &typeRef{kind: anyKind}, nil
+	}
+	if node.Ref != nil {
+		t, err := g.refType(*node.Ref, file)
+		if err != nil {
+			return nil, err
+		}
+		t.nullable = node.Nullable != nil && *node.Nullable
+		return t, nil
+	}
+	if len(node.AllOf) > 0 {
+		merged, err := g.mergeAllOf(node, file)
+		if err != nil {
+			return nil, err
+		}
+		node = merged
+	}
+	nullable := node.Nullable != nil && *node.Nullable
+	if values := enumValues(node); len(values) > 0 {
+		if base := enumBase(node, values); base != nil {
+			name := g.name(hint, exact)
+			g.types = append(g.types, &namedType{name: name, description: description(node), enum: values, base: base})
+			return &typeRef{kind: namedKind, name: name, nullable: nullable}, nil
+		}
+		return &typeRef{kind: anyKind}, nil
+	}
+	if alternatives := slices.Concat(node.AnyOf, node.OneOf); len(alternatives) > 0 {
+		if !g.unions {
+			return &typeRef{kind: anyKind}, nil
+		}
+		union := &typeRef{kind: unionKind, nullable: nullable}
+		for i, alt := range alternatives {
+			member, err := g.typeOf(alt, file, fmt.Sprintf("%sOption%d", hint, i+1), false)
+			if err != nil {
+				return nil, err
+			}
+			union.members = append(union.members, member)
+		}
+		return union, nil
+	}
+	var t *typeRef
+	switch inferType(node) {
+	case Object:
+		if len(node.Properties) == 0 {
+			value, err := g.additionalPropertiesType(node, file, hint)
+			if err != nil {
+				return nil, err
+			}
+			t = &typeRef{kind: mapKind, elem: value}
+			break
+		}
+		name := g.name(hint, exact)
+		declaration := &namedType{name: name, description: description(node)}
+		g.types = append(g.types, declaration)
+		if err := g.fields(declaration, node, file); err != nil {
+			return nil, err
+		}
+		t = &typeRef{kind: namedKind, name: name}
+	case Array:
+		items, err := g.typeOf(node.Items, file, hint+"Item", false)
+		if err != nil {
+			return nil, err
+		}
+		if len(node.PrefixItems) > 0 {
+			items = &typeRef{kind: anyKind}
+		}
+		t = &typeRef{kind: arrayKind, elem: items}
+	case String:
+		t = &typeRef{kind: stringKind}
+	case Integer:
+		t = &typeRef{kind: integerKind}
+	case Number:
+		t = &typeRef{kind: numberKind}
+	case Boolean:
+		t = &typeRef{kind: booleanKind}
+	default:
+		t = &typeRef{kind: anyKind}
+	}
+	t.nullable = nullable
+	return t, nil
+}
+
+// fields collects the fields of a struct, in the propertyOrdering order first, and then alphabetically
+func (g *codegen) fields(declaration *namedType, node *Schema, file string) error {
+	properties := make([]string, 0, len(node.Properties))
+	for _, k := range node.PropertyOrdering {
+		if _, ok := node.Properties[k]; ok && !slices.Contains(properties, k) {
+			properties = append(properties, k)
+		}
+	}
+	for _, k := range sortedKeys(node.Properties) {
+		if !slices.Contains(properties, k) {
+			properties = append(properties, k)
+		}
+	}
+	fieldNames := make(map[string]bool)
+	for _, property := range properties {
+		fieldName := uniqueName(identifier(property), fieldNames)
+		fieldNames[fieldName] = true
+		t, err := g.typeOf(node.Properties[property], file, declaration.name+fieldName, false)
+		if err != nil {
+			return err
+		}
+		declaration.fields = append(declaration.fields, &codegenField{
+			name:        fieldName,
+			property:    property,
+			description: description(node.Properties[property]),
+			typ:         t,
+			required:    slices.Contains(node.Required, property),
+		})
+	}
+	return nil
+}
+
+// additionalPropertiesType returns the type of the values of an object without properties
+func (g *codegen) additionalPropertiesType(node *Schema, file string, hint string) (*typeRef, error) {
+	if node.AdditionalProperties != nil && node.AdditionalProperties.Schema != nil {
+		return g.typeOf(node.AdditionalProperties.Schema, file, hint+"Value", false)
+	}
+	if len(node.PatternProperties) == 1 {
+		for _, v := range node.PatternProperties {
+			return g.typeOf(v, file, hint+"Value", false)
+		}
+	}
+	return &typeRef{kind: anyKind}, nil
+}
+
+// refType returns the named type of a reference, declaring it the first time the reference is met
+func (g *codegen) refType(ref string, file string) (*typeRef, error) {
+	refFile, pointer := splitRef(ref)
+	if refFile != "" && !path.IsAbs(refFile) {
+		refFile = path.Join(path.Dir(file), refFile)
+	} else if refFile == "" {
+		refFile = file
+	}
+	key := refFile + "#" + pointer
+	if name, ok := g.refs[key]; ok {
+		return &typeRef{kind: namedKind, name: name, recursive: g.pending[name]}, nil
+	}
+	target, err := g.resolver.lookup(refFile, pointer)
+	if err != nil {
+		return nil, &RefError{Ref: ref, File: refFile, Pointer: pointer, Err: err}
+	}
+	// the type is named after the last token of the pointer or, if the reference is to a whole file, after the file
+	name := strings.TrimSuffix(path.Base(refFile), path.Ext(refFile))
+	if pointer != "" && pointer != "/" {
+		name = unescapePointerToken(pointer[strings.LastIndex(pointer, "/")+1:])
+	}
+	name = uniqueName(identifier(name), g.names)
+	g.names[name] = true
+	g.refs[key] = name
+	g.pending[name] = true
+	defer delete(g.pending, name)
+	if _, err := g.typeOf(&target, refFile, name, true); err != nil {
+		return nil, err
+	}
+	return &typeRef{kind: namedKind, name: name}, nil
+}
+
+// mergeAllOf returns a copy of the node with the allOf sub-schemas merged into it. References are followed, so the
+// merged schema is self-contained.
+func (g *codegen) mergeAllOf(node *Schema, file string) (*Schema, error) {
+	merged := *node
+	merged.AllOf = nil
+	merged.Properties = make(map[string]*Schema)
+	for k, v := range node.Properties {
+		merged.Properties[k] = v
+	}
+	merged.Required = slices.Clone(node.Required)
+	for _, sub := range node.AllOf {
+		subFile := file
+		if sub.Ref != nil {
+			refFile, pointer := splitRef(*sub.Ref)
+			if refFile != "" && !path.IsAbs(refFile) {
+				refFile = path.Join(path.Dir(file), refFile)
+			} else if refFile == "" {
+				refFile = file
+			}
+			target, err := g.resolver.lookup(refFile, pointer)
+			if err != nil {
+				return nil, &RefError{Ref: *sub.Ref, File: refFile, Pointer: pointer, Err: err}
+			}
+			sub, subFile = &target, refFile
+		}
+		if len(sub.AllOf) > 0 {
+			flattened, err := g.mergeAllOf(sub, subFile)
+			if err != nil {
+				return nil, err
+			}
+			sub = flattened
+		}
+		if subFile != file {
+			// properties of other files can't be told apart once merged, so their references are resolved upfront
+			copied, err := sub.clone()
+			if err != nil {
+				return nil, err
+			}
+			if err := g.resolver.resolve(copied, subFile); err != nil {
+				return nil, err
+			}
+			sub = copied
+		}
+		mergeSchema(&merged, sub)
+	}
+	merged.AllOf = nil
+	return &merged, nil
+}
+
+// name returns the name for a new type, based on the hint
+func (g *codegen) name(hint string, exact bool) string {
+	if exact {
+		return hint
+	}
+	name := uniqueName(hint, g.names)
+	g.names[name] = true
+	return name
+}
+
+// inferType returns the type of the node, inferring it from the keywords if the type is not set
+func inferType(node *Schema) Type {
+	switch {
+	case node.Type != "":
+		return node.Type
+	case len(node.Properties) > 0 || node.AdditionalProperties != nil || len(node.PatternProperties) > 0:
+		return Object
+	case node.Items != nil || len(node.PrefixItems) > 0:
+		return Array
+	}
+	return ""
+}
+
+// enumValues returns the values of the enum or the const of the node
+func enumValues(node *Schema) []any {
+	if len(node.Enum) > 0 {
+		return node.Enum
+	}
+	if node.Const != nil {
+		return []any{node.Const}
+	}
+	return nil
+}
+
+// enumBase returns the type of the enum values, or nil if they're not all strings, integers or numbers, or if they
+// don't match the type of the node
+func enumBase(node *Schema, values []any) *typeRef {
+	strs, ints, nums := 0, 0, 0
+	for _, v := range values {
+		switch n := v.(type) {
+		case string:
+			strs++
+		case int, int64:
+			ints++
+			nums++
+		case float64:
+			if n == math.Trunc(n) {
+				ints++
+			}
+			nums++
+		default:
+			return nil
+		}
+	}
+	all := len(values)
+	switch t := inferType(node); {
+	case strs == all && (t == String || t == ""):
+		return &typeRef{kind: stringKind}
+	case ints == all && (t == Integer || t == ""):
+		return &typeRef{kind: integerKind}
+	case nums == all && (t == Number || t == ""):
+		return &typeRef{kind: numberKind}
+	}
+	return nil
+}
+
+// description returns the description of the node, or the title if there's no description
+func description(node *Schema) string {
+	if node == nil {
+		return ""
+	}
+	if node.Description != "" {
+		return node.Description
+	}
+	return node.Title
+}
+
+// commonInitialisms are the words rendered in all caps in identifiers
+var commonInitialisms = []string{"ID", "URL", "URI", "API", "HTTP", "JSON", "UUID", "IP", "SQL", "HTML"}
+
+// identifier turns a property name into an exported identifier, i.e. "customer_id" becomes "CustomerID"
+func identifier(name string) string {
+	id := pascalCase(name)
+	if id == "" {
+		return "Field"
+	}
+	if unicode.IsDigit([]rune(id)[0]) {
+		return "N" + id
+	}
+	return id
+}
+
+// pascalCase joins the words of the text in PascalCase, dropping anything that is not a letter or a digit
+func pascalCase(text string) string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	sb := strings.Builder{}
+	for _, word := range words {
+		if slices.Contains(commonInitialisms, strings.ToUpper(word)) {
+			sb.WriteString(strings.ToUpper(word))
+			continue
+		}
+		runes := []rune(word)
+		sb.WriteString(strings.ToUpper(string(runes[0])) + string(runes[1:]))
+	}
+	return sb.String()
+}
+
+// uniqueName returns the name itself if not taken yet, or the name with the first available numeric suffix
+func uniqueName(name string, taken map[string]bool) string {
+	if !taken[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s%d", name, i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"fmt"
+	"go/format"
+	"strings"
+)
+
+// GenerateGo emits the Go types matching the schema: structs with json tags for the objects, typed constants for the
+// enums, and named types for the references. Properties that are not required become pointers, except for slices,
+// maps and any, which can be nil already.
+func (s *Schema) GenerateGo(options CodegenOptions) ([]byte, error) {
+	options = options.withDefaults()
+	g := newCodegen(s, options, false)
+	if err := g.generate(s, options.RootName); err != nil {
+		return nil, err
+	}
+	sb := strings.Builder{}
+	sb.WriteString("// Code generated by frags. DO NOT EDIT.\n\n")
+	sb.WriteString("package " + options.Package + "\n")
+	for _, t := range g.types {
+		sb.WriteString("\n")
+		writeGoComment(&sb, t.description, "")
+		switch {
+		case t.fields != nil:
+			sb.WriteString("type " + t.name + " struct {\n")
+			for _, f := range t.fields {
+				writeGoComment(&sb, f.description, "\t")
+				tag := f.property
+				if !f.required {
+					tag += ",omitempty"
+				}
+				fmt.Fprintf(&sb, "\t%s %s `json:%q`\n", f.name, goFieldType(f.typ, f.required), tag)
+			}
+			sb.WriteString("}\n")
+		case t.enum != nil:
+			sb.WriteString("type " + t.name + " " + goType(t.base) + "\n\nconst (\n")
+			constants := make(map[string]bool)
+			for _, v := range t.enum {
+				constant := uniqueName(t.name+enumConstantSuffix(v), constants)
+				constants[constant] = true
+				fmt.Fprintf(&sb, "\t%s %s = %s\n", constant, t.name, goLiteral(v))
+			}
+			sb.WriteString(")\n")
+		default:
+			sb.WriteString("type " + t.name + " " + goType(t.base) + "\n")
+		}
+	}
+	return format.Source([]byte(sb.String()))
+}
+
+// withDefaults returns the options with the defaults applied
+func (o CodegenOptions) withDefaults() CodegenOptions {
+	if o.Package == "" {
+		o.Package = "model"
+	}
+	if o.RootName == "" {
+		o.RootName = "Result"
+	}
+	o.RootName = identifier(o.RootName)
+	return o
+}
+
+// goFieldType returns the Go type of a struct field. Optional, nullable and recursive fields are pointers, unless
+// their type can be nil already.
+func goFieldType(t *typeRef, required bool) string {
+	if (!required || t.nullable || t.recursive) && t.kind != arrayKind && t.kind != mapKind && t.kind != anyKind {
+		return "*" + goType(t)
+	}
+	return goType(t)
+}
+
+// goType returns the Go type matching the typeRef
+func goType(t *typeRef) string {
+	switch t.kind {
+	case stringKind:
+		return "string"
+	case integerKind:
+		return "int64"
+	case numberKind:
+		return "float64"
+	case booleanKind:
+		return "bool"
+	case arrayKind:
+		return "[]" + goElemType(t.elem)
+	case mapKind:
+		return "map[string]" + goElemType(t.elem)
+	case namedKind:
+		return t.name
+	}
+	return "any"
+}
+
+// goElemType returns the Go type of the elements of slices and maps, where only nullable elements are pointers
+func goElemType(t *typeRef) string {
+	if t.nullable && t.kind != arrayKind && t.kind != mapKind && t.kind != anyKind {
+		return "*" + goType(t)
+	}
+	return goType(t)
+}
+
+// enumConstantSuffix returns the suffix of the name of the constant for the enum value, i.e. StatusOpen for "open"
+func enumConstantSuffix(v any) string {
+	str := fmt.Sprint(v)
+	suffix := pascalCase(str)
+	if strings.HasPrefix(str, "-") {
+		suffix = "Minus" + suffix
+	}
+	if suffix == "" {
+		return "Empty"
+	}
+	return suffix
+}
+
+// goLiteral renders an enum value as a Go literal
+func goLiteral(v any) string {
+	if str, ok := v.(string); ok {
+		return fmt.Sprintf("%q", str)
+	}
+	return fmt.Sprint(v)
+}
+
+// writeGoComment writes the text as a Go comment, one line per line of text
+func writeGoComment(sb *strings.Builder, text string, indent string) {
+	if text == "" {
+		return
+	}
+	for _, line := range strings.Split(strings.TrimSpace(text), "\n") {
+		sb.WriteString(strings.TrimRight(indent+"// "+line, " ") + "\n")
+	}
+}
@@ -0,0 +1,92 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/util"
+)
+
+func codegenTestSchema(t *testing.T) (*Schema, CodegenOptions) {
+	data, err := os.ReadFile("test_data/order.yaml")
+	assert.NoError(t, err)
+	s := Schema{}
+	assert.NoError(t, s.FromYAML(data))
+	return &s, CodegenOptions{
+		Package:  "orders",
+		RootName: "order",
+		Components: map[string]Schema{
+			"Customer": {
+				Type:     Object,
+				Required: []string{"name"},
+				Properties: map[string]*Schema{
+					"name":    {Type: String},
+					"address": {Ref: util.Ptr("test_data/common/address.json#/$defs/Address")},
+				},
+			},
+		},
+	}
+}
+
+func TestSchema_GenerateGo(t *testing.T) {
+	s, options := codegenTestSchema(t)
+	code, err := s.GenerateGo(options)
+	assert.NoError(t, err)
+	expected, _ := os.ReadFile("test_data/order.go.golden")
+	assert.Equal(t, string(expected), string(code))
+
+	t.Run("defaults", func(t *testing.T) {
+		s := Schema{Type: Object, Properties: map[string]*Schema{
+			"kind": {Const: "invoice"},
+			"sign": {Type: Integer, Enum: []any{-1, 0, 1}},
+			"meta": {Type: Object},
+		}}
+		code, err := s.GenerateGo(CodegenOptions{})
+		assert.NoError(t, err)
+		assert.Contains(t, string(code), "package model\n")
+		assert.Contains(t, string(code), "type Result struct {")
+		assert.Contains(t, string(code), "ResultKindInvoice ResultKind = \"invoice\"")
+		assert.Contains(t, string(code), "ResultSignMinus1 ResultSign = -1")
+		assert.Contains(t, string(code), "Meta map[string]any `json:\"meta,omitempty\"`")
+	})
+
+	t.Run("unresolvable reference", func(t *testing.T) {
+		s := Schema{Type: Object, Properties: map[string]*Schema{"a": {Ref: util.Ptr("#/components/schemas/Nope")}}}
+		_, err := s.GenerateGo(CodegenOptions{})
+		var refErr *RefError
+		assert.ErrorAs(t, err, &refErr)
+	})
+}
+
+func TestSchema_GenerateTypeScript(t *testing.T) {
+	s, options := codegenTestSchema(t)
+	code, err := s.GenerateTypeScript(options)
+	assert.NoError(t, err)
+	expected, _ := os.ReadFile("test_data/order.ts.golden")
+	assert.Equal(t, string(expected), string(code))
+}
+
+func TestIdentifier(t *testing.T) {
+	assert.Equal(t, "CustomerID", identifier("customer_id"))
+	assert.Equal(t, "ShippedAt", identifier("shippedAt"))
+	assert.Equal(t, "N1st", identifier("1st"))
+	assert.Equal(t, "Field", identifier("--"))
+}
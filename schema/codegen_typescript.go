@@ -0,0 +1,128 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+)
+
+// tsIdentifierRegex matches the property names that don't need to be quoted in TypeScript
+var tsIdentifierRegex = regexp.MustCompile(`^[A-Za-z_$][A-Za-z0-9_$]*$`)
+
+// GenerateTypeScript emits the TypeScript types matching the schema: interfaces for the objects, unions of literals
+// for the enums, and named types for the references. Properties that are not required are optional, and anyOf/oneOf
+// become unions. Package is ignored.
+func (s *Schema) GenerateTypeScript(options CodegenOptions) ([]byte, error) {
+	options = options.withDefaults()
+	g := newCodegen(s, options, true)
+	if err := g.generate(s, options.RootName); err != nil {
+		return nil, err
+	}
+	sb := strings.Builder{}
+	sb.WriteString("// Code generated by frags. DO NOT EDIT.\n")
+	for _, t := range g.types {
+		sb.WriteString("\n")
+		writeTSComment(&sb, t.description, "")
+		switch {
+		case t.fields != nil:
+			sb.WriteString("export interface " + t.name + " {\n")
+			for _, f := range t.fields {
+				writeTSComment(&sb, f.description, "  ")
+				property := f.property
+				if !tsIdentifierRegex.MatchString(property) {
+					property = tsLiteral(property)
+				}
+				if !f.required {
+					property += "?"
+				}
+				sb.WriteString("  " + property + ": " + tsType(f.typ) + ";\n")
+			}
+			sb.WriteString("}\n")
+		case t.enum != nil:
+			literals := make([]string, 0, len(t.enum))
+			for _, v := range t.enum {
+				literals = append(literals, tsLiteral(v))
+			}
+			sb.WriteString("export type " + t.name + " = " + strings.Join(literals, " | ") + ";\n")
+		default:
+			sb.WriteString("export type " + t.name + " = " + tsType(t.base) + ";\n")
+		}
+	}
+	return []byte(sb.String()), nil
+}
+
+// tsType returns the TypeScript type matching the typeRef
+func tsType(t *typeRef) string {
+	var ts string
+	switch t.kind {
+	case stringKind:
+		ts = "string"
+	case integerKind, numberKind:
+		ts = "number"
+	case booleanKind:
+		ts = "boolean"
+	case arrayKind:
+		ts = tsType(t.elem)
+		if strings.Contains(ts, " ") {
+			ts = "(" + ts + ")"
+		}
+		ts += "[]"
+	case mapKind:
+		ts = "Record<string, " + tsType(t.elem) + ">"
+	case namedKind:
+		ts = t.name
+	case unionKind:
+		members := make([]string, 0, len(t.members))
+		for _, m := range t.members {
+			members = append(members, tsType(m))
+		}
+		ts = strings.Join(members, " | ")
+	default:
+		ts = "unknown"
+	}
+	if t.nullable {
+		ts += " | null"
+	}
+	return ts
+}
+
+// tsLiteral renders a value as a TypeScript literal
+func tsLiteral(v any) string {
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// writeTSComment writes the text as a TSDoc comment
+func writeTSComment(sb *strings.Builder, text string, indent string) {
+	if text == "" {
+		return
+	}
+	// a description can't close the comment early
+	lines := strings.Split(strings.ReplaceAll(strings.TrimSpace(text), "*/", "*\\/"), "\n")
+	if len(lines) == 1 {
+		sb.WriteString(indent + "/** " + lines[0] + " */\n")
+		return
+	}
+	sb.WriteString(indent + "/**\n")
+	for _, line := range lines {
+		sb.WriteString(strings.TrimRight(indent+" * "+line, " ") + "\n")
+	}
+	sb.WriteString(indent + " */\n")
+}
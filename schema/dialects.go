@@ -0,0 +1,370 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/theirish81/frags/util"
+)
+
+// Dialect describes the subset of JSON Schema an AI engine accepts for structured output, and how a schema should be
+// rewritten to fit it. Plans are written against the full Schema, and Downlevel adapts them to the engine, while the
+// answer keeps being validated locally against the original schema.
+type Dialect struct {
+	// Name is the name of the dialect, used in logs
+	Name string
+	// Keywords are the supported keywords, by their JSON name. Unsupported keywords are dropped. type, properties,
+	// items and required are always supported
+	Keywords []string
+	// InlineRefs replaces the $defs and definitions references with the schema they point to. Circular references
+	// can't be inlined and are dropped
+	InlineRefs bool
+	// MergeAllOf merges the allOf sub-schemas into the schema that contains them
+	MergeAllOf bool
+	// OneOfToAnyOf turns oneOf into anyOf
+	OneOfToAnyOf bool
+	// ConstToEnum turns const into a single value enum
+	ConstToEnum bool
+	// StrictObjects disallows additional properties on objects and makes all the properties required. The properties
+	// that were optional become nullable, so the engine can still omit a value. See PruneNulls
+	StrictObjects bool
+	// NullableToTypeUnion renders nullable as a type union (i.e. ["string", "null"]). See Render
+	NullableToTypeUnion bool
+}
+
+// GeminiDialect is the subset of JSON Schema supported by the Gemini genai.Schema
+var GeminiDialect = Dialect{
+	Name: "gemini",
+	Keywords: []string{"anyOf", "default", "description", "enum", "example", "format", "maxItems", "maxLength",
+		"maxProperties", "maximum", "minItems", "minLength", "minProperties", "minimum", "nullable", "pattern",
+		"propertyOrdering", "title"},
+	InlineRefs:   true,
+	MergeAllOf:   true,
+	OneOfToAnyOf: true,
+	ConstToEnum:  true,
+}
+
+// OpenAIDialect is the subset of JSON Schema supported by the OpenAI structured outputs, in strict mode
+var OpenAIDialect = Dialect{
+	Name: "openai",
+	Keywords: []string{"anyOf", "additionalProperties", "const", "description", "enum", "exclusiveMaximum",
+		"exclusiveMinimum", "format", "maxItems", "maximum", "minItems", "minimum", "multipleOf", "nullable", "pattern",
+		"title"},
+	InlineRefs:          true,
+	MergeAllOf:          true,
+	OneOfToAnyOf:        true,
+	StrictObjects:       true,
+	NullableToTypeUnion: true,
+}
+
+// AnthropicDialect is the subset of JSON Schema supported by the Claude structured outputs
+var AnthropicDialect = Dialect{
+	Name: "anthropic",
+	Keywords: []string{"anyOf", "oneOf", "default", "description", "enum", "example", "format", "maxProperties",
+		"minProperties", "nullable", "pattern", "propertyOrdering", "title"},
+	InlineRefs:  true,
+	MergeAllOf:  true,
+	ConstToEnum: true,
+}
+
+// OllamaDialect is the subset of JSON Schema that Ollama can turn into a grammar
+var OllamaDialect = Dialect{
+	Name: "ollama",
+	Keywords: []string{"additionalProperties", "allOf", "anyOf", "const", "description", "enum", "format",
+		"maxItems", "maxLength", "maximum", "minItems", "minLength", "minimum", "nullable", "oneOf", "pattern",
+		"prefixItems", "title"},
+	InlineRefs: true,
+}
+
+// alwaysSupportedKeywords are the keywords no structured output can do without
+var alwaysSupportedKeywords = []string{"type", "properties", "items", "required"}
+
+// Downlevel returns a copy of the schema rewritten for the dialect, along with the paths of the keywords that have been
+// dropped because the dialect doesn't support them. The schema itself is not modified, so it can still be used to
+// validate the answer.
+func (s *Schema) Downlevel(dialect Dialect) (*Schema, []string, error) {
+	if s == nil {
+		return nil, nil, nil
+	}
+	out, err := s.clone()
+	if err != nil {
+		return nil, nil, err
+	}
+	defs := out.Defs
+	definitions := out.Definitions
+	// the paths where a reference has been inlined, to detect cycles
+	inlined := make(map[string][]string)
+	dropped := make([]string, 0)
+	out.Walk("", func(path string, node *Schema) bool {
+		inline := func(node *Schema, path string) {
+			if !dialect.InlineRefs || node.Ref == nil {
+				return
+			}
+			inlineRef(node, path, defs, definitions, inlined)
+			if node.Ref != nil {
+				dropped = append(dropped, joinPath(path, "$ref"))
+				node.Ref = nil
+			}
+		}
+		inline(node, path)
+		if dialect.MergeAllOf && len(node.AllOf) > 0 {
+			for i, sub := range node.AllOf {
+				if sub == nil {
+					continue
+				}
+				inline(sub, fmt.Sprintf("%s[%d]", joinPath(path, "allOf"), i))
+				mergeSchema(node, sub)
+			}
+			node.AllOf = nil
+		}
+		if dialect.OneOfToAnyOf && len(node.OneOf) > 0 {
+			node.AnyOf = append(node.AnyOf, node.OneOf...)
+			node.OneOf = nil
+		}
+		if dialect.ConstToEnum && node.Const != nil && !slices.Contains(dialect.Keywords, "const") {
+			if len(node.Enum) == 0 {
+				node.Enum = []any{node.Const}
+			}
+			node.Const = nil
+		}
+		dropped = append(dropped, dropKeywords(node, path, dialect)...)
+		// maps (objects with no properties, or with an additionalProperties schema) are left alone, as forbidding
+		// additional properties would leave them empty. A schema with maps is not strict, see IsStrict
+		if dialect.StrictObjects && len(node.Properties) > 0 &&
+			(node.AdditionalProperties == nil || node.AdditionalProperties.Schema == nil) {
+			strictObject(node)
+		}
+		return true
+	})
+	return out, dropped, nil
+}
+
+// Render marshals the downleveled schema to a map, applying the rendering rules of the dialect.
+func (d Dialect) Render(s *Schema) (map[string]any, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	out := make(map[string]any)
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	if d.NullableToTypeUnion {
+		nullableToTypeUnion(out)
+	}
+	return out, nil
+}
+
+// PruneNulls removes from the value the null properties that the schema doesn't allow but that are not required
+// either. These are the properties a StrictObjects dialect turned into required and nullable, so removing them brings
+// the answer back to what the original schema expects.
+func (s *Schema) PruneNulls(value any) any {
+	if s == nil {
+		return value
+	}
+	switch t := value.(type) {
+	case map[string]any:
+		for k, v := range t {
+			propSchema, ok := s.Properties[k]
+			if !ok {
+				continue
+			}
+			if v == nil && !slices.Contains(s.Required, k) && (propSchema.Nullable == nil || !*propSchema.Nullable) {
+				delete(t, k)
+				continue
+			}
+			t[k] = propSchema.PruneNulls(v)
+		}
+	case []any:
+		for i, v := range t {
+			if i < len(s.PrefixItems) {
+				t[i] = s.PrefixItems[i].PruneNulls(v)
+			} else {
+				t[i] = s.Items.PruneNulls(v)
+			}
+		}
+	}
+	return value
+}
+
+// clone deep copies the schema
+func (s *Schema) clone() (*Schema, error) {
+	data, err := json.Marshal(s)
+	if err != nil {
+		return nil, err
+	}
+	out := &Schema{}
+	return out, json.Unmarshal(data, out)
+}
+
+// inlineRef replaces the node with the $defs or definitions schema its reference points to, unless the same reference
+// has already been inlined in one of its ancestors
+func inlineRef(node *Schema, path string, defs map[string]*Schema, definitions map[string]*Schema,
+	inlined map[string][]string) {
+	ref := *node.Ref
+	var target *Schema
+	if name, ok := strings.CutPrefix(ref, "#/$defs/"); ok {
+		target = defs[name]
+	} else if name, ok := strings.CutPrefix(ref, "#/definitions/"); ok {
+		target = definitions[name]
+	}
+	if target == nil {
+		return
+	}
+	for _, ancestor := range inlined[ref] {
+		if ancestor == "" || strings.HasPrefix(path, ancestor+".") {
+			return
+		}
+	}
+	resolved, err := target.clone()
+	if err != nil {
+		return
+	}
+	xSession := node.XSession
+	nullable := node.Nullable
+	*node = *resolved
+	node.XSession = xSession
+	if nullable != nil {
+		node.Nullable = nullable
+	}
+	inlined[ref] = append(inlined[ref], path)
+}
+
+// mergeSchema merges the src schema into dst. Properties and required are merged, any other keyword is copied only if
+// dst doesn't have it already
+func mergeSchema(dst *Schema, src *Schema) {
+	if src == nil {
+		return
+	}
+	for k, v := range src.Properties {
+		if dst.Properties == nil {
+			dst.Properties = make(map[string]*Schema)
+		}
+		if _, ok := dst.Properties[k]; !ok {
+			dst.Properties[k] = v
+		}
+	}
+	for _, req := range src.Required {
+		if !slices.Contains(dst.Required, req) {
+			dst.Required = append(dst.Required, req)
+		}
+	}
+	dstValue := reflect.ValueOf(dst).Elem()
+	srcValue := reflect.ValueOf(src).Elem()
+	for i := 0; i < dstValue.NumField(); i++ {
+		if dstValue.Field(i).IsZero() {
+			dstValue.Field(i).Set(srcValue.Field(i))
+		}
+	}
+}
+
+// dropKeywords zeroes the keywords of the node that the dialect doesn't support, and returns their paths. Extensions
+// (x-session, x-ui) are dropped silently, as they only matter to Frags
+func dropKeywords(node *Schema, path string, dialect Dialect) []string {
+	dropped := make([]string, 0)
+	value := reflect.ValueOf(node).Elem()
+	for i := 0; i < value.NumField(); i++ {
+		name, _, _ := strings.Cut(value.Type().Field(i).Tag.Get("json"), ",")
+		if value.Field(i).IsZero() || slices.Contains(alwaysSupportedKeywords, name) ||
+			slices.Contains(dialect.Keywords, name) {
+			continue
+		}
+		value.Field(i).Set(reflect.Zero(value.Field(i).Type()))
+		if name == "-" || strings.HasPrefix(name, "x-") {
+			continue
+		}
+		// definitions have been inlined, there's nothing to report
+		if dialect.InlineRefs && (name == "$defs" || name == "definitions") {
+			continue
+		}
+		dropped = append(dropped, joinPath(path, name))
+	}
+	return dropped
+}
+
+// strictObject disallows additional properties and makes all the properties required. Optional properties become
+// nullable, and null joins the values of their enum or const
+func strictObject(node *Schema) {
+	node.AdditionalProperties = &AdditionalProperties{Allowed: false}
+	for _, k := range sortedKeys(node.Properties) {
+		if slices.Contains(node.Required, k) {
+			continue
+		}
+		node.Required = append(node.Required, k)
+		property := node.Properties[k]
+		property.Nullable = util.Ptr(true)
+		if property.Const != nil {
+			property.Enum = []any{property.Const}
+			property.Const = nil
+		}
+		if len(property.Enum) > 0 && !slices.Contains(property.Enum, nil) {
+			property.Enum = append(property.Enum, nil)
+		}
+	}
+}
+
+// IsStrict returns true if every object of the schema has its properties and forbids any other, as the strict mode of
+// the structured outputs requires. A downleveled schema with maps is not strict.
+func (s *Schema) IsStrict() bool {
+	strict := true
+	s.Walk("", func(_ string, node *Schema) bool {
+		if node.Type == Object || len(node.Properties) > 0 || node.AdditionalProperties != nil {
+			if node.AdditionalProperties == nil || node.AdditionalProperties.Allowed ||
+				node.AdditionalProperties.Schema != nil {
+				strict = false
+			}
+		}
+		return strict
+	})
+	return strict
+}
+
+// nullableToTypeUnion rewrites, recursively, nullable: true into a type union with null
+func nullableToTypeUnion(node map[string]any) {
+	if nullable, ok := node["nullable"].(bool); ok {
+		delete(node, "nullable")
+		if nullable {
+			if t, ok := node["type"].(string); ok {
+				node["type"] = []any{t, "null"}
+			} else if anyOf, ok := node["anyOf"].([]any); ok {
+				node["anyOf"] = append(anyOf, map[string]any{"type": "null"})
+			}
+		}
+	}
+	for k, v := range node {
+		// values are data, not schemas
+		if slices.Contains([]string{"const", "default", "enum", "example"}, k) {
+			continue
+		}
+		switch t := v.(type) {
+		case map[string]any:
+			nullableToTypeUnion(t)
+		case []any:
+			for _, item := range t {
+				if m, ok := item.(map[string]any); ok {
+					nullableToTypeUnion(m)
+				}
+			}
+		}
+	}
+}
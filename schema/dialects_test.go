@@ -0,0 +1,166 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/util"
+)
+
+func dialectTestSchema() *Schema {
+	return &Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"name":    {Type: String, MinLength: util.Ptr(int64(2)), XSession: util.Ptr("s1")},
+			"kind":    {Type: String, Const: "invoice"},
+			"payment": {OneOf: []*Schema{{Type: String}, {Type: Integer}}},
+			"tags":    {Type: Array, Items: &Schema{Type: String}, UniqueItems: util.Ptr(true)},
+			"address": {Ref: util.Ptr("#/$defs/Address")},
+		},
+		Required: []string{"name"},
+		AllOf: []*Schema{{
+			Properties: map[string]*Schema{"total": {Type: Number, MultipleOf: util.Ptr(0.01)}},
+			Required:   []string{"total"},
+		}},
+		Defs: map[string]*Schema{
+			"Address": {Type: Object, Properties: map[string]*Schema{"city": {Type: String}}},
+		},
+	}
+}
+
+func TestSchema_Downlevel(t *testing.T) {
+	t.Run("gemini", func(t *testing.T) {
+		original := dialectTestSchema()
+		s, dropped, err := original.Downlevel(GeminiDialect)
+		assert.NoError(t, err)
+		assert.Nil(t, s.AllOf)
+		assert.Equal(t, []string{"name", "total"}, s.Required)
+		assert.Equal(t, Type("number"), s.Properties["total"].Type)
+		assert.Nil(t, s.Properties["payment"].OneOf)
+		assert.Len(t, s.Properties["payment"].AnyOf, 2)
+		assert.Nil(t, s.Properties["kind"].Const)
+		assert.Equal(t, []any{"invoice"}, s.Properties["kind"].Enum)
+		assert.Nil(t, s.Properties["address"].Ref)
+		assert.Equal(t, Type("string"), s.Properties["address"].Properties["city"].Type)
+		assert.Nil(t, s.Defs)
+		assert.Nil(t, s.Properties["name"].XSession)
+		assert.Equal(t, int64(2), *s.Properties["name"].MinLength)
+		assert.ElementsMatch(t, []string{"properties.tags.uniqueItems", "properties.total.multipleOf"}, dropped)
+
+		// the original schema is left untouched, to validate the answer
+		assert.Len(t, original.AllOf, 1)
+		assert.NotNil(t, original.Properties["address"].Ref)
+		assert.Equal(t, "s1", *original.Properties["name"].XSession)
+	})
+	t.Run("openai", func(t *testing.T) {
+		s, dropped, err := dialectTestSchema().Downlevel(OpenAIDialect)
+		assert.NoError(t, err)
+		assert.ElementsMatch(t, []string{"properties.name.minLength", "properties.tags.uniqueItems"}, dropped)
+		assert.Equal(t, &AdditionalProperties{Allowed: false}, s.AdditionalProperties)
+		assert.Equal(t, &AdditionalProperties{Allowed: false}, s.Properties["address"].AdditionalProperties)
+		assert.ElementsMatch(t, []string{"name", "total", "address", "kind", "payment", "tags"}, s.Required)
+		assert.Nil(t, s.Properties["name"].Nullable)
+		assert.True(t, *s.Properties["tags"].Nullable)
+		assert.True(t, *s.Properties["address"].Nullable)
+		// optional enums and consts accept null, as the property is nullable
+		assert.Nil(t, s.Properties["kind"].Const)
+		assert.Equal(t, []any{"invoice", nil}, s.Properties["kind"].Enum)
+		assert.True(t, s.IsStrict())
+
+		rendered, err := OpenAIDialect.Render(s)
+		assert.NoError(t, err)
+		properties := rendered["properties"].(map[string]any)
+		assert.Equal(t, "string", properties["name"].(map[string]any)["type"])
+		assert.Equal(t, []any{"array", "null"}, properties["tags"].(map[string]any)["type"])
+		assert.NotContains(t, properties["tags"].(map[string]any), "nullable")
+		assert.Equal(t, []any{"object", "null"}, properties["address"].(map[string]any)["type"])
+		anyOf := properties["payment"].(map[string]any)["anyOf"].([]any)
+		assert.Equal(t, map[string]any{"type": "null"}, anyOf[len(anyOf)-1])
+		assert.Equal(t, false, rendered["additionalProperties"])
+	})
+	t.Run("openai maps", func(t *testing.T) {
+		s := &Schema{
+			Type: Object,
+			Properties: map[string]*Schema{
+				"labels":   {Type: Object, AdditionalProperties: &AdditionalProperties{Schema: &Schema{Type: String}}},
+				"metadata": {Type: Object},
+				"status":   {Type: String, Enum: []any{"open", "closed"}},
+			},
+			Required: []string{"labels"},
+		}
+		out, _, err := s.Downlevel(OpenAIDialect)
+		assert.NoError(t, err)
+		// maps keep their values, and the schema can't be sent in strict mode
+		assert.Equal(t, &Schema{Type: String}, out.Properties["labels"].AdditionalProperties.Schema)
+		assert.Nil(t, out.Properties["metadata"].AdditionalProperties)
+		assert.Equal(t, &AdditionalProperties{Allowed: false}, out.AdditionalProperties)
+		assert.Equal(t, []any{"open", "closed", nil}, out.Properties["status"].Enum)
+		assert.False(t, out.IsStrict())
+
+		rendered, err := OpenAIDialect.Render(out)
+		assert.NoError(t, err)
+		status := rendered["properties"].(map[string]any)["status"].(map[string]any)
+		assert.Equal(t, []any{"string", "null"}, status["type"])
+		assert.Equal(t, []any{"open", "closed", nil}, status["enum"])
+	})
+	t.Run("circular references", func(t *testing.T) {
+		s := &Schema{
+			Ref: util.Ptr("#/$defs/Node"),
+			Defs: map[string]*Schema{
+				"Node": {
+					Type: Object,
+					Properties: map[string]*Schema{
+						"children": {Type: Array, Items: &Schema{Ref: util.Ptr("#/$defs/Node")}},
+					},
+				},
+			},
+		}
+		out, dropped, err := s.Downlevel(OllamaDialect)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{"properties.children.items.$ref"}, dropped)
+		assert.Equal(t, Type("array"), out.Properties["children"].Type)
+		assert.Nil(t, out.Properties["children"].Items.Ref)
+	})
+}
+
+func TestSchema_PruneNulls(t *testing.T) {
+	s := &Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"name":     {Type: String},
+			"nickname": {Type: String},
+			"note":     {Type: String, Nullable: util.Ptr(true)},
+			"items": {Type: Array, Items: &Schema{
+				Type:       Object,
+				Properties: map[string]*Schema{"sku": {Type: String}, "color": {Type: String}},
+			}},
+		},
+		Required: []string{"name"},
+	}
+	var value any
+	assert.NoError(t, json.Unmarshal([]byte(`{"name":null,"nickname":null,"note":null,
+		"items":[{"sku":"a","color":null}]}`), &value))
+	assert.Equal(t, map[string]any{
+		"name":  nil,
+		"note":  nil,
+		"items": []any{map[string]any{"sku": "a"}},
+	}, s.PruneNulls(value))
+}
@@ -0,0 +1,230 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// FormatValidator checks that a string matches a format. When coerce is true (soft validation), it should try to
+// normalize the value rather than failing, i.e. turning "March 5, 2026" into "2026-03-05" for the date format. It
+// returns the value, normalized if coerced.
+type FormatValidator func(value string, coerce bool) (string, error)
+
+var (
+	formats = map[string]FormatValidator{
+		"date":      validateDate,
+		"date-time": validateDateTime,
+		"time":      validateTime,
+		"email":     validateEmail,
+		"uri":       validateURI,
+		"uuid":      validateUUID,
+		"ipv4":      validateIPv4,
+		"ipv6":      validateIPv6,
+		"hostname":  validateHostname,
+	}
+	formatsMutex = sync.RWMutex{}
+)
+
+// RegisterFormat registers a format validator, so strings with that format are validated by it. Registering an
+// existing format, built-in ones included, replaces its validator. Unknown formats are not validated.
+func RegisterFormat(name string, validator FormatValidator) {
+	formatsMutex.Lock()
+	defer formatsMutex.Unlock()
+	formats[name] = validator
+}
+
+// getFormat returns the validator of the format, if any
+func getFormat(name string) (FormatValidator, bool) {
+	if name == "" {
+		return nil, false
+	}
+	formatsMutex.RLock()
+	defer formatsMutex.RUnlock()
+	validator, ok := formats[name]
+	return validator, ok
+}
+
+const (
+	dateLayout = "2006-01-02"
+	timeLayout = "15:04:05"
+)
+
+// dateLayouts are the unambiguous layouts a date is coerced from
+var dateLayouts = []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006/01/02", "2006.01.02",
+	"20060102", "January 2, 2006", "Jan 2, 2006", "2 January 2006", "2 Jan 2006", "Monday, January 2, 2006"}
+
+// dateTimeLayouts are the layouts a date-time is coerced from. Layouts with no time zone are considered UTC
+var dateTimeLayouts = []string{"2006-01-02T15:04:05", "2006-01-02 15:04:05Z07:00", "2006-01-02 15:04:05",
+	"2006-01-02T15:04", "2006-01-02 15:04", time.RFC1123Z, time.RFC1123, time.RFC850, time.RFC822Z, time.RFC822,
+	time.ANSIC, time.UnixDate}
+
+// timeLayouts are the layouts a time is coerced from
+var timeLayouts = []string{"15:04", "3:04PM", "3:04 PM", "3:04:05PM", "3:04:05 PM", "3PM", "3 PM"}
+
+func validateDate(value string, coerce bool) (string, error) {
+	if _, err := time.Parse(dateLayout, value); err == nil || !coerce {
+		return value, err
+	}
+	trimmed := strings.TrimSpace(value)
+	for _, layout := range append([]string{dateLayout}, dateLayouts...) {
+		if t, err := time.Parse(layout, trimmed); err == nil {
+			return t.Format(dateLayout), nil
+		}
+	}
+	return value, fmt.Errorf("cannot parse %q as a date", value)
+}
+
+func validateDateTime(value string, coerce bool) (string, error) {
+	if _, err := time.Parse(time.RFC3339Nano, value); err == nil || !coerce {
+		return value, err
+	}
+	trimmed := strings.TrimSpace(value)
+	for _, layout := range append([]string{time.RFC3339Nano}, dateTimeLayouts...) {
+		if t, err := time.Parse(layout, trimmed); err == nil {
+			return t.Format(time.RFC3339Nano), nil
+		}
+	}
+	return value, fmt.Errorf("cannot parse %q as a date-time", value)
+}
+
+func validateTime(value string, coerce bool) (string, error) {
+	// RFC 3339 full-time, with the offset being optional
+	for _, layout := range []string{timeLayout + ".999999999Z07:00", timeLayout + ".999999999"} {
+		if _, err := time.Parse(layout, value); err == nil {
+			return value, nil
+		}
+	}
+	if coerce {
+		trimmed := strings.ToUpper(strings.TrimSpace(value))
+		for _, layout := range timeLayouts {
+			if t, err := time.Parse(layout, trimmed); err == nil {
+				return t.Format(timeLayout), nil
+			}
+		}
+	}
+	return value, fmt.Errorf("cannot parse %q as a time", value)
+}
+
+func validateEmail(value string, coerce bool) (string, error) {
+	address, err := mail.ParseAddress(value)
+	if err != nil {
+		if coerce {
+			if address, err = mail.ParseAddress(strings.TrimSpace(value)); err == nil {
+				return address.Address, nil
+			}
+		}
+		return value, err
+	}
+	if address.Address != value {
+		// "Name <name@example.com>" is a valid address, but not a valid email
+		if coerce {
+			return address.Address, nil
+		}
+		return value, errors.New("expected a bare email address")
+	}
+	return value, nil
+}
+
+func validateURI(value string, coerce bool) (string, error) {
+	if coerce {
+		value = strings.TrimSpace(value)
+	}
+	u, err := url.Parse(value)
+	if err != nil {
+		return value, err
+	}
+	if !u.IsAbs() {
+		return value, errors.New("the URI has no scheme")
+	}
+	return value, nil
+}
+
+// uuidPattern is the canonical UUID format. uuid.Parse accepts more forms, which we only accept when coercing
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+func validateUUID(value string, coerce bool) (string, error) {
+	if uuidPattern.MatchString(value) {
+		return value, nil
+	}
+	if coerce {
+		if id, err := uuid.Parse(strings.TrimSpace(value)); err == nil {
+			return id.String(), nil
+		}
+	}
+	return value, errors.New("expected a UUID in the 8-4-4-4-12 format")
+}
+
+func validateIPv4(value string, coerce bool) (string, error) {
+	if coerce {
+		value = strings.TrimSpace(value)
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return value, err
+	}
+	if !addr.Is4() {
+		return value, errors.New("expected an IPv4 address")
+	}
+	return value, nil
+}
+
+func validateIPv6(value string, coerce bool) (string, error) {
+	if coerce {
+		value = strings.TrimSpace(value)
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return value, err
+	}
+	if !addr.Is6() || addr.Zone() != "" {
+		return value, errors.New("expected an IPv6 address")
+	}
+	if coerce {
+		return addr.String(), nil
+	}
+	return value, nil
+}
+
+// hostnameLabelPattern is a hostname label, as per RFC 1123
+var hostnameLabelPattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+func validateHostname(value string, coerce bool) (string, error) {
+	if coerce {
+		value = strings.TrimSuffix(strings.ToLower(strings.TrimSpace(value)), ".")
+	}
+	if len(value) == 0 || len(value) > 253 {
+		return value, errors.New("a hostname must be between 1 and 253 characters long")
+	}
+	for _, label := range strings.Split(value, ".") {
+		if !hostnameLabelPattern.MatchString(label) {
+			return value, fmt.Errorf("invalid hostname label %q", label)
+		}
+	}
+	return value, nil
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSchema_ValidateFormats(t *testing.T) {
+	cases := []struct {
+		format  string
+		valid   []string
+		invalid []string
+	}{
+		{"date", []string{"2026-03-05"}, []string{"2026-3-5", "05/03/2026", "2026-02-30"}},
+		{"date-time", []string{"2026-03-05T10:20:30Z", "2026-03-05T10:20:30.5+02:00"},
+			[]string{"2026-03-05", "2026-03-05 10:20:30"}},
+		{"time", []string{"10:20:30", "10:20:30.123Z", "10:20:30+02:00"}, []string{"10:20", "25:00:00"}},
+		{"email", []string{"jane@example.com"}, []string{"jane", "Jane <jane@example.com>"}},
+		{"uri", []string{"https://example.com/a?b=c", "urn:isbn:0451450523"}, []string{"/relative/path", "::"}},
+		{"uuid", []string{"0f8fad5b-d9cb-469f-a165-70867728950e"},
+			[]string{"0f8fad5bd9cb469fa16570867728950e", "not-a-uuid"}},
+		{"ipv4", []string{"192.168.1.1"}, []string{"256.1.1.1", "::1"}},
+		{"ipv6", []string{"::1", "2001:db8::ff00:42:8329"}, []string{"192.168.1.1", "2001:db8::g"}},
+		{"hostname", []string{"example.com", "my-host"}, []string{"-bad.com", "under_score.com",
+			strings.Repeat("a", 64) + ".com"}},
+	}
+	for _, c := range cases {
+		t.Run(c.format, func(t *testing.T) {
+			s := Schema{Type: String, Format: c.format}
+			for _, v := range c.valid {
+				assert.NoError(t, s.Validate(v, nil), v)
+			}
+			for _, v := range c.invalid {
+				assert.Error(t, s.Validate(v, nil), v)
+			}
+		})
+	}
+	t.Run("unknown formats are not validated", func(t *testing.T) {
+		s := Schema{Type: String, Format: "enum"}
+		assert.NoError(t, s.Validate("anything", nil))
+	})
+}
+
+func TestSchema_ValidateFormats_Soft(t *testing.T) {
+	s := Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"day":   {Type: String, Format: "date"},
+			"at":    {Type: String, Format: "date-time"},
+			"time":  {Type: String, Format: "time"},
+			"email": {Type: String, Format: "email"},
+			"id":    {Type: String, Format: "uuid"},
+			"host":  {Type: String, Format: "hostname"},
+			"days":  {Type: Array, Items: &Schema{Type: String, Format: "date"}},
+		},
+	}
+	data := map[string]any{
+		"day":   "March 5, 2026",
+		"at":    "2026-03-05 10:20:30",
+		"time":  "3:04 pm",
+		"email": "Jane <jane@example.com>",
+		"id":    "{0F8FAD5B-D9CB-469F-A165-70867728950E}",
+		"host":  "Example.COM.",
+		"days":  []any{"2026/03/05", "20260306"},
+	}
+	assert.NoError(t, s.Validate(data, &ValidatorOptions{SoftValidation: true}))
+	assert.Equal(t, map[string]any{
+		"day":   "2026-03-05",
+		"at":    "2026-03-05T10:20:30Z",
+		"time":  "15:04:00",
+		"email": "jane@example.com",
+		"id":    "0f8fad5b-d9cb-469f-a165-70867728950e",
+		"host":  "example.com",
+		"days":  []any{"2026-03-05", "2026-03-06"},
+	}, data)
+
+	data = map[string]any{"day": "05/03/2026"}
+	assert.Error(t, s.Validate(data, &ValidatorOptions{SoftValidation: true}))
+}
+
+func TestRegisterFormat(t *testing.T) {
+	RegisterFormat("country", func(value string, coerce bool) (string, error) {
+		if coerce {
+			value = strings.ToUpper(value)
+		}
+		if value != "IT" && value != "IE" {
+			return value, errors.New("unknown country")
+		}
+		return value, nil
+	})
+	s := Schema{Type: Object, Properties: map[string]*Schema{"country": {Type: String, Format: "country"}}}
+	assert.NoError(t, s.Validate(map[string]any{"country": "IT"}, nil))
+	assert.ErrorContains(t, s.Validate(map[string]any{"country": "it"}, nil), "string is not a valid country")
+	data := map[string]any{"country": "ie"}
+	assert.NoError(t, s.Validate(data, &ValidatorOptions{SoftValidation: true}))
+	assert.Equal(t, "IE", data["country"])
+}
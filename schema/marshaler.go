@@ -96,7 +96,7 @@ func (s *Schema) UnmarshalJSON(data []byte) error {
 	// The explosion will happen as soon as the LLM sees it, so it's a blocker.
 	// Given this is a rare event, we decided to cover that case and convert it to items -> type: string
 	// Not perfect, but close enough, I guess.
-	if s.Type == "array" && s.Items == nil {
+	if s.Type == "array" && s.Items == nil && len(s.PrefixItems) == 0 {
 		s.Items = &Schema{Type: "string"}
 	}
 	for k, v := range raw {
@@ -134,6 +134,27 @@ func (s Schema) MarshalYAML() (any, error) {
 	if len(s.AnyOf) > 0 {
 		add("anyOf", s.AnyOf)
 	}
+	if len(s.AllOf) > 0 {
+		add("allOf", s.AllOf)
+	}
+	if s.Not != nil {
+		add("not", s.Not)
+	}
+	if s.If != nil {
+		add("if", s.If)
+	}
+	if s.Then != nil {
+		add("then", s.Then)
+	}
+	if s.Else != nil {
+		add("else", s.Else)
+	}
+	if s.AdditionalProperties != nil {
+		add("additionalProperties", s.AdditionalProperties)
+	}
+	if s.Const != nil {
+		add("const", s.Const)
+	}
 	if s.Default != nil {
 		add("default", s.Default)
 	}
@@ -146,6 +167,12 @@ func (s Schema) MarshalYAML() (any, error) {
 	if s.Example != nil {
 		add("example", s.Example)
 	}
+	if s.ExclusiveMaximum != nil {
+		add("exclusiveMaximum", s.ExclusiveMaximum)
+	}
+	if s.ExclusiveMinimum != nil {
+		add("exclusiveMinimum", s.ExclusiveMinimum)
+	}
 	if s.Format != "" {
 		add("format", s.Format)
 	}
@@ -176,12 +203,21 @@ func (s Schema) MarshalYAML() (any, error) {
 	if s.Minimum != nil {
 		add("minimum", s.Minimum)
 	}
+	if s.MultipleOf != nil {
+		add("multipleOf", s.MultipleOf)
+	}
 	if s.Nullable != nil {
 		add("nullable", s.Nullable)
 	}
 	if s.Pattern != "" {
 		add("pattern", s.Pattern)
 	}
+	if len(s.PatternProperties) > 0 {
+		add("patternProperties", s.PatternProperties)
+	}
+	if len(s.PrefixItems) > 0 {
+		add("prefixItems", s.PrefixItems)
+	}
 	if len(s.Properties) > 0 {
 		add("properties", s.Properties)
 	}
@@ -197,12 +233,21 @@ func (s Schema) MarshalYAML() (any, error) {
 	if s.Type != "" {
 		add("type", s.Type)
 	}
+	if s.UniqueItems != nil {
+		add("uniqueItems", s.UniqueItems)
+	}
 	if s.XSession != nil {
 		add("x-session", s.XSession)
 	}
 	if s.Ref != nil {
 		add("$ref", s.Ref)
 	}
+	if len(s.Defs) > 0 {
+		add("$defs", s.Defs)
+	}
+	if len(s.Definitions) > 0 {
+		add("definitions", s.Definitions)
+	}
 
 	for k, v := range s.XUI {
 		add("x-ui-"+k, v)
@@ -261,7 +306,7 @@ func (s *Schema) UnmarshalYAML(value *yaml.Node) error {
 	// The explosion will happen as soon as the LLM sees it, so it's a blocker.
 	// Given this is a rare event, we decided to cover that case and convert it to items -> type: string
 	// Not perfect, but close enough, I guess.
-	if s.Type == "array" && s.Items == nil {
+	if s.Type == "array" && s.Items == nil && len(s.PrefixItems) == 0 {
 		s.Items = &Schema{Type: "string"}
 	}
 	if value.Kind != yaml.MappingNode {
@@ -284,3 +329,41 @@ func (s *Schema) UnmarshalYAML(value *yaml.Node) error {
 	}
 	return nil
 }
+
+// MarshalJSON marshals the keyword either as a schema or as a boolean.
+func (a AdditionalProperties) MarshalJSON() ([]byte, error) {
+	if a.Schema != nil {
+		return json.Marshal(a.Schema)
+	}
+	return json.Marshal(a.Allowed)
+}
+
+// UnmarshalJSON unmarshals the keyword, which can either be a boolean or a schema.
+func (a *AdditionalProperties) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		a.Schema = nil
+		return nil
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return json.Unmarshal(data, a.Schema)
+}
+
+// MarshalYAML marshals the keyword either as a schema or as a boolean.
+func (a AdditionalProperties) MarshalYAML() (any, error) {
+	if a.Schema != nil {
+		return a.Schema, nil
+	}
+	return a.Allowed, nil
+}
+
+// UnmarshalYAML unmarshals the keyword, which can either be a boolean or a schema.
+func (a *AdditionalProperties) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		a.Schema = nil
+		return value.Decode(&a.Allowed)
+	}
+	a.Allowed = true
+	a.Schema = &Schema{}
+	return value.Decode(a.Schema)
+}
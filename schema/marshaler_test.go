@@ -168,3 +168,71 @@ func TestType_MarshalAlwaysEmitsString_YAML(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, Type("string"), s2.Type)
 }
+
+func TestSchema_KeywordsRoundTrip(t *testing.T) {
+	src := `type: object
+allOf:
+  - required: [name]
+not:
+  const: forbidden
+if:
+  properties:
+    kind:
+      const: a
+then:
+  required: [a]
+else:
+  required: [b]
+additionalProperties: false
+patternProperties:
+  "^x-":
+    type: integer
+properties:
+  tags:
+    type: array
+    prefixItems:
+      - type: string
+    uniqueItems: true
+  nested:
+    type: object
+    additionalProperties:
+      type: string
+  amount:
+    type: number
+    multipleOf: 0.01
+    exclusiveMinimum: 0
+    exclusiveMaximum: 100
+`
+	s := Schema{}
+	assert.NoError(t, yaml.Unmarshal([]byte(src), &s))
+	check := func(s Schema) {
+		assert.Equal(t, []string{"name"}, s.AllOf[0].Required)
+		assert.Equal(t, "forbidden", s.Not.Const)
+		assert.Equal(t, "a", s.If.Properties["kind"].Const)
+		assert.Equal(t, []string{"a"}, s.Then.Required)
+		assert.Equal(t, []string{"b"}, s.Else.Required)
+		assert.Equal(t, &AdditionalProperties{Allowed: false}, s.AdditionalProperties)
+		assert.Equal(t, Type("integer"), s.PatternProperties["^x-"].Type)
+		assert.Equal(t, Type("string"), s.Properties["tags"].PrefixItems[0].Type)
+		assert.Nil(t, s.Properties["tags"].Items)
+		assert.True(t, *s.Properties["tags"].UniqueItems)
+		assert.Equal(t, Type("string"), s.Properties["nested"].AdditionalProperties.Schema.Type)
+		assert.Equal(t, 0.01, *s.Properties["amount"].MultipleOf)
+		assert.Equal(t, 0.0, *s.Properties["amount"].ExclusiveMinimum)
+		assert.Equal(t, 100.0, *s.Properties["amount"].ExclusiveMaximum)
+	}
+	check(s)
+
+	out, err := yaml.Marshal(s)
+	assert.NoError(t, err)
+	fromYAML := Schema{}
+	assert.NoError(t, yaml.Unmarshal(out, &fromYAML))
+	check(fromYAML)
+
+	out, err = json.Marshal(s)
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"additionalProperties":false`)
+	fromJSON := Schema{}
+	assert.NoError(t, json.Unmarshal(out, &fromJSON))
+	check(fromJSON)
+}
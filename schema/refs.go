@@ -0,0 +1,256 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/theirish81/frags/resources"
+	"gopkg.in/yaml.v3"
+)
+
+const componentsSchemasPointer = "/components/schemas/"
+
+// RefError is returned when a $ref cannot be resolved. It carries the file (empty for references to the plan
+// itself) and the JSON pointer that failed.
+type RefError struct {
+	Ref     string
+	File    string
+	Pointer string
+	Err     error
+}
+
+// Error returns the error message, naming the file and the pointer that failed.
+func (e *RefError) Error() string {
+	file := e.File
+	if file == "" {
+		file = "plan"
+	}
+	return fmt.Sprintf("cannot resolve $ref %q (file: %s, pointer: #%s): %s", e.Ref, file, e.Pointer, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *RefError) Unwrap() error {
+	return e.Err
+}
+
+// ErrRefNotFound is wrapped by RefError when the pointer doesn't match anything in the target document.
+var ErrRefNotFound = errors.New("schema not found")
+
+// Resolve resolves all the references in the schema. External file references are read from the file system.
+func (s *Schema) Resolve(schemas map[string]Schema) error {
+	return s.ResolveWithLoader(schemas, nil)
+}
+
+// ResolveWithLoader resolves all the references in the schema. Supported references are:
+//   - #/components/schemas/Name, pointing to the plan components
+//   - #/$defs/Name and #/definitions/Name, pointing to the definitions of the root schema
+//   - path/to/file.yaml#/json/pointer, pointing to a schema in another YAML or JSON file. Paths are relative to the
+//     document containing the reference. Files are loaded with the provided loader or, if nil, from the file system.
+//
+// Circular references are left in place, unresolved.
+func (s *Schema) ResolveWithLoader(schemas map[string]Schema, loader resources.ResourceLoader) error {
+	if s == nil {
+		return nil
+	}
+	r := resolver{
+		components:  schemas,
+		defs:        s.Defs,
+		definitions: s.Definitions,
+		loader:      loader,
+		documents:   make(map[string]any),
+		visited:     make(map[string]bool),
+	}
+	return r.resolve(s, "")
+}
+
+// resolver holds the state of a reference resolution
+type resolver struct {
+	components  map[string]Schema
+	defs        map[string]*Schema
+	definitions map[string]*Schema
+	loader      resources.ResourceLoader
+	documents   map[string]any
+	visited     map[string]bool
+}
+
+// resolve resolves all the references in the schema (recursive function). file is the document the schema comes
+// from, empty for the plan itself.
+func (r *resolver) resolve(schema *Schema, file string) error {
+	if schema == nil {
+		return nil
+	}
+	if schema.Ref != nil {
+		ref := *schema.Ref
+		refFile, pointer := splitRef(ref)
+		if refFile != "" && !path.IsAbs(refFile) {
+			refFile = path.Join(path.Dir(file), refFile)
+		} else if refFile == "" {
+			refFile = file
+		}
+		key := refFile + "#" + pointer
+		if r.visited[key] {
+			return nil
+		}
+		r.visited[key] = true
+		defer func() { delete(r.visited, key) }()
+		resolvedSchema, err := r.lookup(refFile, pointer)
+		if err != nil {
+			return &RefError{Ref: ref, File: refFile, Pointer: pointer, Err: err}
+		}
+		originalXSession := schema.XSession
+
+		*schema = resolvedSchema
+
+		schema.XSession = originalXSession
+		schema.Ref = nil
+		file = refFile
+	}
+
+	for _, sub := range schema.subSchemas() {
+		if err := r.resolve(sub, file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// lookup finds the schema the pointer refers to, in the given file
+func (r *resolver) lookup(file string, pointer string) (Schema, error) {
+	if file == "" {
+		return r.lookupLocal(pointer)
+	}
+	doc, err := r.document(file)
+	if err != nil {
+		return Schema{}, err
+	}
+	node, err := navigatePointer(doc, pointer)
+	if err != nil {
+		return Schema{}, err
+	}
+	data, err := yaml.Marshal(node)
+	if err != nil {
+		return Schema{}, err
+	}
+	schema := Schema{}
+	if err := yaml.Unmarshal(data, &schema); err != nil {
+		return Schema{}, err
+	}
+	return schema, nil
+}
+
+// lookupLocal finds the schema the pointer refers to, in the plan
+func (r *resolver) lookupLocal(pointer string) (Schema, error) {
+	var found *Schema
+	switch {
+	case strings.HasPrefix(pointer, componentsSchemasPointer):
+		if schema, ok := r.components[unescapePointerToken(strings.TrimPrefix(pointer, componentsSchemasPointer))]; ok {
+			found = &schema
+		}
+	case strings.HasPrefix(pointer, "/$defs/"):
+		found = r.defs[unescapePointerToken(strings.TrimPrefix(pointer, "/$defs/"))]
+	case strings.HasPrefix(pointer, "/definitions/"):
+		found = r.definitions[unescapePointerToken(strings.TrimPrefix(pointer, "/definitions/"))]
+	default:
+		return Schema{}, errors.New("unsupported reference, only #/components/schemas/, #/$defs/ and " +
+			"#/definitions/ are supported within the plan")
+	}
+	if found == nil {
+		return Schema{}, ErrRefNotFound
+	}
+	return *found, nil
+}
+
+// document loads and decodes the given file, caching the result
+func (r *resolver) document(file string) (any, error) {
+	if doc, ok := r.documents[file]; ok {
+		return doc, nil
+	}
+	var data []byte
+	if r.loader != nil {
+		resource, err := r.loader.LoadResource(file, nil)
+		if err != nil {
+			return nil, err
+		}
+		data = resource.ByteContent
+	} else {
+		var err error
+		if data, err = os.ReadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	var doc any
+	// YAML is a superset of JSON, so this covers both
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	r.documents[file] = doc
+	return doc, nil
+}
+
+// splitRef splits a reference into its file and JSON pointer parts
+func splitRef(ref string) (string, string) {
+	file, pointer, _ := strings.Cut(ref, "#")
+	return file, pointer
+}
+
+// navigatePointer walks the decoded document following the JSON pointer
+func navigatePointer(doc any, pointer string) (any, error) {
+	if pointer == "" || pointer == "/" {
+		return doc, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.New("invalid JSON pointer")
+	}
+	current := doc
+	for _, token := range strings.Split(pointer[1:], "/") {
+		token = unescapePointerToken(token)
+		switch t := current.(type) {
+		case map[string]any:
+			next, ok := t[token]
+			if !ok {
+				return nil, ErrRefNotFound
+			}
+			current = next
+		case []any:
+			idx, err := strconv.Atoi(token)
+			if err != nil || idx < 0 || idx >= len(t) {
+				return nil, ErrRefNotFound
+			}
+			current = t[idx]
+		default:
+			return nil, ErrRefNotFound
+		}
+	}
+	return current, nil
+}
+
+// escapePointerToken escapes a token to be used in a JSON pointer
+func escapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// unescapePointerToken reverts the JSON pointer escaping of a token
+func unescapePointerToken(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+}
@@ -0,0 +1,97 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package schema
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestSchema_ResolveExternal(t *testing.T) {
+	t.Run("from a file", func(t *testing.T) {
+		s := Schema{
+			Type: Object,
+			Properties: map[string]*Schema{
+				"invoice": {Ref: util.Ptr("test_data/invoice.yaml#/Invoice"), XSession: util.Ptr("s1")},
+			},
+		}
+		assert.NoError(t, s.Resolve(nil))
+		invoice := s.Properties["invoice"]
+		assert.Nil(t, invoice.Ref)
+		assert.Equal(t, "s1", *invoice.XSession)
+		assert.Equal(t, Type("string"), invoice.Properties["number"].Type)
+		assert.Equal(t, Type("number"), invoice.Properties["lines"].Items.Properties["amount"].Type)
+		address := invoice.Properties["customer"].Properties["address"]
+		assert.Nil(t, address.Ref)
+		assert.Equal(t, Type("string"), address.Properties["city"].Type)
+	})
+	t.Run("with a loader", func(t *testing.T) {
+		s := Schema{Ref: util.Ptr("invoice.yaml#/Customer")}
+		assert.NoError(t, s.ResolveWithLoader(nil, resources.NewFileResourceLoader("test_data")))
+		assert.Equal(t, Type("string"), s.Properties["address"].Properties["street"].Type)
+	})
+	t.Run("circular", func(t *testing.T) {
+		s := Schema{Ref: util.Ptr("test_data/tree.yaml#/Tree")}
+		assert.NoError(t, s.Resolve(nil))
+		node := s.Properties["root"]
+		assert.Equal(t, Type("string"), node.Properties["name"].Type)
+		assert.Equal(t, "./tree.yaml#/Tree", *node.Properties["children"].Items.Ref)
+	})
+	t.Run("not found", func(t *testing.T) {
+		s := Schema{Ref: util.Ptr("test_data/invoice.yaml#/Receipt")}
+		err := s.Resolve(nil)
+		refErr := &RefError{}
+		assert.True(t, errors.As(err, &refErr))
+		assert.Equal(t, "test_data/invoice.yaml", refErr.File)
+		assert.Equal(t, "/Receipt", refErr.Pointer)
+		assert.ErrorIs(t, err, ErrRefNotFound)
+		assert.Contains(t, err.Error(), "test_data/invoice.yaml")
+		assert.Contains(t, err.Error(), "#/Receipt")
+
+		s = Schema{Ref: util.Ptr("test_data/missing.yaml#/Receipt")}
+		assert.ErrorContains(t, s.Resolve(nil), "test_data/missing.yaml")
+	})
+}
+
+func TestSchema_ResolveDefs(t *testing.T) {
+	s := Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"a": {Ref: util.Ptr("#/$defs/A")},
+			"b": {Ref: util.Ptr("#/definitions/B")},
+		},
+		Defs: map[string]*Schema{
+			"A": {Type: Object, Properties: map[string]*Schema{"c": {Ref: util.Ptr("#/components/schemas/C")}}},
+		},
+		Definitions: map[string]*Schema{
+			"B": {Type: Integer},
+		},
+	}
+	assert.NoError(t, s.Resolve(map[string]Schema{"C": {Type: Boolean}}))
+	assert.Equal(t, Type("boolean"), s.Properties["a"].Properties["c"].Type)
+	assert.Equal(t, Type("integer"), s.Properties["b"].Type)
+
+	s = Schema{Ref: util.Ptr("#/$defs/Missing")}
+	assert.ErrorContains(t, s.Resolve(nil), "pointer: #/$defs/Missing")
+	s = Schema{Ref: util.Ptr("#/foo/Bar")}
+	assert.ErrorContains(t, s.Resolve(nil), "unsupported reference")
+}
@@ -22,7 +22,6 @@ import (
 	"errors"
 	"fmt"
 	"slices"
-	"strings"
 
 	"github.com/go-viper/mapstructure/v2"
 	"gopkg.in/yaml.v3"
@@ -39,32 +38,55 @@ type Type string
 
 // Schema represents a JSON schema with x-session extensions.
 type Schema struct {
-	OneOf            []*Schema          `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
-	AnyOf            []*Schema          `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
-	Default          any                `json:"default,omitempty" yaml:"default,omitempty"`
-	Description      string             `json:"description,omitempty" yaml:"description,omitempty"`
-	Enum             []any              `json:"enum,omitempty" yaml:"enum,omitempty"`
-	Example          any                `json:"example,omitempty" yaml:"example,omitempty"`
-	Format           string             `json:"format,omitempty" yaml:"format,omitempty"`
-	Items            *Schema            `json:"items,omitempty" yaml:"items,omitempty"`
-	MaxItems         *int64             `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
-	MaxLength        *int64             `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
-	MaxProperties    *int64             `json:"maxProperties,omitempty" yaml:"maxProperties,omitempty"`
-	Maximum          *float64           `json:"maximum,omitempty" yaml:"maximum,omitempty"`
-	MinItems         *int64             `json:"minItems,omitempty" yaml:"minItems,omitempty"`
-	MinLength        *int64             `json:"minLength,omitempty" yaml:"minLength,omitempty"`
-	MinProperties    *int64             `json:"minProperties,omitempty" yaml:"minProperties,omitempty"`
-	Minimum          *float64           `json:"minimum,omitempty" yaml:"minimum,omitempty"`
-	Nullable         *bool              `json:"nullable,omitempty" yaml:"nullable,omitempty"`
-	Pattern          string             `json:"pattern,omitempty" yaml:"pattern,omitempty"`
-	Properties       map[string]*Schema `json:"properties,omitempty" yaml:"properties,omitempty"`
-	PropertyOrdering []string           `json:"propertyOrdering,omitempty" yaml:"propertyOrdering,omitempty"`
-	Required         []string           `json:"required,omitempty" yaml:"required,omitempty"`
-	Title            string             `json:"title,omitempty" yaml:"title,omitempty"`
-	Type             Type               `json:"type,omitempty" yaml:"type,omitempty"`
-	XSession         *string            `json:"x-session,omitempty" yaml:"x-session,omitempty"`
-	Ref              *string            `json:"$ref,omitempty" yaml:"$ref,omitempty"`
-	XUI              map[string]any     `json:"-" yaml:"-"`
+	OneOf                []*Schema             `json:"oneOf,omitempty" yaml:"oneOf,omitempty"`
+	AnyOf                []*Schema             `json:"anyOf,omitempty" yaml:"anyOf,omitempty"`
+	AllOf                []*Schema             `json:"allOf,omitempty" yaml:"allOf,omitempty"`
+	Not                  *Schema               `json:"not,omitempty" yaml:"not,omitempty"`
+	If                   *Schema               `json:"if,omitempty" yaml:"if,omitempty"`
+	Then                 *Schema               `json:"then,omitempty" yaml:"then,omitempty"`
+	Else                 *Schema               `json:"else,omitempty" yaml:"else,omitempty"`
+	AdditionalProperties *AdditionalProperties `json:"additionalProperties,omitempty" yaml:"additionalProperties,omitempty"`
+	Const                any                   `json:"const,omitempty" yaml:"const,omitempty"`
+	Default              any                   `json:"default,omitempty" yaml:"default,omitempty"`
+	Description          string                `json:"description,omitempty" yaml:"description,omitempty"`
+	Enum                 []any                 `json:"enum,omitempty" yaml:"enum,omitempty"`
+	Example              any                   `json:"example,omitempty" yaml:"example,omitempty"`
+	ExclusiveMaximum     *float64              `json:"exclusiveMaximum,omitempty" yaml:"exclusiveMaximum,omitempty"`
+	ExclusiveMinimum     *float64              `json:"exclusiveMinimum,omitempty" yaml:"exclusiveMinimum,omitempty"`
+	Format               string                `json:"format,omitempty" yaml:"format,omitempty"`
+	Items                *Schema               `json:"items,omitempty" yaml:"items,omitempty"`
+	MaxItems             *int64                `json:"maxItems,omitempty" yaml:"maxItems,omitempty"`
+	MaxLength            *int64                `json:"maxLength,omitempty" yaml:"maxLength,omitempty"`
+	MaxProperties        *int64                `json:"maxProperties,omitempty" yaml:"maxProperties,omitempty"`
+	Maximum              *float64              `json:"maximum,omitempty" yaml:"maximum,omitempty"`
+	MinItems             *int64                `json:"minItems,omitempty" yaml:"minItems,omitempty"`
+	MinLength            *int64                `json:"minLength,omitempty" yaml:"minLength,omitempty"`
+	MinProperties        *int64                `json:"minProperties,omitempty" yaml:"minProperties,omitempty"`
+	Minimum              *float64              `json:"minimum,omitempty" yaml:"minimum,omitempty"`
+	MultipleOf           *float64              `json:"multipleOf,omitempty" yaml:"multipleOf,omitempty"`
+	Nullable             *bool                 `json:"nullable,omitempty" yaml:"nullable,omitempty"`
+	Pattern              string                `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	PatternProperties    map[string]*Schema    `json:"patternProperties,omitempty" yaml:"patternProperties,omitempty"`
+	PrefixItems          []*Schema             `json:"prefixItems,omitempty" yaml:"prefixItems,omitempty"`
+	Properties           map[string]*Schema    `json:"properties,omitempty" yaml:"properties,omitempty"`
+	PropertyOrdering     []string              `json:"propertyOrdering,omitempty" yaml:"propertyOrdering,omitempty"`
+	Required             []string              `json:"required,omitempty" yaml:"required,omitempty"`
+	Title                string                `json:"title,omitempty" yaml:"title,omitempty"`
+	Type                 Type                  `json:"type,omitempty" yaml:"type,omitempty"`
+	UniqueItems          *bool                 `json:"uniqueItems,omitempty" yaml:"uniqueItems,omitempty"`
+	XSession             *string               `json:"x-session,omitempty" yaml:"x-session,omitempty"`
+	Ref                  *string               `json:"$ref,omitempty" yaml:"$ref,omitempty"`
+	Defs                 map[string]*Schema    `json:"$defs,omitempty" yaml:"$defs,omitempty"`
+	Definitions          map[string]*Schema    `json:"definitions,omitempty" yaml:"definitions,omitempty"`
+	XUI                  map[string]any        `json:"-" yaml:"-"`
+}
+
+// AdditionalProperties represents the additionalProperties keyword, which can either be a boolean or a schema. When
+// Schema is set, the additional properties must validate against it, otherwise Allowed tells whether they're allowed
+// at all.
+type AdditionalProperties struct {
+	Allowed bool
+	Schema  *Schema
 }
 
 func FromAny(data any) (*Schema, error) {
@@ -132,70 +154,83 @@ func (s *Schema) GetSession(sessionID string) (*Schema, error) {
 	return &clonedSchema, nil
 }
 
-// Resolve resolves all the references in the schema.
-func (s *Schema) Resolve(schemas map[string]Schema) error {
-	return s.resolve(s, schemas, make(map[string]bool))
+// Walk visits the schema and all its sub-schemas (properties, items, applicators, $defs, definitions) depth-first,
+// calling fn with each node and its path. Paths use the dot notation, starting from the given root path. If fn returns
+// false, the sub-schemas of that node are not visited.
+func (s *Schema) Walk(path string, fn func(path string, node *Schema) bool) {
+	if s == nil || !fn(path, s) {
+		return
+	}
+	keys := make([]string, 0, len(s.Properties))
+	for k := range s.Properties {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	for _, k := range keys {
+		s.Properties[k].Walk(joinPath(path, "properties."+k), fn)
+	}
+	s.Items.Walk(joinPath(path, "items"), fn)
+	for i, sub := range s.AnyOf {
+		sub.Walk(fmt.Sprintf("%s[%d]", joinPath(path, "anyOf"), i), fn)
+	}
+	for i, sub := range s.OneOf {
+		sub.Walk(fmt.Sprintf("%s[%d]", joinPath(path, "oneOf"), i), fn)
+	}
+	for i, sub := range s.AllOf {
+		sub.Walk(fmt.Sprintf("%s[%d]", joinPath(path, "allOf"), i), fn)
+	}
+	s.Not.Walk(joinPath(path, "not"), fn)
+	s.If.Walk(joinPath(path, "if"), fn)
+	s.Then.Walk(joinPath(path, "then"), fn)
+	s.Else.Walk(joinPath(path, "else"), fn)
+	if s.AdditionalProperties != nil {
+		s.AdditionalProperties.Schema.Walk(joinPath(path, "additionalProperties"), fn)
+	}
+	for _, k := range sortedKeys(s.PatternProperties) {
+		s.PatternProperties[k].Walk(joinPath(path, "patternProperties."+k), fn)
+	}
+	for i, sub := range s.PrefixItems {
+		sub.Walk(fmt.Sprintf("%s[%d]", joinPath(path, "prefixItems"), i), fn)
+	}
+	for _, k := range sortedKeys(s.Defs) {
+		s.Defs[k].Walk(joinPath(path, "$defs."+k), fn)
+	}
+	for _, k := range sortedKeys(s.Definitions) {
+		s.Definitions[k].Walk(joinPath(path, "definitions."+k), fn)
+	}
 }
 
-// resolve resolves all the references in the schema (recursive function)
-func (s *Schema) resolve(schema *Schema, schemas map[string]Schema, visited map[string]bool) error {
-	if schema == nil {
-		return nil
-	}
-	if schema.Ref != nil {
-		ref := *schema.Ref
-		if visited[ref] {
-			return nil
-		}
-		if strings.HasPrefix(ref, "#/components/schemas/") {
-			visited[ref] = true
-			defer func() { delete(visited, ref) }()
-			schemaName := strings.TrimPrefix(ref, "#/components/schemas/")
-			if resolvedSchema, ok := schemas[schemaName]; ok {
-				originalXSession := schema.XSession
-
-				*schema = resolvedSchema
-
-				schema.XSession = originalXSession
-				schema.Ref = nil
-
-				if err := s.resolve(schema, schemas, visited); err != nil {
-					return err
-				}
-			} else {
-				return fmt.Errorf("schema not found: %s", ref)
-			}
-		}
+// subSchemas returns the direct sub-schemas of the schema, excluding $defs and definitions
+func (s *Schema) subSchemas() []*Schema {
+	subs := make([]*Schema, 0)
+	for _, k := range sortedKeys(s.Properties) {
+		subs = append(subs, s.Properties[k])
 	}
-
-	if schema.Properties != nil {
-		for _, propSchema := range schema.Properties {
-			if err := s.resolve(propSchema, schemas, visited); err != nil {
-				return err
-			}
-		}
+	for _, k := range sortedKeys(s.PatternProperties) {
+		subs = append(subs, s.PatternProperties[k])
 	}
-
-	if schema.Items != nil {
-		if err := s.resolve(schema.Items, schemas, visited); err != nil {
-			return err
-		}
+	if s.AdditionalProperties != nil && s.AdditionalProperties.Schema != nil {
+		subs = append(subs, s.AdditionalProperties.Schema)
 	}
-
-	if schema.AnyOf != nil {
-		for _, anyOfSchema := range schema.AnyOf {
-			if err := s.resolve(anyOfSchema, schemas, visited); err != nil {
-				return err
-			}
-		}
+	if s.Items != nil {
+		subs = append(subs, s.Items)
 	}
-	if schema.OneOf != nil {
-		for _, anyOfSchema := range schema.OneOf {
-			if err := s.resolve(anyOfSchema, schemas, visited); err != nil {
-				return err
-			}
+	subs = append(subs, s.PrefixItems...)
+	subs = append(subs, s.AnyOf...)
+	subs = append(subs, s.OneOf...)
+	subs = append(subs, s.AllOf...)
+	for _, sub := range []*Schema{s.Not, s.If, s.Then, s.Else} {
+		if sub != nil {
+			subs = append(subs, sub)
 		}
 	}
+	return subs
+}
 
-	return nil
+// joinPath joins two segments of a dot notation path
+func joinPath(base string, segment string) string {
+	if base == "" {
+		return segment
+	}
+	return base + "." + segment
 }
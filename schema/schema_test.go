@@ -334,4 +334,66 @@ func TestSchema_CopyTo(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "object", dst.Type)
 	assert.Equal(t, []string{"a", "b", "c"}, dst.Enum)
+
+	type StrictDestination struct {
+		Type             string
+		AllOf            []*StrictDestination
+		Const            any
+		MultipleOf       *float64
+		ExclusiveMinimum *float64
+		UniqueItems      *bool
+	}
+	s = &Schema{
+		Type:             Type("number"),
+		AllOf:            []*Schema{{Type: Type("integer")}},
+		Const:            4,
+		MultipleOf:       util.Ptr(2.0),
+		ExclusiveMinimum: util.Ptr(0.0),
+		UniqueItems:      util.Ptr(true),
+	}
+	strict := &StrictDestination{}
+	assert.NoError(t, s.CopyTo(strict))
+	assert.Equal(t, "integer", strict.AllOf[0].Type)
+	assert.Equal(t, 4, strict.Const)
+	assert.Equal(t, 2.0, *strict.MultipleOf)
+	assert.Equal(t, 0.0, *strict.ExclusiveMinimum)
+	assert.True(t, *strict.UniqueItems)
+}
+
+func TestSchema_Walk(t *testing.T) {
+	s := Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"p1": {Type: Array, Items: &Schema{Ref: util.Ptr("#/components/schemas/Foo")}},
+			"p2": {AnyOf: []*Schema{{Type: String}, {Type: Integer}}},
+		},
+	}
+	paths := make([]string, 0)
+	s.Walk("schema", func(path string, node *Schema) bool {
+		paths = append(paths, path)
+		return true
+	})
+	assert.Equal(t, []string{"schema", "schema.properties.p1", "schema.properties.p1.items",
+		"schema.properties.p2", "schema.properties.p2.anyOf[0]", "schema.properties.p2.anyOf[1]"}, paths)
+
+	paths = make([]string, 0)
+	s.Walk("", func(path string, node *Schema) bool {
+		paths = append(paths, path)
+		return path == ""
+	})
+	assert.Equal(t, []string{"", "properties.p1", "properties.p2"}, paths)
+
+	s = Schema{
+		AllOf:                []*Schema{{Type: String}},
+		Not:                  &Schema{Type: Integer},
+		AdditionalProperties: &AdditionalProperties{Schema: &Schema{Type: Boolean}},
+		PrefixItems:          []*Schema{{Type: Number}},
+	}
+	paths = make([]string, 0)
+	s.Walk("schema", func(path string, node *Schema) bool {
+		paths = append(paths, path)
+		return true
+	})
+	assert.Equal(t, []string{"schema", "schema.allOf[0]", "schema.not", "schema.additionalProperties",
+		"schema.prefixItems[0]"}, paths)
 }
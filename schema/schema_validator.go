@@ -18,17 +18,28 @@
 package schema
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"reflect"
 	"regexp"
+	"slices"
 	"strings"
 
 	"github.com/theirish81/frags/util"
 )
 
+// ValidationError describes a violation of the schema. Path is the location of the violation in dot notation, while
+// Pointer is the same location as a JSON Pointer. Keyword is the schema keyword that failed, with the value the schema
+// expects and the actual one.
 type ValidationError struct {
-	Path    string
-	Message string
+	Path     string `json:"path"`
+	Pointer  string `json:"pointer"`
+	Keyword  string `json:"keyword,omitempty"`
+	Expected any    `json:"expected,omitempty"`
+	Actual   any    `json:"actual,omitempty"`
+	Message  string `json:"message"`
 }
 
 type ValidatorOptions struct {
@@ -42,61 +53,158 @@ func (e *ValidationError) Error() string {
 	return e.Message
 }
 
-// Validate validates the given data against the schema
+// ValidationErrors is the list of the violations found by ValidateAll. Error renders them for humans, while the JSON
+// encoding is meant for machines.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, err := range e {
+		messages = append(messages, err.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Validate validates the given data against the schema, returning the first violation. With soft validation,
+// strings with a format are normalized where possible (i.e. dates), and the normalized values replace the originals
+// in the maps and slices of the data.
 func (s *Schema) Validate(data any, options *ValidatorOptions) error {
-	softValidation := options != nil && options.SoftValidation
-	return s.validate(data, "", softValidation)
+	if errs := s.ValidateAll(data, options); len(errs) > 0 {
+		return errs[0]
+	}
+	return nil
+}
+
+// ValidateAll validates the given data against the schema, like Validate, but returns all the violations. It returns
+// nil if the data is valid.
+func (s *Schema) ValidateAll(data any, options *ValidatorOptions) ValidationErrors {
+	vd := &validator{soft: options != nil && options.SoftValidation}
+	s.validate(data, location{}, vd)
+	if len(vd.errors) == 0 {
+		return nil
+	}
+	return vd.errors
 }
 
-func (s *Schema) validate(data any, path string, softValidation bool) error {
+// validator collects the violations of a validation
+type validator struct {
+	soft   bool
+	errors ValidationErrors
+}
+
+// fail records a violation
+func (vd *validator) fail(loc location, keyword string, expected any, actual any, message string) {
+	vd.errors = append(vd.errors, &ValidationError{Path: loc.path, Pointer: loc.pointer, Keyword: keyword,
+		Expected: expected, Actual: actual, Message: message})
+}
+
+// matches returns true if the data is valid against the schema. Violations are not recorded, as it's used to try
+// alternatives (anyOf, not, if)
+func (vd *validator) matches(s *Schema, data any, loc location) (any, bool) {
+	sub := &validator{soft: vd.soft}
+	coerced := s.validate(data, loc, sub)
+	return coerced, len(sub.errors) == 0
+}
+
+// location is where a value is in the validated data, both in dot notation and as a JSON pointer
+type location struct {
+	path    string
+	pointer string
+}
+
+func (l location) property(key string) location {
+	path := key
+	if l.path != "" {
+		path = l.path + "." + key
+	}
+	return location{path: path, pointer: l.pointer + "/" + escapePointerToken(key)}
+}
+
+func (l location) index(i int) location {
+	return location{path: fmt.Sprintf("%s[%d]", l.path, i), pointer: fmt.Sprintf("%s/%d", l.pointer, i)}
+}
+
+// validate validates the data against the schema. If the value has been coerced, it returns the coerced value,
+// otherwise nil.
+func (s *Schema) validate(data any, loc location, vd *validator) any {
 	if data == nil {
-		if s.Nullable != nil && *s.Nullable {
-			return nil
+		if s.Nullable == nil || !*s.Nullable {
+			vd.fail(loc, "nullable", s.Type, nil, "value is null but schema is not nullable")
 		}
-		return &ValidationError{Path: path, Message: "value is null but schema is not nullable"}
+		return nil
 	}
 
+	s.validateApplicators(data, loc, vd)
+
 	if len(s.AnyOf) > 0 {
 		for _, subSchema := range s.AnyOf {
-			if err := subSchema.validate(data, path, softValidation); err == nil {
-				return nil
+			if coerced, ok := vd.matches(subSchema, data, loc); ok {
+				return coerced
 			}
 		}
-		return &ValidationError{Path: path, Message: "value does not match any of the schemas in anyOf"}
+		vd.fail(loc, "anyOf", nil, data, "value does not match any of the schemas in anyOf")
+		return nil
 	}
 
 	v := reflect.ValueOf(data)
 
 	for v.Kind() == reflect.Ptr {
 		if v.IsNil() {
-			if s.Nullable != nil && *s.Nullable {
-				return nil
+			if s.Nullable == nil || !*s.Nullable {
+				vd.fail(loc, "nullable", s.Type, nil, "value is nil")
 			}
-			return &ValidationError{Path: path, Message: "value is nil"}
+			return nil
 		}
 		v = v.Elem()
 	}
 
 	switch s.Type {
 	case "object":
-		return s.validateObject(v, path, softValidation)
+		s.validateObject(v, loc, vd)
 	case "array":
-		return s.validateArray(v, path, softValidation)
+		s.validateArray(v, loc, vd)
 	case "string":
-		return s.validateString(v, path)
+		return s.validateString(v, loc, vd)
 	case "number", "integer":
-		return s.validateNumber(v, path, softValidation)
+		s.validateNumber(v, loc, vd)
 	case "boolean":
-		return s.validateBoolean(v, path, softValidation)
+		s.validateBoolean(v, loc, vd)
 	case "":
-		return s.validateByInference(v, path, softValidation)
+		return s.validateByInference(v, loc, vd)
 	default:
-		return &ValidationError{Path: path, Message: fmt.Sprintf("unsupported type: %s", s.Type)}
+		vd.fail(loc, "type", s.Type, nil, fmt.Sprintf("unsupported type: %s", s.Type))
+	}
+	return nil
+}
+
+// validateApplicators validates the data against the keywords that don't depend on the type: const, allOf, not and
+// if/then/else
+func (s *Schema) validateApplicators(data any, loc location, vd *validator) {
+	if s.Const != nil && !valuesEqual(data, s.Const) {
+		vd.fail(loc, "const", s.Const, data, fmt.Sprintf("value must be %v", s.Const))
+	}
+	for _, subSchema := range s.AllOf {
+		subSchema.validate(data, loc, vd)
+	}
+	if s.Not != nil {
+		if _, ok := vd.matches(s.Not, data, loc); ok {
+			vd.fail(loc, "not", nil, data, "value must not match the schema in not")
+		}
+	}
+	if s.If != nil {
+		if _, ok := vd.matches(s.If, data, loc); ok {
+			if s.Then != nil {
+				s.Then.validate(data, loc, vd)
+			}
+		} else if s.Else != nil {
+			s.Else.validate(data, loc, vd)
+		}
 	}
 }
 
-func (s *Schema) validateObject(v reflect.Value, path string, softValidation bool) error {
+func (s *Schema) validateObject(v reflect.Value, loc location, vd *validator) {
 	var m map[string]interface{}
+	keys := make(map[string]reflect.Value)
 
 	switch v.Kind() {
 	case reflect.Map:
@@ -104,91 +212,143 @@ func (s *Schema) validateObject(v reflect.Value, path string, softValidation boo
 		for _, key := range v.MapKeys() {
 			keyStr := fmt.Sprintf("%v", key.Interface())
 			m[keyStr] = v.MapIndex(key).Interface()
+			keys[keyStr] = key
 		}
 	case reflect.Struct:
 		m = structToMap(v)
 	default:
-		return &ValidationError{Path: path, Message: fmt.Sprintf("expected object, got %s", v.Kind())}
+		vd.fail(loc, "type", Object, v.Kind().String(), fmt.Sprintf("expected object, got %s", v.Kind()))
+		return
 	}
 
 	if s.MinProperties != nil && int64(len(m)) < *s.MinProperties {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("object has %d properties, minimum is %d", len(m), *s.MinProperties)}
+		vd.fail(loc, "minProperties", *s.MinProperties, len(m), fmt.Sprintf("object has %d properties, minimum is %d", len(m), *s.MinProperties))
 	}
 	if s.MaxProperties != nil && int64(len(m)) > *s.MaxProperties {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("object has %d properties, maximum is %d", len(m), *s.MaxProperties)}
+		vd.fail(loc, "maxProperties", *s.MaxProperties, len(m), fmt.Sprintf("object has %d properties, maximum is %d", len(m), *s.MaxProperties))
 	}
 
 	for _, req := range s.Required {
 		if _, exists := m[req]; !exists {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("missing required property: %s", req)}
+			vd.fail(loc, "required", req, nil, fmt.Sprintf("missing required property: %s", req))
 		}
 	}
 
-	for key, value := range m {
-		propPath := path
-		if propPath == "" {
-			propPath = key
-		} else {
-			propPath = propPath + "." + key
+	names := make([]string, 0, len(m))
+	for key := range m {
+		names = append(names, key)
+	}
+	slices.Sort(names)
+	for _, key := range names {
+		value := m[key]
+		propLoc := loc.property(key)
+
+		propSchema, exists := s.Properties[key]
+		if exists {
+			coerced := propSchema.validate(value, propLoc, vd)
+			if coerced != nil && v.Kind() == reflect.Map {
+				if cv := reflect.ValueOf(coerced); cv.Type().AssignableTo(v.Type().Elem()) {
+					v.SetMapIndex(keys[key], cv)
+				}
+			}
 		}
-
-		if propSchema, exists := s.Properties[key]; exists {
-			if err := propSchema.validate(value, propPath, softValidation); err != nil {
-				return err
+		for pattern, patternSchema := range s.PatternProperties {
+			matched, err := regexp.MatchString(pattern, key)
+			if err != nil {
+				vd.fail(propLoc, "patternProperties", pattern, key, fmt.Sprintf("invalid pattern: %v", err))
+				continue
+			}
+			if matched {
+				exists = true
+				patternSchema.validate(value, propLoc, vd)
+			}
+		}
+		if !exists && s.AdditionalProperties != nil {
+			if s.AdditionalProperties.Schema != nil {
+				s.AdditionalProperties.Schema.validate(value, propLoc, vd)
+			} else if !s.AdditionalProperties.Allowed {
+				vd.fail(propLoc, "additionalProperties", false, key, fmt.Sprintf("additional property %s is not allowed", key))
 			}
 		}
 	}
-
-	return nil
 }
 
-func (s *Schema) validateArray(v reflect.Value, path string, softValidation bool) error {
+func (s *Schema) validateArray(v reflect.Value, loc location, vd *validator) {
 	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("expected array, got %s", v.Kind())}
+		vd.fail(loc, "type", Array, v.Kind().String(), fmt.Sprintf("expected array, got %s", v.Kind()))
+		return
 	}
 
 	length := int64(v.Len())
 
 	if s.MinItems != nil && length < *s.MinItems {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("array has %d items, minimum is %d", length, *s.MinItems)}
+		vd.fail(loc, "minItems", *s.MinItems, length, fmt.Sprintf("array has %d items, minimum is %d", length, *s.MinItems))
 	}
 	if s.MaxItems != nil && length > *s.MaxItems {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("array has %d items, maximum is %d", length, *s.MaxItems)}
+		vd.fail(loc, "maxItems", *s.MaxItems, length, fmt.Sprintf("array has %d items, maximum is %d", length, *s.MaxItems))
 	}
 
-	if s.Items != nil {
-		for i := 0; i < v.Len(); i++ {
-			itemPath := fmt.Sprintf("%s[%d]", path, i)
-			if err := s.Items.validate(v.Index(i).Interface(), itemPath, softValidation); err != nil {
-				return err
+	for i := 0; i < v.Len(); i++ {
+		// items only applies to the items that come after the prefixItems
+		itemSchema := s.Items
+		if i < len(s.PrefixItems) {
+			itemSchema = s.PrefixItems[i]
+		}
+		if itemSchema == nil {
+			continue
+		}
+		coerced := itemSchema.validate(v.Index(i).Interface(), loc.index(i), vd)
+		if item := v.Index(i); coerced != nil && item.CanSet() {
+			if cv := reflect.ValueOf(coerced); cv.Type().AssignableTo(item.Type()) {
+				item.Set(cv)
 			}
 		}
 	}
 
-	return nil
+	if s.UniqueItems != nil && *s.UniqueItems {
+		for i := 0; i < v.Len(); i++ {
+			for j := i + 1; j < v.Len(); j++ {
+				if valuesEqual(v.Index(i).Interface(), v.Index(j).Interface()) {
+					vd.fail(loc.index(j), "uniqueItems", true, v.Index(j).Interface(), fmt.Sprintf("array items %d and %d are equal, items must be unique", i, j))
+				}
+			}
+		}
+	}
 }
 
-func (s *Schema) validateString(v reflect.Value, path string) error {
+// validateString validates a string. If the string has been coerced to its format, it returns the coerced value,
+// otherwise nil.
+func (s *Schema) validateString(v reflect.Value, loc location, vd *validator) any {
 	if v.Kind() != reflect.String {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("expected string, got %s", v.Kind())}
+		vd.fail(loc, "type", String, v.Kind().String(), fmt.Sprintf("expected string, got %s", v.Kind()))
+		return nil
 	}
 
 	str := v.String()
+	var coerced any
+	if validator, ok := getFormat(s.Format); ok {
+		formatted, err := validator(str, vd.soft)
+		if err != nil {
+			vd.fail(loc, "format", s.Format, str, fmt.Sprintf("string is not a valid %s: %s", s.Format, err.Error()))
+		} else if formatted != str {
+			str = formatted
+			coerced = formatted
+		}
+	}
 
 	if s.MinLength != nil && int64(len(str)) < *s.MinLength {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("string length is %d, minimum is %d", len(str), *s.MinLength)}
+		vd.fail(loc, "minLength", *s.MinLength, len(str), fmt.Sprintf("string length is %d, minimum is %d", len(str), *s.MinLength))
 	}
 	if s.MaxLength != nil && int64(len(str)) > *s.MaxLength {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("string length is %d, maximum is %d", len(str), *s.MaxLength)}
+		vd.fail(loc, "maxLength", *s.MaxLength, len(str), fmt.Sprintf("string length is %d, maximum is %d", len(str), *s.MaxLength))
 	}
 
 	if s.Pattern != "" {
 		matched, err := regexp.MatchString(s.Pattern, str)
 		if err != nil {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("invalid pattern: %v", err)}
-		}
-		if !matched {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("string does not match pattern: %s", s.Pattern)}
+			vd.fail(loc, "pattern", s.Pattern, str, fmt.Sprintf("invalid pattern: %v", err))
+		} else if !matched {
+			vd.fail(loc, "pattern", s.Pattern, str, fmt.Sprintf("string does not match pattern: %s", s.Pattern))
 		}
 	}
 
@@ -201,22 +361,23 @@ func (s *Schema) validateString(v reflect.Value, path string) error {
 			}
 		}
 		if !found {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("value must be one of: %v", s.Enum)}
+			vd.fail(loc, "enum", s.Enum, str, fmt.Sprintf("value must be one of: %v", s.Enum))
 		}
 	}
 
-	return nil
+	return coerced
 }
 
-func (s *Schema) validateNumber(v reflect.Value, path string, softValidation bool) error {
+func (s *Schema) validateNumber(v reflect.Value, loc location, vd *validator) {
 	var num float64
 	kind := v.Kind()
-	if kind == reflect.String && softValidation {
+	if kind == reflect.String && vd.soft {
 		if num, err := util.StringValToFloat64(v); err == nil {
-			return s.validateNumber(reflect.ValueOf(num), path, softValidation)
+			s.validateNumber(reflect.ValueOf(num), loc, vd)
 		} else {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("expected number, got %s", v.Kind())}
+			vd.fail(loc, "type", s.Type, v.String(), fmt.Sprintf("expected number, got %s", v.Kind()))
 		}
+		return
 	}
 	switch kind {
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
@@ -226,54 +387,67 @@ func (s *Schema) validateNumber(v reflect.Value, path string, softValidation boo
 	case reflect.Float32, reflect.Float64:
 		num = v.Float()
 	default:
-		return &ValidationError{Path: path, Message: fmt.Sprintf("expected number, got %s", v.Kind())}
+		vd.fail(loc, "type", s.Type, v.Kind().String(), fmt.Sprintf("expected number, got %s", v.Kind()))
+		return
 	}
 
 	if s.Type == "integer" && num != float64(int64(num)) {
-		return &ValidationError{Path: path, Message: "expected integer, got float"}
+		vd.fail(loc, "type", Integer, num, "expected integer, got float")
+		return
 	}
 
 	if s.Minimum != nil && num < *s.Minimum {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("value %v is less than minimum %v", num, *s.Minimum)}
+		vd.fail(loc, "minimum", *s.Minimum, num, fmt.Sprintf("value %v is less than minimum %v", num, *s.Minimum))
 	}
 	if s.Maximum != nil && num > *s.Maximum {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("value %v is greater than maximum %v", num, *s.Maximum)}
+		vd.fail(loc, "maximum", *s.Maximum, num, fmt.Sprintf("value %v is greater than maximum %v", num, *s.Maximum))
+	}
+	if s.ExclusiveMinimum != nil && num <= *s.ExclusiveMinimum {
+		vd.fail(loc, "exclusiveMinimum", *s.ExclusiveMinimum, num, fmt.Sprintf("value %v must be greater than %v", num, *s.ExclusiveMinimum))
+	}
+	if s.ExclusiveMaximum != nil && num >= *s.ExclusiveMaximum {
+		vd.fail(loc, "exclusiveMaximum", *s.ExclusiveMaximum, num, fmt.Sprintf("value %v must be less than %v", num, *s.ExclusiveMaximum))
+	}
+	if s.MultipleOf != nil && *s.MultipleOf > 0 {
+		quotient := num / *s.MultipleOf
+		if math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+			vd.fail(loc, "multipleOf", *s.MultipleOf, num, fmt.Sprintf("value %v is not a multiple of %v", num, *s.MultipleOf))
+		}
 	}
-
-	return nil
 }
 
-func (s *Schema) validateBoolean(v reflect.Value, path string, softValidation bool) error {
-	if v.Kind() == reflect.String && softValidation {
+func (s *Schema) validateBoolean(v reflect.Value, loc location, vd *validator) {
+	if v.Kind() == reflect.String && vd.soft {
 		if b, err := util.StringValToToBool(v); err == nil {
-			return s.validateBoolean(reflect.ValueOf(b), path, softValidation)
+			s.validateBoolean(reflect.ValueOf(b), loc, vd)
 		} else {
-			return &ValidationError{Path: path, Message: fmt.Sprintf("expected boolean, got %s", v.Kind())}
+			vd.fail(loc, "type", Boolean, v.String(), fmt.Sprintf("expected boolean, got %s", v.Kind()))
 		}
+		return
 	}
 	if v.Kind() != reflect.Bool {
-		return &ValidationError{Path: path, Message: fmt.Sprintf("expected boolean, got %s", v.Kind())}
+		vd.fail(loc, "type", Boolean, v.Kind().String(), fmt.Sprintf("expected boolean, got %s", v.Kind()))
 	}
-	return nil
 }
 
-func (s *Schema) validateByInference(v reflect.Value, path string, softValidation bool) error {
+func (s *Schema) validateByInference(v reflect.Value, loc location, vd *validator) any {
 	switch v.Kind() {
 	case reflect.Map, reflect.Struct:
-		return s.validateObject(v, path, softValidation)
+		s.validateObject(v, loc, vd)
 	case reflect.Slice, reflect.Array:
-		return s.validateArray(v, path, softValidation)
+		s.validateArray(v, loc, vd)
 	case reflect.String:
-		return s.validateString(v, path)
+		return s.validateString(v, loc, vd)
 	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
 		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
 		reflect.Float32, reflect.Float64:
-		return s.validateNumber(v, path, softValidation)
+		s.validateNumber(v, loc, vd)
 	case reflect.Bool:
-		return s.validateBoolean(v, path, softValidation)
+		s.validateBoolean(v, loc, vd)
 	default:
-		return &ValidationError{Path: path, Message: fmt.Sprintf("unsupported kind: %s", v.Kind())}
+		vd.fail(loc, "type", nil, v.Kind().String(), fmt.Sprintf("unsupported kind: %s", v.Kind()))
 	}
+	return nil
 }
 
 func structToMap(v reflect.Value) map[string]interface{} {
@@ -301,3 +475,17 @@ func structToMap(v reflect.Value) map[string]interface{} {
 
 	return m
 }
+
+// valuesEqual compares two values by their JSON representation, so that the same value decoded in different ways
+// (i.e. an int from YAML and a float64 from JSON, or a struct and a map) is considered equal
+func valuesEqual(a any, b any) bool {
+	aBytes, err := json.Marshal(a)
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	bBytes, err := json.Marshal(b)
+	if err != nil {
+		return reflect.DeepEqual(a, b)
+	}
+	return bytes.Equal(aBytes, bBytes)
+}
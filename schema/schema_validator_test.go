@@ -18,9 +18,11 @@
 package schema
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/util"
 )
 
 type s2 struct {
@@ -153,6 +155,80 @@ func TestSchema_Validate(t *testing.T) {
 		err := s.Validate(struct1, nil)
 		assert.NoError(t, err)
 	})
+	t.Run("const", func(t *testing.T) {
+		s := Schema{Const: 3}
+		assert.NoError(t, s.Validate(3.0, nil))
+		assert.Error(t, s.Validate(4, nil))
+		s = Schema{Type: Object, Const: map[string]any{"a": 1}}
+		assert.NoError(t, s.Validate(map[string]any{"a": 1.0}, nil))
+		assert.Error(t, s.Validate(map[string]any{"a": 2}, nil))
+	})
+	t.Run("allOf and not", func(t *testing.T) {
+		s := Schema{
+			Type:  String,
+			AllOf: []*Schema{{MinLength: util.Ptr(int64(2))}, {MaxLength: util.Ptr(int64(4))}},
+			Not:   &Schema{Enum: []any{"nope"}},
+		}
+		assert.NoError(t, s.Validate("foo", nil))
+		assert.Error(t, s.Validate("f", nil))
+		assert.Error(t, s.Validate("foobar", nil))
+		assert.ErrorContains(t, s.Validate("nope", nil), "must not match")
+	})
+	t.Run("if then else", func(t *testing.T) {
+		s := Schema{
+			Type: Object,
+			If: &Schema{
+				Properties: map[string]*Schema{"country": {Const: "US"}},
+				Required:   []string{"country"},
+			},
+			Then: &Schema{Properties: map[string]*Schema{"zip": {Pattern: "^[0-9]{5}$"}}},
+			Else: &Schema{Properties: map[string]*Schema{"zip": {Pattern: "^[A-Z0-9 ]+$"}}},
+		}
+		assert.NoError(t, s.Validate(map[string]any{"country": "US", "zip": "12345"}, nil))
+		assert.Error(t, s.Validate(map[string]any{"country": "US", "zip": "AB1 2CD"}, nil))
+		assert.NoError(t, s.Validate(map[string]any{"country": "UK", "zip": "AB1 2CD"}, nil))
+		assert.Error(t, s.Validate(map[string]any{"country": "UK", "zip": "ab"}, nil))
+	})
+	t.Run("additional and pattern properties", func(t *testing.T) {
+		s := Schema{
+			Type:                 Object,
+			Properties:           map[string]*Schema{"name": {Type: String}},
+			PatternProperties:    map[string]*Schema{"^x-": {Type: Integer}},
+			AdditionalProperties: &AdditionalProperties{Allowed: false},
+		}
+		assert.NoError(t, s.Validate(map[string]any{"name": "foo", "x-count": 3}, nil))
+		assert.Error(t, s.Validate(map[string]any{"name": "foo", "x-count": "3"}, nil))
+		assert.ErrorContains(t, s.Validate(map[string]any{"name": "foo", "age": 3}, nil),
+			"additional property age is not allowed")
+
+		s.AdditionalProperties = &AdditionalProperties{Schema: &Schema{Type: Boolean}}
+		assert.NoError(t, s.Validate(map[string]any{"name": "foo", "active": true}, nil))
+		assert.Error(t, s.Validate(map[string]any{"name": "foo", "active": "yes"}, nil))
+	})
+	t.Run("array keywords", func(t *testing.T) {
+		s := Schema{
+			Type:        Array,
+			PrefixItems: []*Schema{{Type: String}, {Type: Integer}},
+			Items:       &Schema{Type: Boolean},
+			UniqueItems: util.Ptr(true),
+		}
+		assert.NoError(t, s.Validate([]any{"foo", 1, true, false}, nil))
+		assert.Error(t, s.Validate([]any{1, "foo"}, nil))
+		assert.Error(t, s.Validate([]any{"foo", 1, "bar"}, nil))
+		assert.ErrorContains(t, s.Validate([]any{"foo", 1, true, true}, nil), "items must be unique")
+	})
+	t.Run("number keywords", func(t *testing.T) {
+		s := Schema{
+			Type:             Number,
+			MultipleOf:       util.Ptr(0.5),
+			ExclusiveMinimum: util.Ptr(0.0),
+			ExclusiveMaximum: util.Ptr(10.0),
+		}
+		assert.NoError(t, s.Validate(2.5, nil))
+		assert.ErrorContains(t, s.Validate(2.3, nil), "not a multiple of")
+		assert.Error(t, s.Validate(0, nil))
+		assert.Error(t, s.Validate(10, nil))
+	})
 }
 
 func TestSchema_Validate_Soft(t *testing.T) {
@@ -208,3 +284,51 @@ func TestSchema_Validate_Soft(t *testing.T) {
 	})
 
 }
+
+func TestSchema_ValidateAll(t *testing.T) {
+	s := Schema{
+		Type: Object,
+		Properties: map[string]*Schema{
+			"name": {Type: String, MinLength: util.Ptr(int64(3)), Pattern: "^[a-z]+$"},
+			"a/b":  {Type: Integer},
+			"items": {Type: Array, Items: &Schema{
+				Type:       Object,
+				Properties: map[string]*Schema{"qty": {Type: Number, Minimum: util.Ptr(1.0)}},
+			}},
+		},
+		Required: []string{"id"},
+	}
+	assert.Nil(t, s.ValidateAll(map[string]any{"id": 1, "name": "abc"}, nil))
+
+	errs := s.ValidateAll(map[string]any{
+		"name":  "A",
+		"a/b":   "x",
+		"items": []any{map[string]any{"qty": 2}, map[string]any{"qty": 0}},
+	}, nil)
+	assert.Equal(t, ValidationErrors{
+		{Pointer: "", Keyword: "required", Expected: "id", Message: "missing required property: id"},
+		{Path: "a/b", Pointer: "/a~1b", Keyword: "type", Expected: Type(Integer), Actual: "string",
+			Message: "expected number, got string"},
+		{Path: "items[1].qty", Pointer: "/items/1/qty", Keyword: "minimum", Expected: 1.0, Actual: 0.0,
+			Message: "value 0 is less than minimum 1"},
+		{Path: "name", Pointer: "/name", Keyword: "minLength", Expected: int64(3), Actual: 1,
+			Message: "string length is 1, minimum is 3"},
+		{Path: "name", Pointer: "/name", Keyword: "pattern", Expected: "^[a-z]+$", Actual: "A",
+			Message: "string does not match pattern: ^[a-z]+$"},
+	}, errs)
+	assert.Equal(t, "missing required property: id; a/b: expected number, got string; "+
+		"items[1].qty: value 0 is less than minimum 1; name: string length is 1, minimum is 3; "+
+		"name: string does not match pattern: ^[a-z]+$", errs.Error())
+
+	data, err := json.Marshal(errs[2])
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"path":"items[1].qty","pointer":"/items/1/qty","keyword":"minimum","expected":1,"actual":0,
+		"message":"value 0 is less than minimum 1"}`, string(data))
+
+	// Validate still returns the first violation
+	assert.Equal(t, errs[0], s.Validate(map[string]any{
+		"name":  "A",
+		"a/b":   "x",
+		"items": []any{map[string]any{"qty": 2}, map[string]any{"qty": 0}},
+	}, nil))
+}
@@ -36,6 +36,8 @@ import (
 // PreCalls defines a list of functions to call before the main interaction.
 // PrePrompt is the prompt that will be called before the main interaction. This is mainly for context enrichment
 // Prompt defines the main interaction.
+// PostCalls defines a list of functions to call once the main interaction produced its output, which is available
+// to them as `output`.
 // Resources configure resource loaders to load files for the session.
 // Timeout defines the maximum time the session can run for.
 // DependsOn defines a list of sessions that must be completed before this session can start, and expressions defining
@@ -45,19 +47,34 @@ import (
 // ToolDefinitions defines the tools that can be used in this session.
 // IterateOn describes a variable (typically a list) over which we will iterate the session. The session will run
 // len(IterateOn) times. Use an github.com/expr-lang/expr expression.
+// Concurrency defines how many iterations of an IterateOn session can run at the same time. Defaults to 1 (sequential).
+// Regardless of the order they complete in, the outputs of the iterations are merged in the IterateOn order.
 // Vars defines variables that are local to the session.
+// OnError defines what happens to the run if the session fails (fail, continue or fallback). Defaults to fail.
+// Fallback defines the default output of the session, when OnError is fallback.
+// SubPlan makes the session run another plan, instead of prompting the AI.
+// Loop makes the session repeat its prompt, in the same conversation, until a condition over its output is met.
+// RepairRounds overrides the number of times the AI is asked to fix an output that doesn't match the schema.
 type Session struct {
-	PreCalls  FunctionCallers `json:"preCalls,omitempty" yaml:"preCalls" validate:"omitempty,dive"`
-	PrePrompt PrePrompt       `json:"prePrompt,omitempty" yaml:"prePrompt,omitempty"`
-	Prompt    string          `json:"prompt,omitempty" yaml:"prompt,omitempty" validate:"omitempty,min=3"`
-	Resources []Resource      `json:"resources,omitempty" yaml:"resources,omitempty" validate:"dive"`
-	Timeout   *string         `json:"timeout,omitempty" yaml:"timeout,omitempty"`
-	DependsOn Dependencies    `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
-	Context   *ContextConfig  `json:"context" yaml:"context"`
-	Attempts  int             `json:"attempts,omitempty" yaml:"attempts,omitempty"`
-	Tools     ToolDefinitions `json:"tools,omitempty" yaml:"tools,omitempty"`
-	IterateOn *string         `json:"iterateOn,omitempty" yaml:"iterateOn,omitempty"`
-	Vars      map[string]any  `json:"vars,omitempty" yaml:"vars,omitempty"`
+	PreCalls     FunctionCallers `json:"preCalls,omitempty" yaml:"preCalls" validate:"omitempty,dive"`
+	PrePrompt    PrePrompt       `json:"prePrompt,omitempty" yaml:"prePrompt,omitempty"`
+	Prompt       string          `json:"prompt,omitempty" yaml:"prompt,omitempty" validate:"omitempty,min=3"`
+	PostCalls    FunctionCallers `json:"postCalls,omitempty" yaml:"postCalls,omitempty" validate:"omitempty,dive"`
+	Resources    []Resource      `json:"resources,omitempty" yaml:"resources,omitempty" validate:"dive"`
+	Timeout      *string         `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	DependsOn    Dependencies    `json:"dependsOn,omitempty" yaml:"dependsOn,omitempty"`
+	Context      *ContextConfig  `json:"context" yaml:"context"`
+	Attempts     int             `json:"attempts,omitempty" yaml:"attempts,omitempty"`
+	Tools        ToolDefinitions `json:"tools,omitempty" yaml:"tools,omitempty"`
+	IterateOn    *string         `json:"iterateOn,omitempty" yaml:"iterateOn,omitempty"`
+	Concurrency  int             `json:"concurrency,omitempty" yaml:"concurrency,omitempty" validate:"omitempty,min=1"`
+	Vars         map[string]any  `json:"vars,omitempty" yaml:"vars,omitempty"`
+	OnError      OnErrorPolicy   `json:"onError,omitempty" yaml:"onError,omitempty" validate:"omitempty,oneof=fail continue fallback"`
+	Fallback     *Fallback       `json:"fallback,omitempty" yaml:"fallback,omitempty"`
+	RepairRounds *int            `json:"repairRounds,omitempty" yaml:"repairRounds,omitempty" validate:"omitempty,min=0"`
+	Ai           *AiConfig       `json:"ai,omitempty" yaml:"ai,omitempty"`
+	Loop         *Loop           `json:"loop,omitempty" yaml:"loop,omitempty"`
+	SubPlan      *SubPlan        `json:"subPlan,omitempty" yaml:"subPlan,omitempty"`
 }
 
 type PrePrompt []string
@@ -157,6 +174,8 @@ type SessionManager struct {
 	Schema        *schema.Schema    `yaml:"schema,omitempty" json:"schema,omitempty"`
 	Vars          map[string]any    `yaml:"vars,omitempty" json:"vars,omitempty"`
 	PreCalls      FunctionCallers   `yaml:"preCalls,omitempty" json:"preCalls,omitempty"`
+	Budget        *Budget           `yaml:"budget,omitempty" json:"budget,omitempty"`
+	Ai            *AiConfig         `yaml:"ai,omitempty" json:"ai,omitempty"`
 }
 
 func (s *SessionManager) AppendToSystemPrompt(prompt string) {
@@ -228,7 +247,11 @@ func (p *ParametersConfig) Validate(data any) error {
 		sx.Required = append(sx.Required, param.Name)
 		sx.Properties[param.Name] = param.Schema
 	}
-	return sx.Validate(data, &schema.ValidatorOptions{SoftValidation: p.LooseType})
+	// all the violations are reported at once, so users can fix all their parameters in one go
+	if errs := sx.ValidateAll(data, &schema.ValidatorOptions{SoftValidation: p.LooseType}); len(errs) > 0 {
+		return errs
+	}
+	return nil
 }
 
 // Components holds the reusable components of the sessions and schema
@@ -264,3 +287,22 @@ func (s *SessionManager) ComputeRequiredResources() []Resource {
 	}
 	return res
 }
+
+// GenerateGo emits the Go types matching the plan schema. The plan components the schema references become named
+// types, so the services consuming the plan output don't need to hand-write them.
+func (s *SessionManager) GenerateGo(options schema.CodegenOptions) ([]byte, error) {
+	if s.Schema == nil {
+		return nil, errors.New("the plan has no schema")
+	}
+	options.Components = s.Components.Schemas
+	return s.Schema.GenerateGo(options)
+}
+
+// GenerateTypeScript emits the TypeScript types matching the plan schema, the same way GenerateGo does.
+func (s *SessionManager) GenerateTypeScript(options schema.CodegenOptions) ([]byte, error) {
+	if s.Schema == nil {
+		return nil, errors.New("the plan has no schema")
+	}
+	options.Components = s.Components.Schemas
+	return s.Schema.GenerateTypeScript(options)
+}
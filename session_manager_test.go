@@ -18,6 +18,7 @@
 package frags
 
 import (
+	"errors"
 	"testing"
 
 	"github.com/go-playground/validator/v10"
@@ -93,6 +94,15 @@ func TestParametersConfig_Validate(t *testing.T) {
 		},
 	}
 	assert.NoError(t, cfg.Validate(map[string]any{"foo": 123}))
+
+	cfg.Parameters = append(cfg.Parameters, Parameter{Name: "bar", Schema: &schema.Schema{Type: schema.String}},
+		Parameter{Name: "baz", Schema: &schema.Schema{Type: schema.String}})
+	err := cfg.Validate(map[string]any{"foo": "abc", "bar": 12})
+	validationErrs := schema.ValidationErrors{}
+	assert.True(t, errors.As(err, &validationErrs))
+	assert.Len(t, validationErrs, 3)
+	assert.Equal(t, "missing required property: baz; bar: expected string, got int; foo: expected number, got string",
+		err.Error())
 }
 
 func TestParametersConfig_UnmarshalYAML(t *testing.T) {
@@ -137,3 +147,39 @@ func TestSessionManager_ComputeRequiredResources(t *testing.T) {
 		Identifier: "duck.txt",
 	}}, s.ComputeRequiredResources())
 }
+
+func TestSessionManager_GenerateGo(t *testing.T) {
+	sm := NewSessionManager()
+	_, err := sm.GenerateGo(schema.CodegenOptions{})
+	assert.Error(t, err)
+
+	assert.NoError(t, sm.FromYAML([]byte(`
+components:
+  schemas:
+    Person:
+      type: object
+      required: [name]
+      properties:
+        name:
+          type: string
+sessions:
+  s1:
+    prompt: who wrote the book?
+schema:
+  type: object
+  required: [author]
+  properties:
+    author:
+      $ref: "#/components/schemas/Person"
+      x-session: s1
+`)))
+	code, err := sm.GenerateGo(schema.CodegenOptions{Package: "books", RootName: "Book"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), "package books")
+	assert.Contains(t, string(code), "Author Person `json:\"author\"`")
+	assert.Contains(t, string(code), "type Person struct {\n\tName string `json:\"name\"`\n}")
+
+	code, err = sm.GenerateTypeScript(schema.CodegenOptions{RootName: "Book"})
+	assert.NoError(t, err)
+	assert.Contains(t, string(code), "export interface Book {\n  author: Person;\n}")
+}
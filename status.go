@@ -0,0 +1,201 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/util"
+)
+
+// ErrSessionCancelled is the error of the sessions cancelled with Runner.CancelSession
+var ErrSessionCancelled = errors.New("session cancelled")
+
+// SessionState is a snapshot of the progress of a session. Iteration is the index of the last iteration that
+// started, Iterations the number of iterations the session has, and CompletedIterations the ones that are over.
+// Attempts counts the prompt attempts of all the iterations, retries included. Round is the last round of a looping
+// session.
+type SessionState struct {
+	ID                  string        `json:"id" yaml:"id"`
+	Status              SessionStatus `json:"status" yaml:"status"`
+	StartedAt           *time.Time    `json:"startedAt,omitempty" yaml:"startedAt,omitempty"`
+	EndedAt             *time.Time    `json:"endedAt,omitempty" yaml:"endedAt,omitempty"`
+	Attempts            int           `json:"attempts" yaml:"attempts"`
+	Iteration           *int          `json:"iteration,omitempty" yaml:"iteration,omitempty"`
+	Iterations          int           `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+	CompletedIterations int           `json:"completedIterations,omitempty" yaml:"completedIterations,omitempty"`
+	Round               *int          `json:"round,omitempty" yaml:"round,omitempty"`
+	Error               string        `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// RunnerState is a snapshot of the progress of a run. Sessions are in the order they appear in the plan.
+type RunnerState struct {
+	Paused   bool           `json:"paused" yaml:"paused"`
+	Sessions []SessionState `json:"sessions" yaml:"sessions"`
+}
+
+// State returns a snapshot of the progress of the current (or last) run. It's safe to call while the runner is running.
+func (r *Runner) State() RunnerState {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	state := RunnerState{Paused: r.paused, Sessions: make([]SessionState, 0, len(r.sessionManager.Sessions.Order))}
+	status := r.status.Iter()
+	for _, id := range r.sessionManager.Sessions.Order {
+		sessionState := SessionState{ID: id}
+		if s, ok := r.sessionStates[id]; ok {
+			sessionState = *s
+		}
+		sessionState.Status = status[id]
+		if err, ok := r.sessionErrors.Load(id); ok && err != nil {
+			sessionState.Error = err.Error()
+		}
+		state.Sessions = append(state.Sessions, sessionState)
+	}
+	return state
+}
+
+// PauseDispatch stops the runner from starting new sessions. The sessions that are already running carry on.
+func (r *Runner) PauseDispatch() {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if !r.paused {
+		r.paused = true
+		r.logger.Info(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage("dispatch paused"))
+	}
+}
+
+// ResumeDispatch lets the runner start new sessions again, after PauseDispatch
+func (r *Runner) ResumeDispatch() {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.paused {
+		r.paused = false
+		r.logger.Info(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage("dispatch resumed"))
+		// the scheduler may be waiting for something to happen, so we wake it up
+		select {
+		case r.dispatchResumed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// isPaused returns true if the dispatch of new sessions is paused
+func (r *Runner) isPaused() bool {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	return r.paused
+}
+
+// CancelSession cancels a session of the current run. A running session is interrupted, while a session that has not
+// started yet will never start. Either way, the session fails with ErrSessionCancelled, as if its onError policy was
+// continue, so the sessions depending on it won't run, but the rest of the run carries on.
+func (r *Runner) CancelSession(sessionID string) error {
+	// the status must not change until the session is flagged, or a session that just finished could be flagged
+	r.statusMutex.Lock()
+	defer r.statusMutex.Unlock()
+	status, ok := r.status.Load(sessionID)
+	if !ok {
+		return fmt.Errorf("session %s not found", sessionID)
+	}
+	if status != QueuedSessionStatus && status != CommittedSessionStatus && status != RunningSessionStatus {
+		return fmt.Errorf("session %s is %s and cannot be cancelled", sessionID, status)
+	}
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	r.cancelledSessions[sessionID] = true
+	if cancel, ok := r.sessionCancels[sessionID]; ok {
+		cancel(ErrSessionCancelled)
+	}
+	r.logger.Info(log.NewEvent(log.GenericEventType, log.RunnerComponent).WithMessage("cancelling session").
+		WithSession(sessionID))
+	return nil
+}
+
+// isCancelled returns true if the session was cancelled with CancelSession
+func (r *Runner) isCancelled(sessionID string) bool {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	return r.cancelledSessions[sessionID]
+}
+
+// failCancelledSession marks a cancelled session as failed
+func (r *Runner) failCancelledSession(sessionID string) {
+	r.sessionErrors.Store(sessionID, ErrSessionCancelled)
+	r.logger.Warn(log.NewEvent(log.ErrorEventType, log.SessionComponent).WithMessage("session cancelled").
+		WithSession(sessionID))
+	r.SetStatus(sessionID, FailedSessionStatus)
+}
+
+// trackSessionContext keeps the context of a running session, so it can be cancelled. If the session was already
+// cancelled, the context is cancelled right away.
+func (r *Runner) trackSessionContext(sessionID string, ctx *util.FragsContext) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	r.sessionCancels[sessionID] = ctx.Cancel
+	if r.cancelledSessions[sessionID] {
+		ctx.Cancel(ErrSessionCancelled)
+	}
+}
+
+// untrackSessionContext forgets the context of a session that is no longer running
+func (r *Runner) untrackSessionContext(sessionID string) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	delete(r.sessionCancels, sessionID)
+}
+
+// resetState clears the progress of a previous run
+func (r *Runner) resetState() {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	r.sessionStates = make(map[string]*SessionState)
+	r.sessionCancels = make(map[string]func(error))
+	r.cancelledSessions = make(map[string]bool)
+}
+
+// updateState applies the update to the state of the session
+func (r *Runner) updateState(sessionID string, update func(s *SessionState)) {
+	r.stateMutex.Lock()
+	defer r.stateMutex.Unlock()
+	if r.sessionStates == nil {
+		r.sessionStates = make(map[string]*SessionState)
+	}
+	s, ok := r.sessionStates[sessionID]
+	if !ok {
+		s = &SessionState{ID: sessionID}
+		r.sessionStates[sessionID] = s
+	}
+	update(s)
+}
+
+// trackStatus records when the session started and ended
+func (r *Runner) trackStatus(sessionID string, status SessionStatus) {
+	now := time.Now()
+	r.updateState(sessionID, func(s *SessionState) {
+		switch status {
+		case RunningSessionStatus:
+			s.StartedAt = &now
+			s.EndedAt = nil
+		case FinishedSessionStatus, FailedSessionStatus, NoOpSessionStatus, FallbackSessionStatus:
+			s.EndedAt = &now
+		}
+	})
+}
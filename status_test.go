@@ -0,0 +1,181 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// blockingAi never answers the prompts containing "forever", until the context is cancelled
+type blockingAi struct {
+	DummyAi
+}
+
+func (b *blockingAi) Ask(ctx *util.FragsContext, text string, sx *schema.Schema, tools ToolDefinitions,
+	runner ExportableRunner, rx ...resources.ResourceData) ([]byte, error) {
+	if strings.Contains(text, "forever") {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	return b.DummyAi.Ask(ctx, text, sx, tools, runner, rx...)
+}
+
+func (b *blockingAi) New() Ai {
+	return &blockingAi{}
+}
+
+// waitForStatus waits until the session reaches the status
+func waitForStatus(t *testing.T, runner *Runner, sessionID string, status SessionStatus) {
+	assert.Eventually(t, func() bool {
+		for _, s := range runner.State().Sessions {
+			if s.ID == sessionID {
+				return s.Status == status
+			}
+		}
+		return false
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+// sessionState returns the state of the session
+func sessionState(runner *Runner, sessionID string) SessionState {
+	for _, s := range runner.State().Sessions {
+		if s.ID == sessionID {
+			return s
+		}
+	}
+	return SessionState{}
+}
+
+func TestRunner_State(t *testing.T) {
+	sessionData, _ := os.ReadFile("test_data/concurrent_iterations.yaml")
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML(sessionData))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi())
+	assert.Equal(t, QueuedSessionStatus, sessionState(&runner, "describe").Status)
+	_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+	assert.NoError(t, err)
+	state := sessionState(&runner, "describe")
+	assert.Equal(t, FinishedSessionStatus, state.Status)
+	assert.NotNil(t, state.StartedAt)
+	assert.NotNil(t, state.EndedAt)
+	assert.False(t, state.EndedAt.Before(*state.StartedAt))
+	assert.Equal(t, 4, state.Attempts)
+	assert.Equal(t, 4, state.Iterations)
+	assert.Equal(t, 4, state.CompletedIterations)
+	assert.NotNil(t, state.Iteration)
+}
+
+func TestRunner_PauseDispatch(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  cat:
+    prompt: describe a cat
+  dog:
+    prompt: describe a dog
+schema:
+  properties:
+    cat:
+      type: string
+      x-session: cat
+    dog:
+      type: string
+      x-session: dog
+`)))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi(), WithSessionWorkers(2))
+	runner.PauseDispatch()
+	assert.True(t, runner.State().Paused)
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		errChan <- err
+	}()
+	time.Sleep(200 * time.Millisecond)
+	// while paused, sessions are not committed to the workers
+	for _, s := range runner.State().Sessions {
+		assert.Equal(t, QueuedSessionStatus, s.Status)
+		assert.Nil(t, s.StartedAt)
+	}
+	// a session that didn't start can be cancelled, and never starts
+	assert.NoError(t, runner.CancelSession("dog"))
+	runner.ResumeDispatch()
+	err := <-errChan
+	failedErr := util.SessionsFailedError{}
+	assert.True(t, errors.As(err, &failedErr))
+	assert.Equal(t, []string{"dog"}, failedErr.FailedSessions)
+	assert.ErrorIs(t, err, ErrSessionCancelled)
+	assert.Equal(t, FinishedSessionStatus, sessionState(&runner, "cat").Status)
+	dog := sessionState(&runner, "dog")
+	assert.Equal(t, FailedSessionStatus, dog.Status)
+	assert.Nil(t, dog.StartedAt)
+	assert.Equal(t, ErrSessionCancelled.Error(), dog.Error)
+}
+
+func TestRunner_CancelSession(t *testing.T) {
+	mgr := NewSessionManager()
+	assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  slow:
+    prompt: wait forever
+  dependent:
+    prompt: describe a dog
+    dependsOn:
+      - session: slow
+  fast:
+    prompt: describe a cat
+schema:
+  properties:
+    slow:
+      type: string
+      x-session: slow
+    dependent:
+      type: string
+      x-session: dependent
+    fast:
+      type: string
+      x-session: fast
+`)))
+	runner := NewRunner(mgr, resources.NewDummyResourceLoader(), &blockingAi{}, WithSessionWorkers(2))
+	assert.Error(t, runner.CancelSession("unknown"))
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		errChan <- err
+	}()
+	waitForStatus(t, &runner, "slow", RunningSessionStatus)
+	assert.NoError(t, runner.CancelSession("slow"))
+	err := <-errChan
+	failedErr := util.SessionsFailedError{}
+	assert.True(t, errors.As(err, &failedErr))
+	assert.Equal(t, []string{"slow"}, failedErr.FailedSessions)
+	assert.Equal(t, FailedSessionStatus, sessionState(&runner, "slow").Status)
+	assert.Equal(t, NoOpSessionStatus, sessionState(&runner, "dependent").Status)
+	assert.Equal(t, FinishedSessionStatus, sessionState(&runner, "fast").Status)
+	assert.Error(t, runner.CancelSession("fast"))
+	// the cancel functions of the sessions are dropped as they end
+	assert.Empty(t, runner.sessionCancels)
+}
@@ -0,0 +1,164 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/theirish81/frags/evaluators"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// SubPlan makes a session run another plan, instead of prompting the AI. Plan is the name of a plan registered on the
+// runner (see WithPlans) or, if no plan is registered with that name, an identifier for the resource loader, such as
+// a file path. Params are the parameters of the plan, and their string values support templates. The output of the
+// plan is merged at Path, in dot notation (e.g. company.profile), or at the root of the output if Path is not set.
+type SubPlan struct {
+	Plan   string         `json:"plan" yaml:"plan" validate:"required"`
+	Params map[string]any `json:"params,omitempty" yaml:"params,omitempty"`
+	Path   *string        `json:"path,omitempty" yaml:"path,omitempty"`
+}
+
+// SubPlanCycleError is returned when a plan runs itself, either directly or through other plans.
+type SubPlanCycleError struct {
+	Chain []string
+}
+
+func (e SubPlanCycleError) Error() string {
+	return "sub-plan cycle: " + strings.Join(e.Chain, " -> ")
+}
+
+// parentRun links the runner of a sub-plan to the runner, session and iteration that started it. The sub-plan shares
+// the rate limiters and the budget of its parent, and its usage and dry run calls are reported to the parent too.
+type parentRun struct {
+	runner    *Runner
+	sessionID string
+	iteration int
+	chain     []string
+}
+
+// runSubPlan runs the sub-plan of a session with a child runner, sharing the AI of the session, the functions, the
+// tools and the logger. Events of the child runner are namespaced with the session ID.
+func (r *Runner) runSubPlan(ctx *util.FragsContext, ai Ai, sessionID string, session Session, iteratorIdx int,
+	scope evaluators.EvalScope) (promptOutput, error) {
+	subPlan := *session.SubPlan
+	chain := make([]string, 0)
+	if r.parent != nil {
+		chain = slices.Clone(r.parent.chain)
+	}
+	if slices.Contains(chain, subPlan.Plan) {
+		return promptOutput{}, SubPlanCycleError{Chain: append(chain, subPlan.Plan)}
+	}
+	plan, err := r.loadSubPlan(subPlan.Plan)
+	if err != nil {
+		return promptOutput{}, fmt.Errorf("failed to load plan %s: %w", subPlan.Plan, err)
+	}
+	params, err := evaluators.EvaluateMapValues(subPlan.Params, scope)
+	if err != nil {
+		return promptOutput{}, err
+	}
+	namespace := sessionID
+	if session.IterateOn != nil {
+		namespace = fmt.Sprintf("%s[%d]", sessionID, iteratorIdx)
+	}
+	r.logger.Info(log.NewEvent(log.StartEventType, log.SessionComponent).WithMessage("running sub-plan").
+		WithSession(sessionID).WithIteration(iteratorIdx).WithArg("plan", subPlan.Plan))
+	child := NewRunner(plan, r.resourceLoader, ai,
+		WithLogger(r.logger.WithNamespace(namespace)),
+		WithSessionWorkers(r.sessionWorkers),
+		WithScriptEngine(r.scriptEngine),
+		WithExternalFunctions(r.ExternalFunctions),
+		WithToolsDefinitions(r.ToolsDefinitions),
+		WithInternalDatabase(r.db),
+		WithRepairRounds(r.repairRounds),
+		WithPriceTable(r.priceTable),
+		WithDryRun(r.dryRun),
+		WithStubbedPreCalls(r.stubPreCalls),
+		WithAiFactories(r.aiFactories),
+		WithPlans(r.plans),
+	)
+	child.kFormat = r.kFormat
+	child.parent = &parentRun{runner: r, sessionID: sessionID, iteration: iteratorIdx,
+		chain: append(chain, subPlan.Plan)}
+	// the failure of the sub-plan must not cancel the run, so it gets a context of its own. It's still cancelled
+	// with the session, and inherits its deadline, if any.
+	childContext := ctx.ChildWithCancel()
+	defer childContext.Cancel(nil)
+	out, err := child.Run(childContext, params)
+	if err != nil {
+		r.logger.Err(log.NewEvent(log.ErrorEventType, log.SessionComponent).WithMessage("sub-plan failed").
+			WithSession(sessionID).WithIteration(iteratorIdx).WithArg("plan", subPlan.Plan).WithErr(err))
+		return promptOutput{}, err
+	}
+	var value any = map[string]any(out)
+	if subPlan.Path != nil && *subPlan.Path != "" {
+		value = nestAtPath(*subPlan.Path, value)
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		return promptOutput{}, err
+	}
+	r.logger.Info(log.NewEvent(log.EndEventType, log.SessionComponent).WithMessage("sub-plan completed").
+		WithSession(sessionID).WithIteration(iteratorIdx).WithArg("plan", subPlan.Plan))
+	return promptOutput{data: data, value: map[string]any(out)}, nil
+}
+
+// loadSubPlan returns a copy of the registered plan with the given name or, if there's none, loads it with the
+// resource loader. Registered plans are copied as runners modify the schema of their plan.
+func (r *Runner) loadSubPlan(name string) (SessionManager, error) {
+	if plan, ok := r.plans[name]; ok {
+		if plan.Schema != nil {
+			data, err := json.Marshal(plan.Schema)
+			if err != nil {
+				return plan, err
+			}
+			plan.Schema = &schema.Schema{}
+			if err := json.Unmarshal(data, plan.Schema); err != nil {
+				return plan, err
+			}
+		}
+		return plan, nil
+	}
+	if r.resourceLoader == nil {
+		return SessionManager{}, errors.New("no plan registered with this name, and no resource loader")
+	}
+	resource, err := r.resourceLoader.LoadResource(name, nil)
+	if err != nil {
+		return SessionManager{}, err
+	}
+	plan := NewSessionManager()
+	if err := plan.FromYAML(resource.ByteContent); err != nil {
+		return SessionManager{}, err
+	}
+	return plan, nil
+}
+
+// nestAtPath nests the value in maps, following the path in dot notation
+func nestAtPath(path string, value any) any {
+	keys := strings.Split(path, ".")
+	for i := len(keys) - 1; i >= 0; i-- {
+		value = map[string]any{keys[i]: value}
+	}
+	return value
+}
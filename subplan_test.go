@@ -0,0 +1,86 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestRunner_RunSubPlans(t *testing.T) {
+	parent := func(plan string) SessionManager {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(fmt.Sprintf(`
+sessions:
+  enrich:
+    subPlan:
+      plan: %s
+      params:
+        animal: "{{ .params.animal }}"
+      path: enriched.animal
+`, plan))))
+		return mgr
+	}
+	t.Run("from a file", func(t *testing.T) {
+		events := make(chan log.Event, 100)
+		runner := NewRunner(parent("sub_plan.yaml"), resources.NewFileResourceLoader("./test_data"), NewDummyAi(),
+			WithLogger(log.NewStreamerLogger(slog.Default(), events, log.InfoChannelLevel)))
+		out, err := runner.Run(util.NewFragsContext(time.Minute), map[string]any{"animal": "cat"})
+		assert.NoError(t, err)
+		assert.Contains(t, out["enriched"].(map[string]any)["animal"].(map[string]any)["description"],
+			"describe a cat")
+		assert.Positive(t, runner.Usage().Sessions["enrich"].Total())
+		close(events)
+		namespaced := false
+		for event := range events {
+			if event.Namespace != nil && *event.Namespace == "enrich" && event.Session != nil &&
+				*event.Session == "describe" {
+				namespaced = true
+			}
+		}
+		assert.True(t, namespaced)
+	})
+	t.Run("registered", func(t *testing.T) {
+		subPlan := NewSessionManager()
+		sessionData, _ := os.ReadFile("test_data/sub_plan.yaml")
+		assert.NoError(t, subPlan.FromYAML(sessionData))
+		runner := NewRunner(parent("describer"), resources.NewDummyResourceLoader(), NewDummyAi(),
+			WithPlans(map[string]SessionManager{"describer": subPlan}))
+		out, err := runner.Run(util.NewFragsContext(time.Minute), map[string]any{"animal": "dog"})
+		assert.NoError(t, err)
+		assert.Contains(t, out["enriched"].(map[string]any)["animal"].(map[string]any)["description"],
+			"describe a dog")
+	})
+	t.Run("cycle", func(t *testing.T) {
+		runner := NewRunner(parent("looping"), resources.NewDummyResourceLoader(), NewDummyAi(),
+			WithPlans(map[string]SessionManager{"looping": parent("looping")}))
+		_, err := runner.Run(util.NewFragsContext(time.Minute), map[string]any{"animal": "dog"})
+		cycleErr := SubPlanCycleError{}
+		assert.True(t, errors.As(err, &cycleErr))
+		assert.Equal(t, []string{"looping", "looping"}, cycleErr.Chain)
+	})
+}
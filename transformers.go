@@ -34,12 +34,13 @@ const (
 
 // Transformer is a functionality that given a certain input, transforms it into another output using either a
 // Jsonata expression or a custom script (if the scripting engine is available). The transformer will run on specific
-// triggers. We currently support only OnFunctionOutput.
+// triggers: OnFunctionInput, OnFunctionOutput, OnResource and OnSessionOutput.
 type Transformer struct {
 	Name             string                  `yaml:"name" json:"name"`
 	OnFunctionInput  *string                 `yaml:"onFunctionInput,omitempty" json:"onFunctionInput,omitempty"`
 	OnFunctionOutput *string                 `yaml:"onFunctionOutput,omitempty" json:"onFunctionOutput,omitempty"`
 	OnResource       *string                 `yaml:"onResource,omitempty" json:"onResource,omitempty"`
+	OnSessionOutput  *string                 `yaml:"onSessionOutput,omitempty" json:"onSessionOutput,omitempty"`
 	Jsonata          *string                 `yaml:"jsonata" json:"jsonata"`
 	JmesPath         *string                 `yaml:"jmesPath" json:"jmesPath"`
 	Expr             *string                 `yaml:"expr" json:"expr"`
@@ -83,6 +84,17 @@ func (t Transformers) FilterOnResource(name string) Transformers {
 	return t2
 }
 
+// FilterOnSessionOutput filters the transformers based on the OnSessionOutput trigger
+func (t Transformers) FilterOnSessionOutput(sessionID string) Transformers {
+	t2 := make(Transformers, 0)
+	for _, t := range t {
+		if t.OnSessionOutput != nil && *t.OnSessionOutput == sessionID {
+			t2 = append(t2, t)
+		}
+	}
+	return t2
+}
+
 // Transform applies the transformation to the given data
 func (t Transformer) Transform(ctx *util.FragsContext, data any, runner ExportableRunner) (any, error) {
 	runner.Logger().Debug(log.NewEvent(log.StartEventType, log.TransformerComponent).WithTransformer(t.Name))
@@ -0,0 +1,156 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"maps"
+
+	"github.com/theirish81/frags/log"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/schema"
+	"github.com/theirish81/frags/util"
+)
+
+// UsageStats is the token usage of (a part of) a run, with its estimated cost. Cost is nil if no price table was
+// provided, or if the price table doesn't cover all the models involved.
+type UsageStats struct {
+	util.Usage `yaml:",inline"`
+	Cost       *float64 `json:"cost,omitempty" yaml:"cost,omitempty"`
+}
+
+// UsageReport is the token usage of a run, aggregated per model, per session and per iteration. Iterations are only
+// reported for sessions with an iterator. Engines reports, per session and iteration, the engine that answered the last
+// interaction, for the sessions running on an AI that is an EngineReporter, such as a FallbackAi.
+type UsageReport struct {
+	Total      UsageStats                    `json:"total" yaml:"total"`
+	Models     map[string]UsageStats         `json:"models" yaml:"models"`
+	Sessions   map[string]UsageStats         `json:"sessions" yaml:"sessions"`
+	Iterations map[string]map[int]UsageStats `json:"iterations,omitempty" yaml:"iterations,omitempty"`
+	Engines    map[string]map[int]string     `json:"engines,omitempty" yaml:"engines,omitempty"`
+}
+
+// ask asks the AI, keeping track of the tokens it used, if the AI is a UsageTracker. If the budget of the run has
+// been exceeded, or in dry-run mode, the AI is not asked at all.
+func (r *Runner) ask(ctx *util.FragsContext, ai Ai, sessionID string, iteratorIdx int, text string, sx *schema.Schema,
+	tools ToolDefinitions, rx ...resources.ResourceData) ([]byte, error) {
+	if err := r.checkBudget(); err != nil {
+		return nil, err
+	}
+	if r.dryRun {
+		return r.dryRunAsk(sessionID, iteratorIdx, text, sx, tools, rx...)
+	}
+	if reporter, ok := ai.(EngineReporter); ok {
+		defer func() {
+			r.recordEngine(sessionID, iteratorIdx, reporter.Engine())
+		}()
+	}
+	tracker, ok := ai.(UsageTracker)
+	if !ok {
+		return ai.Ask(ctx, text, sx, tools, r, rx...)
+	}
+	before := tracker.Usage()
+	data, err := ai.Ask(ctx, text, sx, tools, r, rx...)
+	// tokens are spent even when the interaction fails, so we record them regardless
+	r.recordUsage(sessionID, iteratorIdx, tracker.Usage().Sub(before))
+	return data, err
+}
+
+// recordEngine records the engine that answered the last interaction of the session iteration
+func (r *Runner) recordEngine(sessionID string, iteratorIdx int, engine string) {
+	if engine == "" {
+		return
+	}
+	r.usageMutex.Lock()
+	defer r.usageMutex.Unlock()
+	if _, ok := r.engines[sessionID]; !ok {
+		r.engines[sessionID] = make(map[int]string)
+	}
+	r.engines[sessionID][iteratorIdx] = engine
+}
+
+// recordUsage adds the usage to the session iteration, and emits a usage event for each model
+func (r *Runner) recordUsage(sessionID string, iteratorIdx int, usage util.ModelUsage) {
+	if len(usage) == 0 {
+		return
+	}
+	r.addUsage(sessionID, iteratorIdx, usage)
+	for model, u := range usage {
+		r.logger.Info(log.NewEvent(log.UsageEventType, log.AiComponent).WithSession(sessionID).
+			WithIteration(iteratorIdx).WithUsage(u).WithArg("model", model))
+	}
+}
+
+// addUsage adds the usage to the session iteration. The usage of a sub-plan is added to the session running it as well.
+func (r *Runner) addUsage(sessionID string, iteratorIdx int, usage util.ModelUsage) {
+	r.usageMutex.Lock()
+	if _, ok := r.usage[sessionID]; !ok {
+		r.usage[sessionID] = make(map[int]util.ModelUsage)
+	}
+	r.usage[sessionID][iteratorIdx] = r.usage[sessionID][iteratorIdx].Add(usage)
+	r.usageMutex.Unlock()
+	if r.parent != nil {
+		r.parent.runner.addUsage(r.parent.sessionID, r.parent.iteration, usage)
+	}
+}
+
+// Usage returns the token usage of the current (or last) run, with cost estimates if a price table was provided.
+func (r *Runner) Usage() UsageReport {
+	r.usageMutex.Lock()
+	defer r.usageMutex.Unlock()
+	report := UsageReport{
+		Models:     make(map[string]UsageStats),
+		Sessions:   make(map[string]UsageStats),
+		Iterations: make(map[string]map[int]UsageStats),
+		Engines:    make(map[string]map[int]string),
+	}
+	for sessionID, iterations := range r.engines {
+		report.Engines[sessionID] = maps.Clone(iterations)
+	}
+	total := util.ModelUsage{}
+	for sessionID, iterations := range r.usage {
+		sessionUsage := util.ModelUsage{}
+		session := r.sessionManager.Sessions.Get(sessionID)
+		for idx, usage := range iterations {
+			sessionUsage = sessionUsage.Add(usage)
+			if session.IterateOn != nil {
+				if _, ok := report.Iterations[sessionID]; !ok {
+					report.Iterations[sessionID] = make(map[int]UsageStats)
+				}
+				report.Iterations[sessionID][idx] = r.usageStats(usage)
+			}
+		}
+		report.Sessions[sessionID] = r.usageStats(sessionUsage)
+		total = total.Add(sessionUsage)
+	}
+	for model, usage := range total {
+		report.Models[model] = r.usageStats(util.ModelUsage{model: usage})
+	}
+	report.Total = r.usageStats(total)
+	return report
+}
+
+// usageStats sums the usage of all models and estimates its cost
+func (r *Runner) usageStats(usage util.ModelUsage) UsageStats {
+	stats := UsageStats{Usage: usage.Total()}
+	if r.priceTable != nil {
+		if cost, ok := r.priceTable.Cost(usage); ok {
+			stats.Cost = &cost
+		}
+	}
+	return stats
+}
@@ -0,0 +1,126 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+// Usage is the token usage of one or more AI interactions. Input includes the Cached tokens, and Output includes
+// the Reasoning tokens, so Input + Output is the total.
+type Usage struct {
+	Input     int64 `json:"input" yaml:"input"`
+	Output    int64 `json:"output" yaml:"output"`
+	Cached    int64 `json:"cached" yaml:"cached"`
+	Reasoning int64 `json:"reasoning" yaml:"reasoning"`
+}
+
+// Add returns the sum of two usages
+func (u Usage) Add(other Usage) Usage {
+	return Usage{
+		Input:     u.Input + other.Input,
+		Output:    u.Output + other.Output,
+		Cached:    u.Cached + other.Cached,
+		Reasoning: u.Reasoning + other.Reasoning,
+	}
+}
+
+// Sub returns the difference of two usages
+func (u Usage) Sub(other Usage) Usage {
+	return Usage{
+		Input:     u.Input - other.Input,
+		Output:    u.Output - other.Output,
+		Cached:    u.Cached - other.Cached,
+		Reasoning: u.Reasoning - other.Reasoning,
+	}
+}
+
+// Total returns the total number of tokens
+func (u Usage) Total() int64 {
+	return u.Input + u.Output
+}
+
+// IsZero returns true if no tokens were used
+func (u Usage) IsZero() bool {
+	return u == Usage{}
+}
+
+// ModelUsage is token usage broken down by model
+type ModelUsage map[string]Usage
+
+// Add returns the sum of two model usages
+func (m ModelUsage) Add(other ModelUsage) ModelUsage {
+	res := make(ModelUsage)
+	for k, v := range m {
+		res[k] = v
+	}
+	for k, v := range other {
+		res[k] = res[k].Add(v)
+	}
+	return res
+}
+
+// Sub returns the difference of two model usages. Models with no difference are omitted
+func (m ModelUsage) Sub(other ModelUsage) ModelUsage {
+	res := make(ModelUsage)
+	for k, v := range m {
+		if diff := v.Sub(other[k]); !diff.IsZero() {
+			res[k] = diff
+		}
+	}
+	return res
+}
+
+// Total returns the usage of all the models combined
+func (m ModelUsage) Total() Usage {
+	total := Usage{}
+	for _, v := range m {
+		total = total.Add(v)
+	}
+	return total
+}
+
+// ModelPrice is the price of a model, per million tokens. Cached input tokens are priced as CachedInput, or as Input if
+// CachedInput is not set. Reasoning tokens are priced as Output.
+type ModelPrice struct {
+	Input       float64 `json:"input" yaml:"input"`
+	CachedInput float64 `json:"cachedInput,omitempty" yaml:"cachedInput,omitempty"`
+	Output      float64 `json:"output" yaml:"output"`
+}
+
+// Cost returns the cost of the given usage
+func (p ModelPrice) Cost(usage Usage) float64 {
+	cachedPrice := p.CachedInput
+	if cachedPrice == 0 {
+		cachedPrice = p.Input
+	}
+	return (float64(usage.Input-usage.Cached)*p.Input + float64(usage.Cached)*cachedPrice +
+		float64(usage.Output)*p.Output) / 1_000_000
+}
+
+// PriceTable maps model names to their prices
+type PriceTable map[string]ModelPrice
+
+// Cost returns the cost of the given usage. If the price of any of the models is unknown, it returns false
+func (p PriceTable) Cost(usage ModelUsage) (float64, bool) {
+	cost := 0.0
+	for model, u := range usage {
+		price, ok := p[model]
+		if !ok {
+			return 0, false
+		}
+		cost += price.Cost(u)
+	}
+	return cost, true
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package util
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestModelUsage(t *testing.T) {
+	before := ModelUsage{"m1": {Input: 10, Output: 5}}
+	after := before.Add(ModelUsage{"m1": {Input: 5, Cached: 2}, "m2": {Output: 3, Reasoning: 1}})
+	assert.Equal(t, Usage{Input: 15, Output: 5, Cached: 2}, after["m1"])
+	assert.Equal(t, ModelUsage{"m1": {Input: 5, Cached: 2}, "m2": {Output: 3, Reasoning: 1}}, after.Sub(before))
+	assert.Equal(t, Usage{Input: 15, Output: 8, Cached: 2, Reasoning: 1}, after.Total())
+	assert.Equal(t, int64(23), after.Total().Total())
+}
+
+func TestPriceTable_Cost(t *testing.T) {
+	prices := PriceTable{
+		"m1": {Input: 1, CachedInput: 0.1, Output: 10},
+		"m2": {Input: 2, Output: 4},
+	}
+	cost, ok := prices.Cost(ModelUsage{
+		"m1": {Input: 1_000_000, Cached: 500_000, Output: 100_000},
+		"m2": {Input: 1_000_000, Cached: 1_000_000},
+	})
+	assert.True(t, ok)
+	assert.InDelta(t, 0.5+0.05+1+2, cost, 0.0001)
+	_, ok = prices.Cost(ModelUsage{"m3": {Input: 1}})
+	assert.False(t, ok)
+}
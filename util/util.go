@@ -23,6 +23,7 @@ import (
 	"fmt"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/avast/retry-go/v5"
@@ -103,9 +104,30 @@ type SessionsFailedError struct {
 }
 
 func (s SessionsFailedError) Error() string {
+	if s.Err == nil {
+		return fmt.Sprintf("failed sessions: %s", strings.Join(s.FailedSessions, ","))
+	}
 	return fmt.Sprintf("failed sessions: %s - more details: %s", strings.Join(s.FailedSessions, ","), s.Err.Error())
 }
 
+func (s SessionsFailedError) Unwrap() error {
+	return s.Err
+}
+
+// IterationError is the error of a single iteration of a session iterating on a list
+type IterationError struct {
+	Index int
+	Err   error
+}
+
+func (e IterationError) Error() string {
+	return fmt.Sprintf("iteration %d: %s", e.Index, e.Err.Error())
+}
+
+func (e IterationError) Unwrap() error {
+	return e.Err
+}
+
 type CtxError struct {
 	Err1 error
 	Err2 error
@@ -115,10 +137,15 @@ func (e CtxError) Error() string {
 	return fmt.Sprintf("%s: %s", e.Err1.Error(), e.Err2.Error())
 }
 
+func (e CtxError) Unwrap() []error {
+	return []error{e.Err1, e.Err2}
+}
+
 type FragsContext struct {
 	context.Context
 	ProgramError error
 	cancel       context.CancelFunc
+	mutex        sync.Mutex
 }
 
 func NewFragsContext(timeout time.Duration) *FragsContext {
@@ -131,10 +158,14 @@ func WithFragsContext(ctx context.Context, timeout time.Duration) *FragsContext
 	return &FragsContext{Context: ctx, cancel: cancel}
 }
 
+// Cancel cancels the context. If an error is provided, it becomes the cause of the cancellation, unless the context
+// was already cancelled with an error. The first cause is usually the one that matters, as others are consequences.
 func (f *FragsContext) Cancel(err error) {
-	if err != nil {
+	f.mutex.Lock()
+	if err != nil && f.ProgramError == nil {
 		f.ProgramError = err
 	}
+	f.mutex.Unlock()
 	f.cancel()
 }
 
@@ -143,10 +174,18 @@ func (f *FragsContext) Child(timeout time.Duration) *FragsContext {
 	return &FragsContext{Context: ctx, cancel: cancel}
 }
 
+// ChildWithCancel creates a child context that can be cancelled on its own. It has no deadline but the parent's.
+func (f *FragsContext) ChildWithCancel() *FragsContext {
+	ctx, cancel := context.WithCancel(f)
+	return &FragsContext{Context: ctx, cancel: cancel}
+}
+
 func (f *FragsContext) Err() error {
 	if f.Context.Err() == nil {
 		return nil
 	}
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
 	if f.ProgramError == nil {
 		return f.Context.Err()
 	}
@@ -18,6 +18,7 @@
 package util
 
 import (
+	"context"
 	"errors"
 	"reflect"
 	"testing"
@@ -51,10 +52,31 @@ func TestFragsContext(t *testing.T) {
 		ctx.Cancel(errors.New("test error"))
 		assert.Equal(t, "context canceled: test error", ctx.Err().Error())
 	})
+	t.Run("first cause wins", func(t *testing.T) {
+		ctx := NewFragsContext(10 * time.Second)
+		ctx.Cancel(errors.New("first error"))
+		ctx.Cancel(errors.New("second error"))
+		assert.Equal(t, "context canceled: first error", ctx.Err().Error())
+	})
 	t.Run("test timeout", func(t *testing.T) {
 		ctx := NewFragsContext(10 * time.Millisecond)
 		time.Sleep(20 * time.Millisecond)
 		assert.Error(t, ctx.Err())
 		assert.Equal(t, "context deadline exceeded", ctx.Err().Error())
 	})
+	t.Run("child with cancel", func(t *testing.T) {
+		ctx := WithFragsContext(context.Background(), 10*time.Second)
+		parentDeadline, _ := ctx.Deadline()
+		child := ctx.ChildWithCancel()
+		deadline, ok := child.Deadline()
+		assert.True(t, ok)
+		assert.Equal(t, parentDeadline, deadline)
+		child.Cancel(errors.New("child error"))
+		assert.Error(t, child.Err())
+		assert.NoError(t, ctx.Err())
+
+		noDeadline := &FragsContext{Context: context.Background(), cancel: func() {}}
+		_, ok = noDeadline.ChildWithCancel().Deadline()
+		assert.False(t, ok)
+	})
 }
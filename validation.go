@@ -0,0 +1,556 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/blues/jsonata-go"
+	"github.com/jmespath/go-jmespath"
+	"github.com/theirish81/frags/evaluators"
+	"github.com/theirish81/frags/schema"
+)
+
+// DiagnosticSeverity is the severity of a Diagnostic.
+type DiagnosticSeverity string
+
+const (
+	// ErrorDiagnosticSeverity marks a problem that prevents the plan from running correctly.
+	ErrorDiagnosticSeverity DiagnosticSeverity = "error"
+	// WarningDiagnosticSeverity marks something that is likely a mistake, but won't prevent the plan from running.
+	WarningDiagnosticSeverity DiagnosticSeverity = "warning"
+)
+
+// Diagnostic is a problem found while validating a plan. Path points to the offending element of the plan, using the
+// dot notation (e.g. sessions.summary.dependsOn[0].session).
+type Diagnostic struct {
+	Severity DiagnosticSeverity `json:"severity" yaml:"severity"`
+	Path     string             `json:"path" yaml:"path"`
+	Message  string             `json:"message" yaml:"message"`
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Path, d.Message)
+}
+
+// Diagnostics is a list of Diagnostic
+type Diagnostics []Diagnostic
+
+// HasErrors returns true if at least one of the diagnostics is an error.
+func (d Diagnostics) HasErrors() bool {
+	return slices.ContainsFunc(d, func(item Diagnostic) bool {
+		return item.Severity == ErrorDiagnosticSeverity
+	})
+}
+
+// Errors returns the diagnostics with error severity.
+func (d Diagnostics) Errors() Diagnostics {
+	return d.filter(ErrorDiagnosticSeverity)
+}
+
+// Warnings returns the diagnostics with warning severity.
+func (d Diagnostics) Warnings() Diagnostics {
+	return d.filter(WarningDiagnosticSeverity)
+}
+
+func (d Diagnostics) filter(severity DiagnosticSeverity) Diagnostics {
+	res := make(Diagnostics, 0)
+	for _, item := range d {
+		if item.Severity == severity {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// PlanValidationError is returned when a plan has validation errors. It carries all the error diagnostics.
+type PlanValidationError struct {
+	Diagnostics Diagnostics
+}
+
+func (e PlanValidationError) Error() string {
+	messages := make([]string, 0, len(e.Diagnostics))
+	for _, d := range e.Diagnostics {
+		messages = append(messages, fmt.Sprintf("%s: %s", d.Path, d.Message))
+	}
+	return "invalid plan: " + strings.Join(messages, "; ")
+}
+
+// Validate statically validates the plan, without running it. It returns a list of diagnostics, that may contain
+// both errors and warnings. The checks are:
+// * dependencies on unknown sessions, and dependency cycles
+// * x-session values in the schema with no matching session
+// * sessions with a prompt, but no schema slice (they will run in subagent mode)
+// * $refs that cannot be resolved
+// * schema definitions that are malformed or contradictory
+// * requiredTools that no session uses
+// * templates (system prompt, prompts, pre-prompts) that do not parse
+// * expressions (dependsOn, iterateOn, loop) that do not compile
+// * transformers with invalid JSONata, JMESPath or expr expressions
+// * fallback sessions with no valid fallback
+// * budgets with an invalid wall time
+// * AI configurations, or their fallbacks, with no engine
+// * sessions running a sub-plan that also have prompts, which are ignored
+func (s *SessionManager) Validate() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	diagnostics = append(diagnostics, s.validateDependencies()...)
+	diagnostics = append(diagnostics, s.validateSchemaSessions()...)
+	diagnostics = append(diagnostics, s.validateRefs()...)
+	diagnostics = append(diagnostics, s.validateSchemaDefinitions()...)
+	diagnostics = append(diagnostics, s.validateRequiredTools()...)
+	diagnostics = append(diagnostics, s.validateTemplates()...)
+	diagnostics = append(diagnostics, s.validateExpressions()...)
+	diagnostics = append(diagnostics, s.validateTransformers()...)
+	diagnostics = append(diagnostics, s.validateErrorPolicies()...)
+	diagnostics = append(diagnostics, s.validateBudget()...)
+	diagnostics = append(diagnostics, s.validateAiConfigs()...)
+	diagnostics = append(diagnostics, s.validateSubPlans()...)
+	return diagnostics
+}
+
+// validateDependencies checks that session dependencies reference existing sessions and form no cycles
+func (s *SessionManager) validateDependencies() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	graph := make(map[string][]string)
+	for id, session := range s.Sessions.Iter() {
+		graph[id] = make([]string, 0)
+		for i, dep := range session.DependsOn {
+			if dep.Session == nil {
+				continue
+			}
+			if !slices.Contains(s.Sessions.Order, *dep.Session) {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: ErrorDiagnosticSeverity,
+					Path:     fmt.Sprintf("sessions.%s.dependsOn[%d].session", id, i),
+					Message:  fmt.Sprintf("unknown session %s", *dep.Session),
+				})
+				continue
+			}
+			graph[id] = append(graph[id], *dep.Session)
+		}
+	}
+	// classic depth-first search with node coloring. A node found "in progress" while visiting closes a cycle
+	const (
+		unvisited = iota
+		inProgress
+		done
+	)
+	state := make(map[string]int)
+	stack := make([]string, 0)
+	var visit func(id string)
+	visit = func(id string) {
+		state[id] = inProgress
+		stack = append(stack, id)
+		for _, dep := range graph[id] {
+			switch state[dep] {
+			case unvisited:
+				visit(dep)
+			case inProgress:
+				cycle := append(slices.Clone(stack[slices.Index(stack, dep):]), dep)
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: ErrorDiagnosticSeverity,
+					Path:     fmt.Sprintf("sessions.%s.dependsOn", id),
+					Message:  "dependency cycle: " + strings.Join(cycle, " -> "),
+				})
+			}
+		}
+		stack = stack[:len(stack)-1]
+		state[id] = done
+	}
+	for _, id := range s.Sessions.Order {
+		if state[id] == unvisited {
+			visit(id)
+		}
+	}
+	return diagnostics
+}
+
+// validateSchemaSessions checks that x-session values match existing sessions, and that sessions with a prompt have
+// a schema slice
+func (s *SessionManager) validateSchemaSessions() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	// without a schema, the whole plan runs in subagent mode, which is legit
+	if s.Schema == nil {
+		return diagnostics
+	}
+	s.Schema.Walk("schema", func(path string, node *schema.Schema) bool {
+		if node.XSession != nil && !slices.Contains(s.Sessions.Order, *node.XSession) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     path + ".x-session",
+				Message:  fmt.Sprintf("unknown session %s", *node.XSession),
+			})
+		}
+		return true
+	})
+	sessionIDs := s.Schema.GetSessionsIDs()
+	for id, session := range s.Sessions.Iter() {
+		if session.HasPrompt() && !slices.Contains(sessionIDs, id) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: WarningDiagnosticSeverity,
+				Path:     fmt.Sprintf("sessions.%s.prompt", id),
+				Message:  "the session has a prompt but no schema properties with a matching x-session, it will run in subagent mode",
+			})
+		}
+	}
+	return diagnostics
+}
+
+// walkSchemas walks the plan schema, the schema components and the parameter schemas
+func (s *SessionManager) walkSchemas(fn func(path string, node *schema.Schema) bool) {
+	s.Schema.Walk("schema", fn)
+	names := make([]string, 0, len(s.Components.Schemas))
+	for k := range s.Components.Schemas {
+		names = append(names, k)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		component := s.Components.Schemas[name]
+		component.Walk("components.schemas."+name, fn)
+	}
+	if s.Parameters != nil {
+		for _, param := range s.Parameters.Parameters {
+			param.Schema.Walk("parameters."+param.Name+".schema", fn)
+		}
+	}
+}
+
+// validateRefs checks that all the $refs in the schema and in the schema components can be resolved. References to
+// other files are not checked, as they're only loaded when the plan runs.
+func (s *SessionManager) validateRefs() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	root := schema.Schema{}
+	if s.Schema != nil {
+		root = *s.Schema
+	}
+	check := func(path string, node *schema.Schema) bool {
+		if node.Ref == nil || !strings.HasPrefix(*node.Ref, "#") {
+			return true
+		}
+		ref := *node.Ref
+		found := false
+		switch {
+		case strings.HasPrefix(ref, "#/components/schemas/"):
+			_, found = s.Components.Schemas[strings.TrimPrefix(ref, "#/components/schemas/")]
+		case strings.HasPrefix(ref, "#/$defs/"):
+			_, found = root.Defs[strings.TrimPrefix(ref, "#/$defs/")]
+		case strings.HasPrefix(ref, "#/definitions/"):
+			_, found = root.Definitions[strings.TrimPrefix(ref, "#/definitions/")]
+		default:
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     path + ".$ref",
+				Message:  fmt.Sprintf("unsupported reference %s", ref),
+			})
+			return true
+		}
+		if !found {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     path + ".$ref",
+				Message:  fmt.Sprintf("unresolved reference %s", ref),
+			})
+		}
+		return true
+	}
+	s.walkSchemas(check)
+	return diagnostics
+}
+
+// validateSchemaDefinitions checks the schemas for unknown types, invalid patterns, contradictory boundaries and
+// required properties that are not defined
+func (s *SessionManager) validateSchemaDefinitions() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	add := func(severity DiagnosticSeverity, path string, message string) {
+		diagnostics = append(diagnostics, Diagnostic{Severity: severity, Path: path, Message: message})
+	}
+	s.walkSchemas(func(path string, node *schema.Schema) bool {
+		if !slices.Contains([]schema.Type{"", schema.Object, schema.Array, schema.String, schema.Number,
+			schema.Integer, schema.Boolean}, node.Type) {
+			add(ErrorDiagnosticSeverity, path+".type", fmt.Sprintf("unknown type %s", node.Type))
+		}
+		if node.Pattern != "" {
+			if _, err := regexp.Compile(node.Pattern); err != nil {
+				add(ErrorDiagnosticSeverity, path+".pattern", fmt.Sprintf("invalid pattern: %s", err.Error()))
+			}
+		}
+		if node.MinLength != nil && node.MaxLength != nil && *node.MinLength > *node.MaxLength {
+			add(ErrorDiagnosticSeverity, path+".minLength", "minLength is greater than maxLength")
+		}
+		if node.MinItems != nil && node.MaxItems != nil && *node.MinItems > *node.MaxItems {
+			add(ErrorDiagnosticSeverity, path+".minItems", "minItems is greater than maxItems")
+		}
+		if node.MinProperties != nil && node.MaxProperties != nil && *node.MinProperties > *node.MaxProperties {
+			add(ErrorDiagnosticSeverity, path+".minProperties", "minProperties is greater than maxProperties")
+		}
+		if node.Minimum != nil && node.Maximum != nil && *node.Minimum > *node.Maximum {
+			add(ErrorDiagnosticSeverity, path+".minimum", "minimum is greater than maximum")
+		}
+		if node.ExclusiveMinimum != nil && node.ExclusiveMaximum != nil &&
+			*node.ExclusiveMinimum >= *node.ExclusiveMaximum {
+			add(ErrorDiagnosticSeverity, path+".exclusiveMinimum",
+				"exclusiveMinimum is greater than or equal to exclusiveMaximum")
+		}
+		if node.MultipleOf != nil && *node.MultipleOf <= 0 {
+			add(ErrorDiagnosticSeverity, path+".multipleOf", "multipleOf must be greater than 0")
+		}
+		for pattern := range node.PatternProperties {
+			if _, err := regexp.Compile(pattern); err != nil {
+				add(ErrorDiagnosticSeverity, path+".patternProperties."+pattern,
+					fmt.Sprintf("invalid pattern: %s", err.Error()))
+			}
+		}
+		// a $ref may resolve to an object with properties, and pattern or additional properties may define the
+		// required ones, so we can only check the properties we see
+		additional := node.AdditionalProperties != nil &&
+			(node.AdditionalProperties.Allowed || node.AdditionalProperties.Schema != nil)
+		if node.Ref == nil && node.Properties != nil && len(node.PatternProperties) == 0 && !additional {
+			for i, name := range node.Required {
+				if _, ok := node.Properties[name]; !ok {
+					add(WarningDiagnosticSeverity, fmt.Sprintf("%s.required[%d]", path, i),
+						fmt.Sprintf("required property %s is not defined", name))
+				}
+			}
+		}
+		return true
+	})
+	return diagnostics
+}
+
+// validateRequiredTools checks that every required tool is used by at least one session, pre-call or post-call
+func (s *SessionManager) validateRequiredTools() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	used := func(tool RequiredTool) bool {
+		if tool.Type == ToolTypeFunction && slices.ContainsFunc(s.PreCalls, func(fc FunctionCaller) bool {
+			return fc.Name == tool.Name
+		}) {
+			return true
+		}
+		for _, session := range s.Sessions.Iter() {
+			if session.Tools.Contains(tool.Name, tool.Type) {
+				return true
+			}
+			if tool.Type == ToolTypeFunction && slices.ContainsFunc(slices.Concat(session.PreCalls, session.PostCalls),
+				func(fc FunctionCaller) bool {
+					return fc.Name == tool.Name
+				}) {
+				return true
+			}
+		}
+		return false
+	}
+	for i, tool := range s.RequiredTools {
+		if !used(tool) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: WarningDiagnosticSeverity,
+				Path:     fmt.Sprintf("requiredTools[%d]", i),
+				Message:  fmt.Sprintf("required tool %s/%s is not used by any session", tool.Type, tool.Name),
+			})
+		}
+	}
+	return diagnostics
+}
+
+// validateTemplates checks that the system prompt, the prompts and the pre-prompts are valid Go templates
+func (s *SessionManager) validateTemplates() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	check := func(path string, text string) {
+		if err := evaluators.CompileTemplate(text); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     path,
+				Message:  fmt.Sprintf("invalid template: %s", err.Error()),
+			})
+		}
+	}
+	if s.SystemPrompt != nil {
+		check("systemPrompt", *s.SystemPrompt)
+	}
+	for id, session := range s.Sessions.Iter() {
+		for i, prePrompt := range session.PrePrompt {
+			check(fmt.Sprintf("sessions.%s.prePrompt[%d]", id, i), prePrompt)
+		}
+		if session.HasPrompt() {
+			check(fmt.Sprintf("sessions.%s.prompt", id), session.Prompt)
+		}
+	}
+	return diagnostics
+}
+
+// validateExpressions checks that dependency expressions, iterateOn expressions and loop conditions compile
+func (s *SessionManager) validateExpressions() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	check := func(path string, expression string) {
+		if err := evaluators.CompileExpression(expression); err != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     path,
+				Message:  fmt.Sprintf("invalid expression: %s", err.Error()),
+			})
+		}
+	}
+	for id, session := range s.Sessions.Iter() {
+		for i, dep := range session.DependsOn {
+			if dep.Expression != nil {
+				check(fmt.Sprintf("sessions.%s.dependsOn[%d].expression", id, i), *dep.Expression)
+			}
+		}
+		if session.IterateOn != nil {
+			check(fmt.Sprintf("sessions.%s.iterateOn", id), *session.IterateOn)
+		}
+		if session.Loop != nil {
+			check(fmt.Sprintf("sessions.%s.loop.until", id), session.Loop.Until)
+		}
+	}
+	return diagnostics
+}
+
+// validateTransformers checks that the JSONata, JMESPath and expr expressions of the transformers compile
+func (s *SessionManager) validateTransformers() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	if s.Transformers == nil {
+		return diagnostics
+	}
+	add := func(path string, kind string, err error) {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     path,
+			Message:  fmt.Sprintf("invalid %s: %s", kind, err.Error()),
+		})
+	}
+	for i, t := range *s.Transformers {
+		if t.Jsonata != nil {
+			if _, err := jsonata.Compile(*t.Jsonata); err != nil {
+				add(fmt.Sprintf("transformers[%d].jsonata", i), "JSONata expression", err)
+			}
+		}
+		if t.JmesPath != nil {
+			if _, err := jmespath.Compile(*t.JmesPath); err != nil {
+				add(fmt.Sprintf("transformers[%d].jmesPath", i), "JMESPath expression", err)
+			}
+		}
+		if t.Expr != nil {
+			if err := evaluators.CompileExpression(*t.Expr); err != nil {
+				add(fmt.Sprintf("transformers[%d].expr", i), "expression", err)
+			}
+		}
+	}
+	return diagnostics
+}
+
+// validateErrorPolicies checks that sessions with a fallback policy have a usable fallback
+func (s *SessionManager) validateErrorPolicies() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	for id, session := range s.Sessions.Iter() {
+		if session.OnError != FallbackOnErrorPolicy {
+			if session.Fallback != nil {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: WarningDiagnosticSeverity,
+					Path:     fmt.Sprintf("sessions.%s.fallback", id),
+					Message:  "the session has a fallback, but its onError policy is not fallback",
+				})
+			}
+			continue
+		}
+		if session.Fallback == nil || (session.Fallback.Value == nil && session.Fallback.Expression == nil) {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     fmt.Sprintf("sessions.%s.fallback", id),
+				Message:  "the onError policy is fallback, but no fallback value or expression is defined",
+			})
+			continue
+		}
+		if session.Fallback.Expression != nil {
+			if err := evaluators.CompileExpression(*session.Fallback.Expression); err != nil {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: ErrorDiagnosticSeverity,
+					Path:     fmt.Sprintf("sessions.%s.fallback.expression", id),
+					Message:  fmt.Sprintf("invalid expression: %s", err.Error()),
+				})
+			}
+		}
+	}
+	return diagnostics
+}
+
+// validateBudget checks that the wall time of the budget is a valid duration
+func (s *SessionManager) validateBudget() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	if s.Budget == nil || s.Budget.MaxWallTime == nil {
+		return diagnostics
+	}
+	if d, err := time.ParseDuration(*s.Budget.MaxWallTime); err != nil || d <= 0 {
+		diagnostics = append(diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "budget.maxWallTime",
+			Message:  fmt.Sprintf("invalid duration %s", *s.Budget.MaxWallTime),
+		})
+	}
+	return diagnostics
+}
+
+// validateAiConfigs checks that the AI configurations of the plan and of the sessions, and their fallbacks, select an
+// engine
+func (s *SessionManager) validateAiConfigs() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	validate := func(path string, config *AiConfig) {
+		if config == nil {
+			return
+		}
+		for i, c := range append([]AiConfig{*config}, config.Fallbacks...) {
+			enginePath := path + ".engine"
+			if i > 0 {
+				enginePath = fmt.Sprintf("%s.fallbacks[%d].engine", path, i-1)
+			}
+			if c.Engine == "" {
+				diagnostics = append(diagnostics, Diagnostic{
+					Severity: ErrorDiagnosticSeverity,
+					Path:     enginePath,
+					Message:  "the engine is required",
+				})
+			}
+		}
+	}
+	validate("ai", s.Ai)
+	for id, session := range s.Sessions.Iter() {
+		validate(fmt.Sprintf("sessions.%s.ai", id), session.Ai)
+	}
+	return diagnostics
+}
+
+// validateSubPlans checks that the sessions running a sub-plan don't have prompts, as they won't be asked
+func (s *SessionManager) validateSubPlans() Diagnostics {
+	diagnostics := make(Diagnostics, 0)
+	for id, session := range s.Sessions.Iter() {
+		if session.SubPlan == nil {
+			continue
+		}
+		if session.HasPrePrompt() || session.HasPrompt() || session.Loop != nil {
+			diagnostics = append(diagnostics, Diagnostic{
+				Severity: WarningDiagnosticSeverity,
+				Path:     fmt.Sprintf("sessions.%s.subPlan", id),
+				Message:  "the session runs a sub-plan, its prompts and loop are ignored",
+			})
+		}
+	}
+	return diagnostics
+}
@@ -0,0 +1,233 @@
+/*
+ * Copyright (C) 2026 Simone Pezzano
+ *
+ * This program is free software: you can redistribute it and/or modify
+ * it under the terms of the GNU Affero General Public License as
+ * published by the Free Software Foundation, either version 3 of the
+ * License, or (at your option) any later version.
+ *
+ * This program is distributed in the hope that it will be useful,
+ * but WITHOUT ANY WARRANTY; without even the implied warranty of
+ * MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+ * GNU Affero General Public License for more details.
+ *
+ * You should have received a copy of the GNU Affero General Public License
+ * along with this program.  If not, see <https://www.gnu.org/licenses/>.
+ */
+
+package frags
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/theirish81/frags/resources"
+	"github.com/theirish81/frags/util"
+)
+
+func TestSessionManager_Validate(t *testing.T) {
+	t.Run("valid plan", func(t *testing.T) {
+		sessionData, _ := os.ReadFile("test_data/dependant_sessions.yaml")
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(sessionData))
+		assert.Empty(t, mgr.Validate())
+	})
+	t.Run("invalid plan", func(t *testing.T) {
+		sessionData, _ := os.ReadFile("test_data/invalid_sessions.yaml")
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(sessionData))
+		diagnostics := mgr.Validate()
+		assert.True(t, diagnostics.HasErrors())
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "sessions.two.dependsOn",
+			Message:  "dependency cycle: one -> three -> two -> one",
+		})
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "sessions.four.dependsOn[0].session",
+			Message:  "unknown session ghost",
+		})
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "schema.properties.orphan.x-session",
+			Message:  "unknown session nobody",
+		})
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "schema.properties.two.$ref",
+			Message:  "unresolved reference #/components/schemas/missing",
+		})
+		assert.Contains(t, diagnostics.Warnings(), Diagnostic{
+			Severity: WarningDiagnosticSeverity,
+			Path:     "sessions.five.prompt",
+			Message:  "the session has a prompt but no schema properties with a matching x-session, it will run in subagent mode",
+		})
+		assert.Contains(t, diagnostics.Warnings(), Diagnostic{
+			Severity: WarningDiagnosticSeverity,
+			Path:     "requiredTools[0]",
+			Message:  "required tool internet_search/search is not used by any session",
+		})
+		assert.Len(t, diagnostics.Errors(), 4)
+	})
+	t.Run("invalid expressions", func(t *testing.T) {
+		sessionData, _ := os.ReadFile("test_data/invalid_expressions.yaml")
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(sessionData))
+		diagnostics := mgr.Validate()
+		paths := make([]string, 0)
+		for _, d := range diagnostics.Errors() {
+			paths = append(paths, d.Path)
+		}
+		assert.ElementsMatch(t, []string{
+			"systemPrompt",
+			"sessions.one.prePrompt[1]",
+			"sessions.one.prompt",
+			"sessions.one.iterateOn",
+			"sessions.two.dependsOn[0].expression",
+			"sessions.two.loop.until",
+			"transformers[0].jsonata",
+			"transformers[1].jmesPath",
+			"transformers[2].expr",
+			"schema.properties.one.type",
+			"schema.properties.one.pattern",
+			"schema.properties.two.properties.name.minLength",
+		}, paths)
+		assert.Contains(t, diagnostics.Warnings(), Diagnostic{
+			Severity: WarningDiagnosticSeverity,
+			Path:     "schema.properties.two.required[1]",
+			Message:  "required property age is not defined",
+		})
+	})
+	t.Run("fallback without a fallback", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+    onError: fallback
+  two:
+    prompt: describe a dog
+    fallback:
+      value:
+        two: n/a
+`)))
+		diagnostics := mgr.Validate()
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "sessions.one.fallback",
+			Message:  "the onError policy is fallback, but no fallback value or expression is defined",
+		})
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: WarningDiagnosticSeverity,
+			Path:     "sessions.two.fallback",
+			Message:  "the session has a fallback, but its onError policy is not fallback",
+		})
+	})
+	t.Run("invalid budget wall time", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+budget:
+  maxWallTime: ten minutes
+sessions:
+  one:
+    prompt: describe a cat
+`)))
+		assert.Contains(t, mgr.Validate(), Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "budget.maxWallTime",
+			Message:  "invalid duration ten minutes",
+		})
+	})
+	t.Run("ai with no engine", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+ai:
+  engine: gemini
+  fallbacks:
+    - model: large
+sessions:
+  one:
+    prompt: describe a cat
+    ai:
+      model: small
+`)))
+		diagnostics := mgr.Validate()
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "sessions.one.ai.engine",
+			Message:  "the engine is required",
+		})
+		assert.Contains(t, diagnostics, Diagnostic{
+			Severity: ErrorDiagnosticSeverity,
+			Path:     "ai.fallbacks[0].engine",
+			Message:  "the engine is required",
+		})
+	})
+	t.Run("sub-plan with a prompt", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+    subPlan:
+      plan: describer.yaml
+`)))
+		assert.Contains(t, mgr.Validate(), Diagnostic{
+			Severity: WarningDiagnosticSeverity,
+			Path:     "sessions.one.subPlan",
+			Message:  "the session runs a sub-plan, its prompts and loop are ignored",
+		})
+	})
+	t.Run("schema references", func(t *testing.T) {
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML([]byte(`
+sessions:
+  one:
+    prompt: describe a cat
+schema:
+  type: object
+  properties:
+    cat:
+      $ref: "#/$defs/Cat"
+      x-session: one
+    dog:
+      $ref: "#/definitions/Dog"
+      x-session: one
+    invoice:
+      $ref: "./schemas/invoice.yaml#/Invoice"
+      x-session: one
+    other:
+      $ref: "#/other/Thing"
+      x-session: one
+  $defs:
+    Cat:
+      type: string
+`)))
+		assert.ElementsMatch(t, Diagnostics{
+			{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     "schema.properties.dog.$ref",
+				Message:  "unresolved reference #/definitions/Dog",
+			},
+			{
+				Severity: ErrorDiagnosticSeverity,
+				Path:     "schema.properties.other.$ref",
+				Message:  "unsupported reference #/other/Thing",
+			},
+		}, mgr.Validate().Errors())
+	})
+	t.Run("run refuses an invalid plan", func(t *testing.T) {
+		sessionData, _ := os.ReadFile("test_data/invalid_sessions.yaml")
+		mgr := NewSessionManager()
+		assert.NoError(t, mgr.FromYAML(sessionData))
+		runner := NewRunner(mgr, resources.NewDummyResourceLoader(), NewDummyAi())
+		_, err := runner.Run(util.NewFragsContext(time.Minute), nil)
+		validationErr := PlanValidationError{}
+		assert.True(t, errors.As(err, &validationErr))
+		assert.Len(t, validationErr.Diagnostics, 4)
+	})
+}